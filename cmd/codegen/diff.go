@@ -0,0 +1,199 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/generator"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/git"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/inventory"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/plan"
+)
+
+type diffOptions struct {
+	upstreamDir string
+	base        string
+	head        string
+	format      string
+	filter      plan.Filter
+	codegen     codegenFlags
+}
+
+// rendered is the output tree rendered from an upstream revision.
+type rendered struct {
+	files   plan.Files
+	objects []*inventory.Object
+}
+
+// runDiff renders two revisions of a local upstream repo in memory, and prints the
+// differences of their output trees.
+func runDiff(args []string) error {
+	var o diffOptions
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.StringVar(&o.upstreamDir, "upstream-dir", ".", "Path to the local git repo of the upstream.")
+	fs.StringVar(&o.base, "base", "HEAD~1", "The upstream git ref to diff from.")
+	fs.StringVar(&o.head, "head", "HEAD", "The upstream git ref to diff to.")
+	fs.StringVar(&o.format, "format", "unified", "Output format, one of: unified, objects.")
+	fs.StringVar(&o.filter.TenantID, "tenant", "", "Only show the changes of the given tenant.")
+	fs.StringVar(&o.filter.CloudProvider, "provider", "", "Only show the changes of the given cloud provider.")
+	fs.StringVar(&o.filter.AccountID, "account", "", "Only show the changes of the given account.")
+	o.codegen.AddFlags(fs)
+	_ = fs.Parse(args)
+	if o.format != "unified" && o.format != "objects" {
+		return fmt.Errorf("unsupported format: %q", o.format)
+	}
+
+	codegenOpts, err := o.codegen.Options()
+	if err != nil {
+		return err
+	}
+	before, err := renderRef(o.upstreamDir, o.base, codegenOpts)
+	if err != nil {
+		return err
+	}
+	after, err := renderRef(o.upstreamDir, o.head, codegenOpts)
+	if err != nil {
+		return err
+	}
+
+	if o.format == "objects" {
+		return plan.PrintObjects(os.Stdout, plan.CompareObjects(before.objects, after.objects, &o.filter))
+	}
+	return plan.PrintUnified(os.Stdout, plan.FilterChanges(plan.Compare(before.files, after.files), &o.filter))
+}
+
+// renderRef renders the upstream repo at the given ref into memory.
+func renderRef(repoDir, ref string, codegenOpts []generator.CodegenOption) (*rendered, error) {
+	uDir, err := os.MkdirTemp("", "codegen-diff-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(uDir)
+	if err := exportRef(repoDir, ref, uDir); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	upstreamConfig, err := git.LoadUpstreamConfig(ctx, uDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load upstream config at %s: %w", ref, err)
+	}
+
+	const dstDir = "/downstream"
+	memFs := afero.NewMemMapFs()
+	cg := generator.NewCodegen(append(codegenOpts, generator.WithFs(memFs))...)
+	if err := cg.FanOutArtifacts(ctx, dstDir, upstreamConfig.Accounts, upstreamConfig.TenantTuples); err != nil {
+		return nil, fmt.Errorf("failed to render artifacts at %s: %w", ref, err)
+	}
+
+	files, err := plan.Snapshot(memFs, dstDir)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := inventory.Scan(memFs, dstDir)
+	if err != nil {
+		return nil, err
+	}
+	return &rendered{files: files, objects: objects}, nil
+}
+
+// exportRef writes the tree of the given ref into 'dstDir', leaving the repo untouched.
+func exportRef(repoDir, ref, dstDir string) error {
+	cmd := exec.Command("git", "-C", repoDir, "archive", "--format=tar", ref)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to run git archive: %w", err)
+	}
+	extractErr := extractTar(stdout, dstDir)
+	// Drain the pipe so that git doesn't block on a failed extraction.
+	_, _ = io.Copy(io.Discard, stdout)
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("failed to export %s: %w: %s", ref, err, strings.TrimSpace(stderr.String()))
+	}
+	return extractErr
+}
+
+// extractTar writes the archive into 'dstDir'. The links must point inside 'dstDir', and the
+// entries other than directories, regular files and links are refused, rather than skipped
+// which would show their files as deleted.
+func extractTar(r io.Reader, dstDir string) error {
+	root := filepath.Clean(dstDir) + string(os.PathSeparator)
+	inRoot := func(path string) bool {
+		return strings.HasPrefix(path, root)
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		path := filepath.Join(dstDir, hdr.Name)
+		if !inRoot(path) {
+			return fmt.Errorf("invalid path in archive: %s", hdr.Name)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode)&0777)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return fmt.Errorf("failed to write %s: %w", path, err)
+			}
+		case tar.TypeSymlink:
+			if filepath.IsAbs(hdr.Linkname) || !inRoot(filepath.Join(filepath.Dir(path), hdr.Linkname)) {
+				return fmt.Errorf("invalid symlink in archive: %s -> %s", hdr.Name, hdr.Linkname)
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(hdr.Linkname, path); err != nil {
+				return fmt.Errorf("failed to link %s: %w", path, err)
+			}
+		case tar.TypeLink:
+			target := filepath.Join(dstDir, hdr.Linkname)
+			if !inRoot(target) {
+				return fmt.Errorf("invalid hard link in archive: %s -> %s", hdr.Name, hdr.Linkname)
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			if err := os.Link(target, path); err != nil {
+				return fmt.Errorf("failed to link %s: %w", path, err)
+			}
+		case tar.TypeXGlobalHeader:
+			// git archive records the commit ID in a global header.
+		default:
+			return fmt.Errorf("unsupported entry in archive: %s (type %q)", hdr.Name, hdr.Typeflag)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/bombsimon/logrusr/v4"
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
 	"sigs.k8s.io/prow/pkg/config/secret"
 	"sigs.k8s.io/prow/pkg/flagutil"
 	configflagutil "sigs.k8s.io/prow/pkg/flagutil/config"
@@ -18,6 +19,9 @@ import (
 	"sigs.k8s.io/prow/pkg/pjutil"
 	"sigs.k8s.io/prow/pkg/pluginhelp/externalplugins"
 
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/config"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/cost"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/generator"
 	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/git"
 	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/prow"
 )
@@ -32,6 +36,51 @@ type options struct {
 	logLevel               string
 
 	webhookSecretFile string
+	pluginConfigFile  string
+	priceTableFile    string
+	signOff           bool
+	signingKeyFile    string
+	stateDir          string
+	janitorPeriod     time.Duration
+	staleBranchAge    time.Duration
+	codegen           codegenFlags
+}
+
+// pluginConfigSyncPeriod is how often the plugin config file is checked for changes.
+const pluginConfigSyncPeriod = time.Minute
+
+// codegenFlags are the flags of the generator, shared by the plugin server and the subcommands.
+type codegenFlags struct {
+	accountSettingsFile string
+	gitOpsConfigFile    string
+}
+
+func (o *codegenFlags) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.accountSettingsFile, "account-settings-file", "", "Path to the YAML file containing the per-account and per-provider settings of the generator. Optional.")
+	fs.StringVar(&o.gitOpsConfigFile, "gitops-config-file", "", "Path to the YAML file configuring the Argo CD or Flux objects generated for the output tree. Optional.")
+}
+
+// Options loads the files referred by the flags into generator options.
+func (o *codegenFlags) Options() ([]generator.CodegenOption, error) {
+	var codegenOpts []generator.CodegenOption
+	if o.accountSettingsFile != "" {
+		settings, err := generator.LoadSettings(afero.NewOsFs(), o.accountSettingsFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading account settings: %w", err)
+		}
+		codegenOpts = append(codegenOpts,
+			generator.WithAccountSettings(settings.Accounts),
+			generator.WithProviderSettings(settings.Providers),
+		)
+	}
+	if o.gitOpsConfigFile != "" {
+		gitOpsConfig, err := generator.LoadGitOpsConfig(afero.NewOsFs(), o.gitOpsConfigFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading GitOps config: %w", err)
+		}
+		codegenOpts = append(codegenOpts, generator.WithGitOps(gitOpsConfig))
+	}
+	return codegenOpts, nil
 }
 
 func (o *options) Validate() error {
@@ -50,6 +99,14 @@ func gatherOptions() options {
 	fs.IntVar(&o.port, "port", 8888, "Port to listen on.")
 	fs.BoolVar(&o.dryRun, "dry-run", true, "Dry run for testing. Uses API tokens but does not mutate.")
 	fs.StringVar(&o.webhookSecretFile, "hmac-secret-file", "/etc/webhook/hmac", "Path to the file containing the GitHub HMAC secret.")
+	fs.StringVar(&o.pluginConfigFile, "plugin-config-file", "", "Path to the YAML file mapping the upstream repos to their downstream repos. It's reloaded when it changes. Defaults to a single downstream repo for all the upstream repos.")
+	fs.StringVar(&o.priceTableFile, "price-table-file", "", "Path to the YAML file containing the price table to estimate the cost of generated PRs. Optional.")
+	fs.BoolVar(&o.signOff, "signoff", false, "Add a DCO Signed-off-by trailer of the bot to the generated commits.")
+	fs.StringVar(&o.signingKeyFile, "signing-key-file", "", "Path to the file containing the unencrypted SSH or armored GPG private key to sign the generated commits with. It's reloaded when it changes. Optional.")
+	fs.StringVar(&o.stateDir, "state-dir", "", "Directory to record the progress of the downstream PRs in, so that a failed run is resumed after a restart. Defaults to keeping it in memory.")
+	fs.DurationVar(&o.janitorPeriod, "branch-janitor-period", time.Hour, "How often the stale branches of the generated PRs are deleted from the bot's forks. 0 disables it.")
+	fs.DurationVar(&o.staleBranchAge, "stale-branch-age", 7*24*time.Hour, "Age after which a generated branch without an open PR is deleted.")
+	o.codegen.AddFlags(fs)
 	fs.StringVar(&o.logLevel, "log-level", "debug", fmt.Sprintf("Log level is one of %v.", logrus.AllLevels))
 	for _, group := range []flagutil.OptionGroup{&o.github, &o.instrumentationOptions, &o.config} {
 		group.AddFlags(fs)
@@ -59,6 +116,26 @@ func gatherOptions() options {
 }
 
 func main() {
+	// Subcommands run locally, without the plugin server.
+	if len(os.Args) > 1 {
+		var run func([]string) error
+		switch os.Args[1] {
+		case "render":
+			run = runRender
+		case "validate":
+			run = runValidate
+		case "diff":
+			run = runDiff
+		}
+		if run != nil {
+			if err := run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	logrusutil.ComponentInit()
 	o := gatherOptions()
 	if err := o.Validate(); err != nil {
@@ -101,19 +178,57 @@ func main() {
 	}
 
 	logger := logrusr.New(log)
-	gitResourceWorker := git.NewResourceWorker(
+	workerOpts := []git.ResourceWorkerOption{
 		git.WithGC(gitClient),
 		git.WithGHC(githubClient),
 		git.WithBotUser(botUser),
 		git.WithEmail(email),
+		git.WithSignOff(o.signOff),
 		git.WithLogger(logger),
-	)
+	}
+	if o.priceTableFile != "" {
+		priceTable, err := cost.LoadPriceTable(afero.NewOsFs(), o.priceTableFile)
+		if err != nil {
+			logrus.WithError(err).Fatal("Error loading price table.")
+		}
+		workerOpts = append(workerOpts, git.WithPriceTable(priceTable))
+	}
+	if o.signingKeyFile != "" {
+		signer, err := secret.AddWithParser(o.signingKeyFile, git.ParseSigner)
+		if err != nil {
+			logrus.WithError(err).Fatal("Error loading signing key.")
+		}
+		workerOpts = append(workerOpts, git.WithSigner(signer))
+	}
+	if o.stateDir != "" {
+		workerOpts = append(workerOpts, git.WithStateStore(git.NewFileStateStore(afero.NewOsFs(), o.stateDir)))
+	}
+	gitResourceWorker := git.NewResourceWorker(workerOpts...)
+
+	codegenOpts, err := o.codegen.Options()
+	if err != nil {
+		logrus.WithError(err).Fatal("Error loading codegen options.")
+	}
+
+	configAgent := config.NewStaticAgent(config.Default())
+	if o.pluginConfigFile != "" {
+		if configAgent, err = config.NewAgent(afero.NewOsFs(), o.pluginConfigFile, logger); err != nil {
+			logrus.WithError(err).Fatal("Error loading plugin config.")
+		}
+		interrupts.TickLiteral(configAgent.Sync, pluginConfigSyncPeriod)
+	}
 
 	server := prow.NewPlugin(
 		secret.GetTokenGenerator(o.webhookSecretFile),
 		gitResourceWorker,
+		configAgent,
+		codegenOpts,
 	)
 
+	if o.janitorPeriod > 0 && !o.dryRun {
+		interrupts.TickLiteral(func() { server.CleanUpBranches(o.staleBranchAge) }, o.janitorPeriod)
+	}
+
 	health := pjutil.NewHealthOnPort(o.instrumentationOptions.HealthPort)
 	health.ServeReady()
 
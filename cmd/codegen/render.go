@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/spf13/afero"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/generator"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/git"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/plan"
+)
+
+type renderOptions struct {
+	upstreamDir string
+	outputDir   string
+	dryRun      bool
+	codegen     codegenFlags
+}
+
+// runRender renders the artifacts of a local upstream checkout into a local output
+// directory, without talking to GitHub.
+func runRender(args []string) error {
+	var o renderOptions
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	fs.StringVar(&o.upstreamDir, "upstream-dir", ".", "Path to the local checkout of the upstream repo.")
+	fs.StringVar(&o.outputDir, "output-dir", "", "Path to the local checkout of the downstream repo, which the artifacts are rendered into.")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "Print the plan without writing the output directory.")
+	o.codegen.AddFlags(fs)
+	_ = fs.Parse(args)
+	if o.outputDir == "" {
+		return fmt.Errorf("--output-dir is required")
+	}
+
+	ctx := context.Background()
+	upstreamConfig, err := git.LoadUpstreamConfig(ctx, o.upstreamDir)
+	if err != nil {
+		return err
+	}
+
+	osFs := afero.NewOsFs()
+	before, err := plan.Snapshot(osFs, o.outputDir)
+	if err != nil {
+		return err
+	}
+	// On dry-run, render into a copy of the output tree in memory.
+	outFs := osFs
+	if o.dryRun {
+		outFs = afero.NewMemMapFs()
+		if err := plan.Restore(outFs, o.outputDir, before); err != nil {
+			return err
+		}
+	}
+
+	codegenOpts, err := o.codegen.Options()
+	if err != nil {
+		return err
+	}
+	cg := generator.NewCodegen(append(codegenOpts, generator.WithFs(outFs))...)
+	if err := cg.FanOutArtifacts(ctx, o.outputDir, upstreamConfig.Accounts, upstreamConfig.TenantTuples); err != nil {
+		return fmt.Errorf("failed to render artifacts: %w", err)
+	}
+
+	after, err := plan.Snapshot(outFs, o.outputDir)
+	if err != nil {
+		return err
+	}
+	return plan.Print(os.Stdout, plan.Compare(before, after))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/git"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/validate"
+)
+
+var errValidationFailed = errors.New("validation failed")
+
+type validateOptions struct {
+	upstreamDir string
+	format      string
+}
+
+// runValidate evaluates the user input of a local upstream checkout, and fails if there
+// is any error. It's meant to run as an upstream presubmit.
+func runValidate(args []string) error {
+	var o validateOptions
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	fs.StringVar(&o.upstreamDir, "upstream-dir", ".", "Path to the local checkout of the upstream repo.")
+	fs.StringVar(&o.format, "format", "github", "Output format, one of: json, github.")
+	_ = fs.Parse(args)
+
+	write := validate.WriteGitHub
+	switch o.format {
+	case "github":
+	case "json":
+		write = validate.WriteJSON
+	default:
+		return fmt.Errorf("unsupported format: %q", o.format)
+	}
+
+	upstreamConfig, fileErrs := git.CollectUpstreamConfig(context.Background(), o.upstreamDir)
+	var findings []*validate.Finding
+	for _, fileErr := range fileErrs {
+		findings = append(findings, &validate.Finding{
+			Severity: validate.SeverityError,
+			File:     fileErr.Path,
+			Message:  fileErr.Err.Error(),
+		})
+	}
+	findings = append(findings, validate.Validate(upstreamConfig.Accounts, upstreamConfig.TenantTuples)...)
+
+	if err := write(os.Stdout, findings); err != nil {
+		return err
+	}
+	if validate.HasErrors(findings) {
+		return errValidationFailed
+	}
+	return nil
+}
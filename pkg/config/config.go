@@ -0,0 +1,565 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/afero"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/yaml"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/generator"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/common/selector/key"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/infra/account"
+)
+
+const (
+	DefaultLabel        = "post-merge/codegen"
+	DefaultTargetBranch = "main"
+	DefaultTitle        = "🇯🇵 25 KubeCon CodeGen"
+	// DefaultDownstream is the downstream repo used when no config file is given.
+	DefaultDownstream = "Huang-Wei/25-kubecon-jp-codegen"
+	// DefaultDirectBranchPrefix is the prefix of the branches pushed to the downstream repo.
+	DefaultDirectBranchPrefix = "codegen/"
+)
+
+// The push modes of the generated branches.
+const (
+	// PushModeFork pushes the branches to the bot's fork of the downstream repo.
+	PushModeFork = "fork"
+	// PushModeDirect pushes the branches to the downstream repo, for the orgs forbidding forks.
+	PushModeDirect = "direct"
+)
+
+// Config is the configuration of the plugin, e.g.:
+//
+//	repos:
+//	  my-org/infra:
+//	    downstream: my-org/infra-gitops
+//	    targetBranch: master
+//	    outputRoot: generated
+//	  my-org:
+//	    downstream: my-org/gitops
+type Config struct {
+	// Repos maps an upstream "org/repo", or all the repos of an "org", to its downstream.
+	Repos map[string]*Mapping `json:"repos,omitempty"`
+	// Default applies to the upstream repos that are not listed in Repos. Optional.
+	Default *Mapping `json:"default,omitempty"`
+}
+
+// Mapping configures the downstream of an upstream repo.
+type Mapping struct {
+	// Downstream is the "org/repo" the generated PRs are opened in.
+	Downstream string `json:"downstream"`
+	// Label triggers the codegen when it's set on a merged upstream PR.
+	Label string `json:"label,omitempty"`
+	// TargetBranch is the base branch of the generated PRs.
+	TargetBranch string `json:"targetBranch,omitempty"`
+	// OutputRoot is the directory of the downstream repo the output tree is generated in.
+	// Defaults to the root of the repo.
+	OutputRoot string `json:"outputRoot,omitempty"`
+	// Title is the title of the generated PRs, which is followed by the upstream PR.
+	Title string `json:"title,omitempty"`
+	// EnvBranches maps the envs of the tenants to the target branches of their output,
+	// e.g., {prod: prod, dev: nonprod}. The other envs go to TargetBranch. Optional.
+	EnvBranches map[string]string `json:"envBranches,omitempty"`
+	// AutoMerge merges the generated PRs without a review if they are low-risk. Optional.
+	AutoMerge *AutoMerge `json:"autoMerge,omitempty"`
+	// PushMode is either fork or direct. Defaults to fork.
+	PushMode string `json:"pushMode,omitempty"`
+	// BranchPrefix is prepended to the generated branches. Defaults to DefaultDirectBranchPrefix
+	// in the direct push mode, so that they are told apart from the other branches.
+	BranchPrefix string `json:"branchPrefix,omitempty"`
+
+	// Routes send slices of the output to other downstream repos. A resource goes to
+	// the first route that matches it, or to Downstream if none does. Downstream may
+	// be empty if the routes cover all the output. Optional.
+	Routes []*Route `json:"routes,omitempty"`
+}
+
+// Route sends the resources it matches to a downstream repo. The set matchers must
+// all match, e.g., {cloudProviders: [aws], kinds: [bucket]} matches the AWS buckets.
+type Route struct {
+	// Downstream is the "org/repo" the generated PRs are opened in.
+	Downstream string `json:"downstream"`
+	// TargetBranch, OutputRoot, Title, EnvBranches, AutoMerge, PushMode and BranchPrefix
+	// default to the ones of the mapping.
+	TargetBranch string            `json:"targetBranch,omitempty"`
+	OutputRoot   string            `json:"outputRoot,omitempty"`
+	Title        string            `json:"title,omitempty"`
+	EnvBranches  map[string]string `json:"envBranches,omitempty"`
+	AutoMerge    *AutoMerge        `json:"autoMerge,omitempty"`
+	PushMode     string            `json:"pushMode,omitempty"`
+	BranchPrefix string            `json:"branchPrefix,omitempty"`
+
+	// CloudProviders matches the resources generated in the accounts of these providers.
+	CloudProviders []string `json:"cloudProviders,omitempty"`
+	// AccountTags matches the resources generated in the accounts with all these tags.
+	AccountTags map[string]string `json:"accountTags,omitempty"`
+	// Kinds matches the resources of these kinds, i.e., "bucket" and "queue".
+	Kinds []string `json:"kinds,omitempty"`
+}
+
+// AutoMerge merges a generated PR once the checks of the downstream repo pass, if its plan
+// only creates resources, all in low-risk envs. Deletions, updates and the prod envs always
+// need a review.
+type AutoMerge struct {
+	// LowRiskEnvs are the envs, as tagged on the accounts, whose new resources need no review.
+	LowRiskEnvs []string `json:"lowRiskEnvs"`
+	// Method is one of merge, squash and rebase. Defaults to squash.
+	Method string `json:"method,omitempty"`
+	// Approve approves the PR before merging it, if the bot is allowed to.
+	Approve bool `json:"approve,omitempty"`
+}
+
+const DefaultMergeMethod = "squash"
+
+// prodEnvs can't be marked low-risk.
+var prodEnvs = sets.New("prod", "production")
+
+func (a *AutoMerge) complete() error {
+	if len(a.LowRiskEnvs) == 0 {
+		return errors.New("autoMerge: lowRiskEnvs must not be empty")
+	}
+	for _, env := range a.LowRiskEnvs {
+		if prodEnvs.Has(strings.ToLower(env)) {
+			return fmt.Errorf("autoMerge: %q can't be a low-risk env", env)
+		}
+	}
+	switch a.Method {
+	case "":
+		a.Method = DefaultMergeMethod
+	case "merge", "squash", "rebase":
+	default:
+		return fmt.Errorf("autoMerge: method must be one of merge, squash and rebase, got %q", a.Method)
+	}
+	return nil
+}
+
+// LowRisk returns whether new resources in 'env' can be merged without a review.
+func (a *AutoMerge) LowRisk(env string) bool {
+	return a != nil && env != "" && !prodEnvs.Has(strings.ToLower(env)) && slices.Contains(a.LowRiskEnvs, env)
+}
+
+// Target is a downstream repo that receives a slice of the output.
+type Target struct {
+	// Mapping is the effective mapping of the target. It has no routes.
+	*Mapping
+	// Filter is nil if the target receives all the output.
+	Filter generator.Filter
+}
+
+// Default returns the config used when no config file is given, which routes all the
+// upstream repos to DefaultDownstream.
+func Default() *Config {
+	c := &Config{Default: &Mapping{Downstream: DefaultDownstream}}
+	_ = c.complete()
+	return c
+}
+
+// Load loads the config from the given YAML file.
+func Load(fs afero.Fs, path string) (*Config, error) {
+	data, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return parse(path, data)
+}
+
+func parse(path string, data []byte) (*Config, error) {
+	var c Config
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := c.complete(); err != nil {
+		return nil, fmt.Errorf("invalid plugin config %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// complete validates the config and fills in the defaults.
+func (c *Config) complete() error {
+	if len(c.Repos) == 0 && c.Default == nil {
+		return errors.New("no repo is configured")
+	}
+	var errs []error
+	keys := make([]string, 0, len(c.Repos))
+	for key := range c.Repos {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !isOrgRepo(key) && (key == "" || strings.Contains(key, "/")) {
+			errs = append(errs, fmt.Errorf("repos[%q]: must be either an org or an org/repo", key))
+			continue
+		}
+		if err := c.Repos[key].complete(); err != nil {
+			errs = append(errs, fmt.Errorf("repos[%q]: %w", key, err))
+		}
+	}
+	if c.Default != nil {
+		if err := c.Default.complete(); err != nil {
+			errs = append(errs, fmt.Errorf("default: %w", err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (m *Mapping) complete() error {
+	if m == nil {
+		return errors.New("must not be empty")
+	}
+	if !isOrgRepo(m.Downstream) && (m.Downstream != "" || len(m.Routes) == 0) {
+		return fmt.Errorf("downstream must be an org/repo, got %q", m.Downstream)
+	}
+	if m.Label == "" {
+		m.Label = DefaultLabel
+	}
+	if m.TargetBranch == "" {
+		m.TargetBranch = DefaultTargetBranch
+	}
+	if m.Title == "" {
+		m.Title = DefaultTitle
+	}
+	root, err := cleanOutputRoot(m.OutputRoot)
+	if err != nil {
+		return err
+	}
+	m.OutputRoot = root
+	if err := validateEnvBranches(m.EnvBranches); err != nil {
+		return err
+	}
+	if m.AutoMerge != nil {
+		if err := m.AutoMerge.complete(); err != nil {
+			return err
+		}
+	}
+	if err := completePushMode(&m.PushMode, &m.BranchPrefix); err != nil {
+		return err
+	}
+
+	var errs []error
+	for i, route := range m.Routes {
+		if err := route.complete(m); err != nil {
+			errs = append(errs, fmt.Errorf("routes[%d]: %w", i, err))
+		}
+	}
+	if len(errs) != 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+	// Each target has its own branch, which is named after the target branch.
+	seen := sets.New[string]()
+	for _, target := range m.Targets() {
+		key := target.Downstream + ":" + target.TargetBranch
+		if seen.Has(key) {
+			return fmt.Errorf("more than one target in %s on branch %q", target.Downstream, target.TargetBranch)
+		}
+		seen.Insert(key)
+	}
+	return nil
+}
+
+func (r *Route) complete(m *Mapping) error {
+	if r == nil {
+		return errors.New("must not be empty")
+	}
+	if !isOrgRepo(r.Downstream) {
+		return fmt.Errorf("downstream must be an org/repo, got %q", r.Downstream)
+	}
+	if len(r.CloudProviders) == 0 && len(r.AccountTags) == 0 && len(r.Kinds) == 0 {
+		return errors.New("at least one of cloudProviders, accountTags and kinds must be set")
+	}
+	for _, kind := range r.Kinds {
+		if kind != generator.KindBucket && kind != generator.KindQueue {
+			return fmt.Errorf("unsupported kind: %q", kind)
+		}
+	}
+	if r.TargetBranch == "" {
+		r.TargetBranch = m.TargetBranch
+	}
+	if r.Title == "" {
+		r.Title = m.Title
+	}
+	if r.OutputRoot == "" {
+		r.OutputRoot = m.OutputRoot
+	}
+	if r.EnvBranches == nil {
+		r.EnvBranches = m.EnvBranches
+	}
+	if err := validateEnvBranches(r.EnvBranches); err != nil {
+		return err
+	}
+	if r.AutoMerge == nil {
+		r.AutoMerge = m.AutoMerge
+	} else if err := r.AutoMerge.complete(); err != nil {
+		return err
+	}
+	if r.PushMode == "" {
+		r.PushMode = m.PushMode
+		if r.BranchPrefix == "" {
+			r.BranchPrefix = m.BranchPrefix
+		}
+	}
+	if err := completePushMode(&r.PushMode, &r.BranchPrefix); err != nil {
+		return err
+	}
+	root, err := cleanOutputRoot(r.OutputRoot)
+	if err != nil {
+		return err
+	}
+	r.OutputRoot = root
+	return nil
+}
+
+// completePushMode validates the push mode and the branch prefix, and fills in their defaults.
+func completePushMode(pushMode, branchPrefix *string) error {
+	switch *pushMode {
+	case "":
+		*pushMode = PushModeFork
+	case PushModeFork:
+	case PushModeDirect:
+		if *branchPrefix == "" {
+			*branchPrefix = DefaultDirectBranchPrefix
+		}
+	default:
+		return fmt.Errorf("pushMode must be either %s or %s, got %q", PushModeFork, PushModeDirect, *pushMode)
+	}
+	if strings.HasPrefix(*branchPrefix, "/") || strings.Contains(*branchPrefix, "..") || strings.ContainsAny(*branchPrefix, " ~^:?*[\\") {
+		return fmt.Errorf("branchPrefix is not a valid branch name prefix: %q", *branchPrefix)
+	}
+	return nil
+}
+
+func validateEnvBranches(envBranches map[string]string) error {
+	for env, branch := range envBranches {
+		if env == "" || branch == "" {
+			return fmt.Errorf("envBranches: env and branch must not be empty, got %q: %q", env, branch)
+		}
+	}
+	return nil
+}
+
+// cleanOutputRoot validates the output root, and returns "" for the root of the repo.
+func cleanOutputRoot(outputRoot string) (string, error) {
+	if outputRoot == "" {
+		return "", nil
+	}
+	root := path.Clean(outputRoot)
+	if path.IsAbs(root) || root == ".." || strings.HasPrefix(root, "../") {
+		return "", fmt.Errorf("outputRoot must be a relative path inside the repo, got %q", outputRoot)
+	}
+	if root == "." {
+		root = ""
+	}
+	return root, nil
+}
+
+// matches returns whether the route matches the resources of 'kind' in the account.
+func (r *Route) matches(kind string, act *account.Account) bool {
+	if len(r.CloudProviders) != 0 && !slices.Contains(r.CloudProviders, act.CloudProvider) {
+		return false
+	}
+	if len(r.Kinds) != 0 && !slices.Contains(r.Kinds, kind) {
+		return false
+	}
+	for k, v := range r.AccountTags {
+		if tag, ok := act.Tags[key.Key(k)]; !ok || tag != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Targets returns the downstream repos and branches of the mapping, each with the filter
+// of its slice of the output.
+func (m *Mapping) Targets() []*Target {
+	if len(m.Routes) == 0 && len(m.EnvBranches) == 0 {
+		return []*Target{{Mapping: m}}
+	}
+
+	// route returns the index of the route of a resource, or -1 if none matches.
+	route := func(kind string, act *account.Account) int {
+		for i, r := range m.Routes {
+			if r.matches(kind, act) {
+				return i
+			}
+		}
+		return -1
+	}
+	var targets []*Target
+	// add appends a target per branch that the route sends the envs to.
+	add := func(index int, downstream, targetBranch, outputRoot, title string, envBranches map[string]string, autoMerge *AutoMerge, pushMode, branchPrefix string) {
+		for _, branch := range branchesOf(targetBranch, envBranches) {
+			targets = append(targets, &Target{
+				Mapping: &Mapping{
+					Downstream:   downstream,
+					Label:        m.Label,
+					TargetBranch: branch,
+					OutputRoot:   outputRoot,
+					Title:        title,
+					AutoMerge:    autoMerge,
+					PushMode:     pushMode,
+					BranchPrefix: branchPrefix,
+				},
+				Filter: func(kind, env string, act *account.Account) bool {
+					return route(kind, act) == index && branchOf(env, targetBranch, envBranches) == branch
+				},
+			})
+		}
+	}
+	for i, r := range m.Routes {
+		add(i, r.Downstream, r.TargetBranch, r.OutputRoot, r.Title, r.EnvBranches, r.AutoMerge, r.PushMode, r.BranchPrefix)
+	}
+	if m.Downstream != "" {
+		add(-1, m.Downstream, m.TargetBranch, m.OutputRoot, m.Title, m.EnvBranches, m.AutoMerge, m.PushMode, m.BranchPrefix)
+	}
+	return targets
+}
+
+// branchOf returns the branch that the output of 'env' goes to.
+func branchOf(env, targetBranch string, envBranches map[string]string) string {
+	if branch, ok := envBranches[env]; ok {
+		return branch
+	}
+	return targetBranch
+}
+
+// branchesOf returns the target branch followed by the other branches of the envs, sorted.
+func branchesOf(targetBranch string, envBranches map[string]string) []string {
+	others := sets.New[string]()
+	for _, branch := range envBranches {
+		others.Insert(branch)
+	}
+	others.Delete(targetBranch)
+	return append([]string{targetBranch}, sets.List(others)...)
+}
+
+func isOrgRepo(s string) bool {
+	org, repo, ok := strings.Cut(s, "/")
+	return ok && org != "" && repo != "" && !strings.Contains(repo, "/")
+}
+
+// MappingFor returns the mapping of the upstream repo, or nil if it's not configured.
+func (c *Config) MappingFor(org, repo string) *Mapping {
+	if m, ok := c.Repos[org+"/"+repo]; ok {
+		return m
+	}
+	if m, ok := c.Repos[org]; ok {
+		return m
+	}
+	return c.Default
+}
+
+// Downstreams returns a mapping per downstream repo and push mode of all the mappings, with only
+// Downstream, PushMode and BranchPrefix set, sorted.
+func (c *Config) Downstreams() []*Mapping {
+	type key struct{ downstream, pushMode, branchPrefix string }
+	downstreams := map[key]bool{}
+	add := func(m *Mapping) {
+		if m == nil {
+			return
+		}
+		for _, target := range m.Targets() {
+			downstreams[key{target.Downstream, target.PushMode, target.BranchPrefix}] = true
+		}
+	}
+	for _, m := range c.Repos {
+		add(m)
+	}
+	add(c.Default)
+	var mappings []*Mapping
+	for k := range downstreams {
+		mappings = append(mappings, &Mapping{Downstream: k.downstream, PushMode: k.pushMode, BranchPrefix: k.branchPrefix})
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		a, b := mappings[i], mappings[j]
+		if a.Downstream != b.Downstream {
+			return a.Downstream < b.Downstream
+		}
+		if a.PushMode != b.PushMode {
+			return a.PushMode < b.PushMode
+		}
+		return a.BranchPrefix < b.BranchPrefix
+	})
+	return mappings
+}
+
+// Agent holds the latest valid config and reloads it when the file changes.
+type Agent struct {
+	mu     sync.RWMutex
+	config *Config
+	// data is the content the config was loaded from.
+	data []byte
+
+	fs     afero.Fs
+	path   string
+	logger logr.Logger
+}
+
+// NewAgent loads the config from 'path'. It fails if the config is invalid.
+func NewAgent(fs afero.Fs, path string, logger logr.Logger) (*Agent, error) {
+	a := &Agent{fs: fs, path: path, logger: logger}
+	if _, err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// NewStaticAgent returns an agent that always serves 'config'.
+func NewStaticAgent(config *Config) *Agent {
+	return &Agent{config: config}
+}
+
+// Config returns the latest valid config.
+func (a *Agent) Config() *Config {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.config
+}
+
+// Reload re-reads the config file and reports whether the config changed. An invalid
+// config is rejected, and the previous config is kept.
+func (a *Agent) Reload() (bool, error) {
+	if a.path == "" {
+		return false, nil
+	}
+	data, err := afero.ReadFile(a.fs, a.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", a.path, err)
+	}
+	a.mu.RLock()
+	unchanged := a.config != nil && bytes.Equal(data, a.data)
+	a.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	config, err := parse(a.path, data)
+	if err != nil {
+		return false, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.config, a.data = config, data
+	return true, nil
+}
+
+// Sync reloads the config and logs the outcome. It's meant to be called periodically.
+func (a *Agent) Sync() {
+	changed, err := a.Reload()
+	if err != nil {
+		a.logger.Error(err, "failed to reload the plugin config, keeping the last valid one")
+		return
+	}
+	if changed {
+		a.logger.Info("reloaded the plugin config", "path", a.path)
+	}
+}
@@ -0,0 +1,419 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/afero"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/generator"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/common/selector/key"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/infra/account"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *Config
+		wantErr bool
+	}{
+		{
+			name: "mappings with defaults",
+			content: `repos:
+  foo/infra:
+    downstream: foo/gitops
+    targetBranch: master
+    outputRoot: ./generated/
+    title: Infra codegen
+  bar:
+    downstream: bar/gitops
+    label: codegen
+`,
+			want: &Config{
+				Repos: map[string]*Mapping{
+					"foo/infra": {
+						Downstream:   "foo/gitops",
+						Label:        DefaultLabel,
+						TargetBranch: "master",
+						OutputRoot:   "generated",
+						Title:        "Infra codegen",
+						PushMode:     PushModeFork,
+					},
+					"bar": {
+						Downstream:   "bar/gitops",
+						Label:        "codegen",
+						TargetBranch: DefaultTargetBranch,
+						Title:        DefaultTitle,
+						PushMode:     PushModeFork,
+					},
+				},
+			},
+		},
+		{
+			name:    "empty",
+			content: "repos: {}\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			content: "repos:\n  foo/infra:\n    downstream: foo/gitops\n    branch: main\n",
+			wantErr: true,
+		},
+		{
+			name:    "downstream is not an org/repo",
+			content: "repos:\n  foo/infra:\n    downstream: gitops\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid upstream",
+			content: "repos:\n  foo/infra/sub:\n    downstream: foo/gitops\n",
+			wantErr: true,
+		},
+		{
+			name: "routes inherit the mapping",
+			content: `repos:
+  foo/infra:
+    targetBranch: master
+    routes:
+    - downstream: foo/aws-gitops
+      cloudProviders: [aws]
+    - downstream: foo/gcp-gitops
+      cloudProviders: [gcp]
+      title: GCP codegen
+`,
+			want: &Config{
+				Repos: map[string]*Mapping{
+					"foo/infra": {
+						Label:        DefaultLabel,
+						TargetBranch: "master",
+						Title:        DefaultTitle,
+						PushMode:     PushModeFork,
+						Routes: []*Route{
+							{Downstream: "foo/aws-gitops", TargetBranch: "master", Title: DefaultTitle, PushMode: PushModeFork, CloudProviders: []string{"aws"}},
+							{Downstream: "foo/gcp-gitops", TargetBranch: "master", Title: "GCP codegen", PushMode: PushModeFork, CloudProviders: []string{"gcp"}},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:    "route without matchers",
+			content: "default:\n  downstream: foo/gitops\n  routes:\n  - downstream: foo/aws-gitops\n",
+			wantErr: true,
+		},
+		{
+			name:    "route with an unknown kind",
+			content: "default:\n  downstream: foo/gitops\n  routes:\n  - downstream: foo/aws-gitops\n    kinds: [database]\n",
+			wantErr: true,
+		},
+		{
+			name:    "routes to the same branch",
+			content: "default:\n  downstream: foo/gitops\n  routes:\n  - downstream: foo/gitops\n    kinds: [queue]\n",
+			wantErr: true,
+		},
+		{
+			name: "auto-merge inherited by routes",
+			content: `default:
+  downstream: foo/gitops
+  autoMerge:
+    lowRiskEnvs: [dev]
+  routes:
+  - downstream: foo/aws-gitops
+    cloudProviders: [aws]
+    autoMerge:
+      lowRiskEnvs: [dev, staging]
+      method: rebase
+      approve: true
+  - downstream: foo/gcp-gitops
+    cloudProviders: [gcp]
+`,
+			want: &Config{
+				Default: &Mapping{
+					Downstream:   "foo/gitops",
+					Label:        DefaultLabel,
+					TargetBranch: DefaultTargetBranch,
+					Title:        DefaultTitle,
+					AutoMerge:    &AutoMerge{LowRiskEnvs: []string{"dev"}, Method: DefaultMergeMethod},
+					PushMode:     PushModeFork,
+					Routes: []*Route{
+						{
+							Downstream:     "foo/aws-gitops",
+							TargetBranch:   DefaultTargetBranch,
+							Title:          DefaultTitle,
+							AutoMerge:      &AutoMerge{LowRiskEnvs: []string{"dev", "staging"}, Method: "rebase", Approve: true},
+							PushMode:       PushModeFork,
+							CloudProviders: []string{"aws"},
+						},
+						{
+							Downstream:     "foo/gcp-gitops",
+							TargetBranch:   DefaultTargetBranch,
+							Title:          DefaultTitle,
+							AutoMerge:      &AutoMerge{LowRiskEnvs: []string{"dev"}, Method: DefaultMergeMethod},
+							PushMode:       PushModeFork,
+							CloudProviders: []string{"gcp"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:    "prod as a low-risk env",
+			content: "default:\n  downstream: foo/gitops\n  autoMerge:\n    lowRiskEnvs: [dev, Prod]\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown merge method",
+			content: "default:\n  downstream: foo/gitops\n  autoMerge:\n    lowRiskEnvs: [dev]\n    method: fast-forward\n",
+			wantErr: true,
+		},
+		{
+			name: "direct push mode",
+			content: `default:
+  downstream: foo/gitops
+  pushMode: direct
+  routes:
+  - downstream: foo/aws-gitops
+    cloudProviders: [aws]
+  - downstream: foo/gcp-gitops
+    cloudProviders: [gcp]
+    branchPrefix: bot/
+  - downstream: foo/azure-gitops
+    cloudProviders: [azure]
+    pushMode: fork
+`,
+			want: &Config{
+				Default: &Mapping{
+					Downstream:   "foo/gitops",
+					Label:        DefaultLabel,
+					TargetBranch: DefaultTargetBranch,
+					Title:        DefaultTitle,
+					PushMode:     PushModeDirect,
+					BranchPrefix: DefaultDirectBranchPrefix,
+					Routes: []*Route{
+						{
+							Downstream:     "foo/aws-gitops",
+							TargetBranch:   DefaultTargetBranch,
+							Title:          DefaultTitle,
+							PushMode:       PushModeDirect,
+							BranchPrefix:   DefaultDirectBranchPrefix,
+							CloudProviders: []string{"aws"},
+						},
+						{
+							Downstream:     "foo/gcp-gitops",
+							TargetBranch:   DefaultTargetBranch,
+							Title:          DefaultTitle,
+							PushMode:       PushModeDirect,
+							BranchPrefix:   "bot/",
+							CloudProviders: []string{"gcp"},
+						},
+						{
+							Downstream:     "foo/azure-gitops",
+							TargetBranch:   DefaultTargetBranch,
+							Title:          DefaultTitle,
+							PushMode:       PushModeFork,
+							CloudProviders: []string{"azure"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:    "unknown push mode",
+			content: "default:\n  downstream: foo/gitops\n  pushMode: mirror\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid branch prefix",
+			content: "default:\n  downstream: foo/gitops\n  pushMode: direct\n  branchPrefix: 'code gen/'\n",
+			wantErr: true,
+		},
+		{
+			name:    "output root outside the repo",
+			content: "default:\n  downstream: foo/gitops\n  outputRoot: ../generated\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			if err := afero.WriteFile(fs, "/plugin.yaml", []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Load(fs, "/plugin.yaml")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Load() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConfig_MappingFor(t *testing.T) {
+	repo := &Mapping{Downstream: "foo/repo-gitops"}
+	org := &Mapping{Downstream: "foo/gitops"}
+	def := &Mapping{Downstream: "bar/gitops"}
+	c := &Config{
+		Repos: map[string]*Mapping{
+			"foo/infra": repo,
+			"foo":       org,
+		},
+	}
+	if got := c.MappingFor("foo", "infra"); got != repo {
+		t.Errorf("MappingFor(foo, infra) = %v, want the repo mapping", got)
+	}
+	if got := c.MappingFor("foo", "other"); got != org {
+		t.Errorf("MappingFor(foo, other) = %v, want the org mapping", got)
+	}
+	if got := c.MappingFor("bar", "infra"); got != nil {
+		t.Errorf("MappingFor(bar, infra) = %v, want nil", got)
+	}
+	c.Default = def
+	if got := c.MappingFor("bar", "infra"); got != def {
+		t.Errorf("MappingFor(bar, infra) = %v, want the default mapping", got)
+	}
+}
+
+func TestAgent_Reload(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	write := func(content string) {
+		t.Helper()
+		if err := afero.WriteFile(fs, "/plugin.yaml", []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	downstream := func(a *Agent) string {
+		return a.Config().MappingFor("foo", "infra").Downstream
+	}
+
+	write("default:\n  downstream: foo/gitops\n")
+	agent, err := NewAgent(fs, "/plugin.yaml", logr.Discard())
+	if err != nil {
+		t.Fatalf("NewAgent() error = %v", err)
+	}
+
+	if changed, err := agent.Reload(); err != nil || changed {
+		t.Errorf("Reload() of the same file = (%v, %v), want (false, nil)", changed, err)
+	}
+
+	write("default:\n  downstream: foo/other-gitops\n")
+	if changed, err := agent.Reload(); err != nil || !changed {
+		t.Errorf("Reload() of a new file = (%v, %v), want (true, nil)", changed, err)
+	}
+	if got := downstream(agent); got != "foo/other-gitops" {
+		t.Errorf("downstream = %q after reloading, want %q", got, "foo/other-gitops")
+	}
+
+	// An invalid config keeps the last valid one.
+	write("default:\n  downstream: invalid\n")
+	if _, err := agent.Reload(); err == nil {
+		t.Error("Reload() of an invalid file succeeded, want an error")
+	}
+	if got := downstream(agent); got != "foo/other-gitops" {
+		t.Errorf("downstream = %q after an invalid reload, want %q", got, "foo/other-gitops")
+	}
+
+	// The initial config must be valid.
+	write("default: {}\n")
+	if _, err := NewAgent(fs, "/plugin.yaml", logr.Discard()); err == nil {
+		t.Error("NewAgent() with an invalid file succeeded, want an error")
+	}
+}
+
+func TestMapping_Targets(t *testing.T) {
+	m := &Mapping{
+		Downstream: "foo/gitops",
+		Routes: []*Route{
+			{Downstream: "foo/aws-gitops", CloudProviders: []string{"aws"}, Kinds: []string{generator.KindBucket}},
+			{Downstream: "foo/prod-gitops", AccountTags: map[string]string{"env": "prod"}},
+		},
+	}
+	if err := m.complete(); err != nil {
+		t.Fatalf("complete() error = %v", err)
+	}
+	awsDev := &account.Account{AccountID: "1", CloudProvider: "aws", Tags: map[key.Key]string{key.Env: "dev"}}
+	awsProd := &account.Account{AccountID: "2", CloudProvider: "aws", Tags: map[key.Key]string{key.Env: "prod"}}
+	gcpDev := &account.Account{AccountID: "3", CloudProvider: "gcp", Tags: map[key.Key]string{key.Env: "dev"}}
+
+	// got maps each downstream repo to the "<kind>/<account>" it receives.
+	got := map[string][]string{}
+	for _, target := range m.Targets() {
+		for _, act := range []*account.Account{awsDev, awsProd, gcpDev} {
+			for _, kind := range []string{generator.KindBucket, generator.KindQueue} {
+				if target.Filter(kind, "", act) {
+					got[target.Downstream] = append(got[target.Downstream], kind+"/"+act.AccountID)
+				}
+			}
+		}
+	}
+	want := map[string][]string{
+		"foo/aws-gitops":  {"bucket/1", "bucket/2"},
+		"foo/prod-gitops": {"queue/2"},
+		"foo/gitops":      {"queue/1", "bucket/3", "queue/3"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Targets() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMapping_TargetsWithEnvBranches(t *testing.T) {
+	m := &Mapping{
+		Downstream:  "foo/gitops",
+		EnvBranches: map[string]string{"prod": "prod", "staging": "nonprod", "dev": "nonprod"},
+	}
+	if err := m.complete(); err != nil {
+		t.Fatalf("complete() error = %v", err)
+	}
+	act := &account.Account{AccountID: "1", CloudProvider: "aws"}
+
+	// got maps each target branch to the envs it receives.
+	got := map[string][]string{}
+	for _, target := range m.Targets() {
+		if target.Downstream != "foo/gitops" {
+			t.Errorf("unexpected downstream %q", target.Downstream)
+		}
+		got[target.TargetBranch] = nil
+		for _, env := range []string{"dev", "prod", "sandbox", "staging"} {
+			if target.Filter(generator.KindBucket, env, act) {
+				got[target.TargetBranch] = append(got[target.TargetBranch], env)
+			}
+		}
+	}
+	want := map[string][]string{
+		DefaultTargetBranch: {"sandbox"},
+		"nonprod":           {"dev", "staging"},
+		"prod":              {"prod"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Targets() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestConfig_Downstreams(t *testing.T) {
+	c := &Config{
+		Repos: map[string]*Mapping{
+			"foo/infra": {
+				Downstream: "foo/gitops",
+				Routes:     []*Route{{Downstream: "foo/aws-gitops", CloudProviders: []string{"aws"}}},
+			},
+			"foo":     {Downstream: "foo/gitops"},
+			"foo/app": {Downstream: "foo/gitops", PushMode: PushModeDirect},
+		},
+		Default: &Mapping{Downstream: "bar/gitops"},
+	}
+	if err := c.complete(); err != nil {
+		t.Fatalf("complete() error = %v", err)
+	}
+	want := []*Mapping{
+		{Downstream: "bar/gitops", PushMode: PushModeFork},
+		{Downstream: "foo/aws-gitops", PushMode: PushModeFork},
+		{Downstream: "foo/gitops", PushMode: PushModeDirect, BranchPrefix: DefaultDirectBranchPrefix},
+		{Downstream: "foo/gitops", PushMode: PushModeFork},
+	}
+	if diff := cmp.Diff(want, c.Downstreams()); diff != "" {
+		t.Errorf("Downstreams() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,151 @@
+package cost
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/yaml"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/inventory"
+)
+
+// AnyRegion is the region key of a PriceTable that matches the regions not listed explicitly.
+const AnyRegion = "*"
+
+// PriceTable holds the monthly baseline cost in USD, keyed by cloud provider, region and
+// the kind of the generated object, which is the resource type of the Terraform output, e.g.:
+//
+//	aws:
+//	  us-east-1:
+//	    Bucket: 0.5
+//	    aws_s3_bucket: 0.5
+//	  "*":
+//	    Bucket: 0.6
+type PriceTable map[string]map[string]map[string]float64
+
+// LoadPriceTable loads a PriceTable from the given YAML file.
+func LoadPriceTable(fs afero.Fs, path string) (PriceTable, error) {
+	data, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var table PriceTable
+	if err := yaml.UnmarshalStrict(data, &table); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return table, nil
+}
+
+// Price returns the monthly baseline cost of the object, and whether it's known.
+func (t PriceTable) Price(obj *inventory.Object) (float64, bool) {
+	regions := t[obj.CloudProvider]
+	for _, region := range []string{obj.Region, AnyRegion} {
+		if price, ok := regions[region][obj.Kind]; ok {
+			return price, true
+		}
+	}
+	return 0, false
+}
+
+// Line is the cost of a tenant in an account.
+type Line struct {
+	TenantID string
+	// Account is formatted as "<provider>-<account_id>".
+	Account string
+	Before  float64
+	After   float64
+}
+
+func (l *Line) Delta() float64 {
+	return l.After - l.Before
+}
+
+// Report is the estimated change of the monthly baseline cost.
+type Report struct {
+	// Lines only include the tenants and accounts whose cost changes.
+	Lines []*Line
+	// Unpriced lists the "<provider>/<kind>" of the objects missing in the price table.
+	Unpriced []string
+}
+
+// Estimate compares the objects generated before and after a codegen run.
+func Estimate(table PriceTable, before, after []*inventory.Object) *Report {
+	lines := map[[2]string]*Line{}
+	unpriced := sets.New[string]()
+	add := func(objs []*inventory.Object, field func(*Line) *float64) {
+		for _, obj := range objs {
+			price, ok := table.Price(obj)
+			if !ok {
+				// Objects of the core API group, like ServiceAccounts, are not cloud resources, nor are
+				// the shared objects, like the GitOps Applications.
+				if obj.AccountID != "" && (strings.Contains(obj.APIVersion, ".") || obj.APIVersion == inventory.TerraformAPIVersion) {
+					unpriced.Insert(fmt.Sprintf("%s/%s", obj.CloudProvider, obj.Kind))
+				}
+				continue
+			}
+			key := [2]string{obj.TenantID, obj.Account()}
+			line, ok := lines[key]
+			if !ok {
+				line = &Line{TenantID: obj.TenantID, Account: obj.Account()}
+				lines[key] = line
+			}
+			*field(line) += price
+		}
+	}
+	add(before, func(l *Line) *float64 { return &l.Before })
+	add(after, func(l *Line) *float64 { return &l.After })
+
+	report := &Report{Unpriced: sets.List(unpriced)}
+	for _, line := range lines {
+		if math.Abs(line.Delta()) < 0.005 {
+			continue
+		}
+		report.Lines = append(report.Lines, line)
+	}
+	sort.Slice(report.Lines, func(i, j int) bool {
+		if report.Lines[i].TenantID != report.Lines[j].TenantID {
+			return report.Lines[i].TenantID < report.Lines[j].TenantID
+		}
+		return report.Lines[i].Account < report.Lines[j].Account
+	})
+	return report
+}
+
+// Markdown renders the report for GitHub comments and PR bodies.
+func (r *Report) Markdown() string {
+	var sb strings.Builder
+	sb.WriteString("#### 💰 Estimated monthly baseline cost\n\n")
+	if len(r.Lines) == 0 {
+		sb.WriteString("No change in the monthly baseline cost.\n")
+	} else {
+		var before, after float64
+		sb.WriteString("| Tenant | Account | Before | After | Delta |\n")
+		sb.WriteString("|---|---|---:|---:|---:|\n")
+		for _, line := range r.Lines {
+			before += line.Before
+			after += line.After
+			fmt.Fprintf(&sb, "| %s | %s | %s | %s | %s |\n", line.TenantID, line.Account, usd(line.Before), usd(line.After), signedUSD(line.Delta()))
+		}
+		fmt.Fprintf(&sb, "| **Total** | | %s | %s | **%s** |\n", usd(before), usd(after), signedUSD(after-before))
+	}
+	if len(r.Unpriced) != 0 {
+		fmt.Fprintf(&sb, "\n⚠️ Not priced: %s\n", strings.Join(r.Unpriced, ", "))
+	}
+	sb.WriteString("\n<sub>Estimated offline from the price table. Usage-based charges are not included.</sub>\n")
+	return sb.String()
+}
+
+func usd(v float64) string {
+	return fmt.Sprintf("$%.2f", v)
+}
+
+func signedUSD(v float64) string {
+	if v < 0 {
+		return "-" + usd(-v)
+	}
+	return "+" + usd(v)
+}
@@ -0,0 +1,105 @@
+package cost
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/inventory"
+)
+
+func TestEstimate(t *testing.T) {
+	table := PriceTable{
+		"aws": {
+			"us-east-1": {"Bucket": 0.5, "Queue": 0.4, "aws_s3_bucket": 0.5},
+			AnyRegion:   {"Bucket": 1},
+		},
+		"gcp": {
+			AnyRegion: {"Bucket": 0.25},
+		},
+	}
+	bucket := func(tenant, provider, account, region, name string) *inventory.Object {
+		return &inventory.Object{
+			TenantID:      tenant,
+			CloudProvider: provider,
+			AccountID:     account,
+			Region:        region,
+			APIVersion:    "s3.aws.upbound.io/v1beta1",
+			Kind:          "Bucket",
+			Name:          name,
+		}
+	}
+
+	tests := []struct {
+		name         string
+		before       []*inventory.Object
+		after        []*inventory.Object
+		want         *Report
+		wantMarkdown string
+	}{
+		{
+			name: "no change",
+			before: []*inventory.Object{
+				bucket("tenant-X", "aws", "1234", "us-east-1", "A"),
+			},
+			after: []*inventory.Object{
+				bucket("tenant-X", "aws", "1234", "us-east-1", "A"),
+			},
+			want: &Report{},
+			wantMarkdown: `#### 💰 Estimated monthly baseline cost
+
+No change in the monthly baseline cost.
+
+<sub>Estimated offline from the price table. Usage-based charges are not included.</sub>
+`,
+		},
+		{
+			name: "added and removed resources",
+			before: []*inventory.Object{
+				bucket("tenant-X", "aws", "1234", "us-east-1", "A"),
+				bucket("tenant-Y", "gcp", "senzu-bean", "us-east-1", "A"),
+			},
+			after: []*inventory.Object{
+				bucket("tenant-X", "aws", "1234", "us-east-1", "A"),
+				bucket("tenant-X", "aws", "1234", "us-west-2", "B"),
+				{TenantID: "tenant-X", CloudProvider: "aws", AccountID: "1234", Region: "us-east-1", APIVersion: "sqs.aws.upbound.io/v1beta1", Kind: "Queue"},
+				{TenantID: "tenant-X", CloudProvider: "aws", AccountID: "1234", APIVersion: "iam.aws.upbound.io/v1beta1", Kind: "Role"},
+				{TenantID: "tenant-X", CloudProvider: "aws", AccountID: "1234", APIVersion: "v1", Kind: "ServiceAccount"},
+				{TenantID: "tenant-X", CloudProvider: "aws", AccountID: "1234", Region: "us-east-1", APIVersion: inventory.TerraformAPIVersion, Kind: "aws_s3_bucket"},
+				{TenantID: "tenant-X", CloudProvider: "aws", AccountID: "1234", Region: "us-east-1", APIVersion: inventory.TerraformAPIVersion, Kind: "aws_sqs_queue"},
+			},
+			want: &Report{
+				Lines: []*Line{
+					{TenantID: "tenant-X", Account: "aws-1234", Before: 0.5, After: 2.4},
+					{TenantID: "tenant-Y", Account: "gcp-senzu-bean", Before: 0.25},
+				},
+				Unpriced: []string{"aws/Role", "aws/aws_sqs_queue"},
+			},
+			wantMarkdown: `#### 💰 Estimated monthly baseline cost
+
+| Tenant | Account | Before | After | Delta |
+|---|---|---:|---:|---:|
+| tenant-X | aws-1234 | $0.50 | $2.40 | +$1.90 |
+| tenant-Y | gcp-senzu-bean | $0.25 | $0.00 | -$0.25 |
+| **Total** | | $0.75 | $2.40 | **+$1.65** |
+
+⚠️ Not priced: aws/Role, aws/aws_sqs_queue
+
+<sub>Estimated offline from the price table. Usage-based charges are not included.</sub>
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Estimate(table, tt.before, tt.after)
+			if diff := cmp.Diff(tt.want, got, cmpopts.EquateEmpty(), cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+				t.Errorf("Estimate() unexpected diff (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantMarkdown, got.Markdown()); diff != "" {
+				t.Errorf("Markdown() unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
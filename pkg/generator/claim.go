@@ -0,0 +1,173 @@
+package generator
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/afero"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/internal"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/infra/account"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/tenant/resource"
+)
+
+// PlatformOutputDir holds the XRDs and Compositions that the claims of the
+// "crossplane-claim" backend are served by.
+const PlatformOutputDir = OutputDir + "/platform"
+
+//go:embed templates/platform/*.yaml
+var platformFiles embed.FS
+
+// claimBucket is a bucket bundled in a TenantStorage claim.
+type claimBucket struct {
+	Name string
+	// ExternalName is the name of the bucket in the cloud provider.
+	ExternalName      string
+	BlockPublicAccess bool
+	Versioning        bool
+	Encryption        bool
+}
+
+// claimData is the input of tenantstorage.yaml.tpl.
+type claimData struct {
+	TenantID      string
+	Namespace     string
+	CloudProvider string
+	// Region is the provider-native region.
+	Region  string
+	Buckets []*claimBucket
+}
+
+// claimKey identifies the claim of a tenant in an account and region.
+type claimKey struct {
+	tenantID  string
+	accountID string
+	region    string
+}
+
+// tenantClaims collects the buckets of the tenants into claims, in the order they're added.
+// The env tuples of a tenant share the claims of the accounts they all match, e.g., the
+// accounts without an env tag.
+type tenantClaims struct {
+	claims   map[claimKey]*claimData
+	accounts map[claimKey]*account.Account
+	order    []claimKey
+}
+
+func newTenantClaims() *tenantClaims {
+	return &tenantClaims{
+		claims:   map[claimKey]*claimData{},
+		accounts: map[claimKey]*account.Account{},
+	}
+}
+
+func (tc *tenantClaims) addBucket(tuple *internal.TenantTuple, bucket *resource.Bucket, act *account.Account) {
+	key := claimKey{tenantID: tuple.TenantID, accountID: act.AccountID, region: bucket.Region}
+	claim, ok := tc.claims[key]
+	if !ok {
+		region := bucket.Region
+		if act.CloudProvider == "gcp" {
+			region = toGCPRegion(region)
+		}
+		claim = &claimData{
+			TenantID:      tuple.TenantID,
+			Namespace:     claimNamespace(tuple.TenantID),
+			CloudProvider: act.CloudProvider,
+			Region:        region,
+		}
+		tc.claims[key] = claim
+		tc.accounts[key] = act
+		tc.order = append(tc.order, key)
+	}
+	optOut := tuple.BucketOptOut(bucket.Name)
+	claimed := &claimBucket{
+		Name:              bucket.Name,
+		BlockPublicAccess: !optOut.PublicAccess,
+		Versioning:        !optOut.Versioning,
+		Encryption:        !optOut.Encryption,
+	}
+	// A bucket defined by several env tuples is generated once, like the file of a bucket.
+	for i, b := range claim.Buckets {
+		if b.Name == bucket.Name {
+			claim.Buckets[i] = claimed
+			return
+		}
+	}
+	claim.Buckets = append(claim.Buckets, claimed)
+}
+
+// generateClaims renders a TenantStorage claim per tenant, account and region.
+func (cg *Codegen) generateClaims(tenantsDir string, tc *tenantClaims) error {
+	for _, key := range tc.order {
+		claim, act := tc.claims[key], tc.accounts[key]
+		pathCtx := pathContext{
+			CloudProvider: act.CloudProvider,
+			AccountID:     act.AccountID,
+			RegionName:    key.region,
+		}
+		// Render tenantstorage.yaml.tpl
+		err := cg.writeArtifact(pathCtx, path.Join(tenantsDir, key.tenantID, regionPathTemplate), "storage.yaml", func(namePrefix string) (string, error) {
+			for _, bucket := range claim.Buckets {
+				bucket.ExternalName = fmt.Sprintf("%s-%s", namePrefix, bucket.Name)
+			}
+			out, err := renderClaim(claim)
+			if err != nil {
+				return "", fmt.Errorf("failed to render claim template: %w", err)
+			}
+			return out, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generatePlatformFiles writes the XRD and Compositions of TenantStorage, along with
+// a kustomization.yaml.
+func (cg *Codegen) generatePlatformFiles(dstDir string) error {
+	platformDir := cg.outputDir(dstDir, PlatformOutputDir)
+	if err := cg.fs.MkdirAll(platformDir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", platformDir, err)
+	}
+	entries, err := fs.ReadDir(platformFiles, "templates/platform")
+	if err != nil {
+		return fmt.Errorf("failed to read platform files: %w", err)
+	}
+	var filenames []string
+	for _, entry := range entries {
+		data, err := platformFiles.ReadFile(path.Join("templates/platform", entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read platform file %s: %w", entry.Name(), err)
+		}
+		outputPath := filepath.Join(platformDir, entry.Name())
+		if err := afero.WriteFile(cg.fs, outputPath, data, 0644); err != nil {
+			return fmt.Errorf("failed to write file %s: %w", outputPath, err)
+		}
+		filenames = append(filenames, entry.Name())
+	}
+
+	out, err := renderKustomization("", filenames)
+	if err != nil {
+		return err
+	}
+	outputPath := filepath.Join(platformDir, "kustomization.yaml")
+	if err := afero.WriteFile(cg.fs, outputPath, []byte(out), 0644); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", outputPath, err)
+	}
+	return nil
+}
+
+var invalidNamespaceChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// claimNamespace returns the namespace of the tenant's claims, which is the tenant ID
+// made a valid namespace name.
+func claimNamespace(tenantID string) string {
+	ns := invalidNamespaceChars.ReplaceAllString(strings.ToLower(tenantID), "-")
+	return strings.Trim(ns, "-")
+}
@@ -21,63 +21,187 @@ import (
 )
 
 const (
-	TenantsOutputDir = "_output/tenants"
+	// OutputDir is the root of all the generated artifacts.
+	OutputDir        = "_output"
+	TenantsOutputDir = OutputDir + "/tenants"
+
+	// accountPathTemplate and regionPathTemplate are the templates of output directories, relative to a tenant.
+	accountPathTemplate = "{{.CloudProvider}}-{{.AccountID}}"
+	regionPathTemplate  = accountPathTemplate + "/{{.RegionName}}"
+
+	// KindBucket and KindQueue are the kinds of tenant resources that a Filter selects.
+	// The IAM objects granting access to the buckets are of KindBucket.
+	KindBucket = "bucket"
+	KindQueue  = "queue"
 )
 
+// Filter reports whether the resources of the given kind, of a tenant in 'env', are
+// generated towards the account.
+type Filter func(kind, env string, act *account.Account) bool
+
 type Codegen struct {
-	fs afero.Fs
+	fs              afero.Fs
+	accountSettings map[string]*AccountSettings
+	// providerSettings is keyed by cloud provider.
+	providerSettings map[string]*ProviderSettings
+	// gitOps is nil if the GitOps objects are not generated.
+	gitOps *GitOpsConfig
+	// outputRoot is the directory, relative to the destination, that OutputDir is created in.
+	outputRoot string
+	// filter is nil if all the resources are generated.
+	filter Filter
 }
 
-func NewCodegen() *Codegen {
-	return &Codegen{
+type CodegenOption func(*Codegen)
+
+func NewCodegen(opts ...CodegenOption) *Codegen {
+	cg := &Codegen{
 		fs: afero.NewOsFs(),
 	}
+	for _, opt := range opts {
+		opt(cg)
+	}
+	return cg
+}
+
+// WithFs sets the filesystem that the artifacts are written to.
+func WithFs(fs afero.Fs) CodegenOption {
+	return func(cg *Codegen) {
+		cg.fs = fs
+	}
+}
+
+// WithAccountSettings sets the per-account settings, keyed by account ID.
+func WithAccountSettings(accountSettings map[string]*AccountSettings) CodegenOption {
+	return func(cg *Codegen) {
+		cg.accountSettings = accountSettings
+	}
+}
+
+// WithProviderSettings sets the per-cloud-provider settings.
+func WithProviderSettings(providerSettings map[string]*ProviderSettings) CodegenOption {
+	return func(cg *Codegen) {
+		cg.providerSettings = providerSettings
+	}
+}
+
+// WithGitOps enables generating the GitOps objects of the output tree.
+func WithGitOps(config *GitOpsConfig) CodegenOption {
+	return func(cg *Codegen) {
+		cg.gitOps = config
+	}
+}
+
+// WithOutputRoot generates OutputDir under 'root' instead of the root of the destination.
+func WithOutputRoot(root string) CodegenOption {
+	return func(cg *Codegen) {
+		cg.outputRoot = root
+	}
+}
+
+// WithFilter generates only the resources that 'filter' selects.
+func WithFilter(filter Filter) CodegenOption {
+	return func(cg *Codegen) {
+		cg.filter = filter
+	}
+}
+
+// outputDir returns the path of 'dir', one of the *OutputDir constants, in 'dstDir'.
+func (cg *Codegen) outputDir(dstDir, dir string) string {
+	return path.Join(dstDir, cg.outputRoot, dir)
 }
 
 // FanOutArtifacts render the eventual artifacts based on pre-processed Tenant and Infra tuples.
 func (cg *Codegen) FanOutArtifacts(_ context.Context, dstDir string, accounts []*account.Account, tenantTuples []*internal.TenantTuple) error {
-	tenantsDir := path.Join(dstDir, TenantsOutputDir)
+	tenantsDir := cg.outputDir(dstDir, TenantsOutputDir)
 	// Delete the files that were auto-generated.
 	_ = deleteGeneratedFiles(cg.fs, tenantsDir)
+	_ = deleteGeneratedFiles(cg.fs, cg.outputDir(dstDir, GitOpsOutputDir))
+	_ = deleteGeneratedFiles(cg.fs, cg.outputDir(dstDir, PlatformOutputDir))
 
+	claims := newTenantClaims()
 	for _, tuple := range tenantTuples {
-		if tuple.ResourceConfig == nil {
+		if tuple.ResourceConfig == nil && tuple.Extension == nil {
 			continue
 		}
 
 		// Deal with Buckets.
-		if err := cg.iterateBuckets(tenantsDir, accounts, tuple); err != nil {
+		if err := cg.iterateBuckets(tenantsDir, accounts, tuple, claims); err != nil {
+			return err
+		}
+		// Deal with Queues.
+		if err := cg.iterateQueues(tenantsDir, accounts, tuple); err != nil {
 			return err
 		}
 		// TODO: deal with other fields.
 	}
+	// The claims are written once all the tuples of the tenants are collected.
+	if err := cg.generateClaims(tenantsDir, claims); err != nil {
+		return err
+	}
+
+	// Deal with IAM towards the generated buckets.
+	if err := cg.generateIAM(tenantsDir, accounts, tenantTuples); err != nil {
+		return err
+	}
+
+	// Ship the XRD and Compositions that serve the claims.
+	if cg.anyClaim(accounts, tenantTuples) {
+		if err := cg.generatePlatformFiles(dstDir); err != nil {
+			return err
+		}
+	}
 
 	// Generate kustomization.yaml to include all auto-generated files.
 	if err := generateKustomizationFiles(cg.fs, tenantsDir); err != nil {
 		return err
 	}
 
+	// Wire the generated directories into the GitOps controller.
+	if cg.gitOps != nil {
+		if err := cg.generateGitOps(dstDir); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (cg *Codegen) iterateBuckets(tenantsDir string, accounts []*account.Account, tuple *internal.TenantTuple) error {
+// iterateBuckets renders the buckets of the tuple, except the ones bundled in a claim, which
+// are collected into 'claims'.
+func (cg *Codegen) iterateBuckets(tenantsDir string, accounts []*account.Account, tuple *internal.TenantTuple, claims *tenantClaims) error {
 	if tuple.ResourceConfig == nil {
 		return nil
 	}
 
 	for _, bucket := range tuple.ResourceConfig.Buckets {
-		for _, act := range accounts {
-			// Env is an implicit matching criteria.
-			if !envMatches(act.Tags, tuple) {
+		for _, act := range cg.matchedAccounts(KindBucket, accounts, tuple, bucket.Selector) {
+			// The buckets are bundled into a claim per account and region.
+			if cg.backendOf(act) == BackendCrossplaneClaim {
+				claims.addBucket(tuple, bucket, act)
 				continue
 			}
-			if !selectorMatches(act.Tags, bucket.Selector) {
-				continue
+			// Start rendering the bucket towards the matched account.
+			regionPath := path.Join(tenantsDir, tuple.TenantID, regionPathTemplate)
+			if err := cg.generateBucket(bucket, tuple.BucketOptOut(bucket.Name), act, regionPath); err != nil {
+				return err
 			}
+		}
+	}
 
-			// Start rendering the bucket towards the matched account.
-			regionPath := path.Join(tenantsDir, tuple.TenantID, "{{.CloudProvider}}-{{.AccountID}}/{{.RegionName}}")
-			if err := cg.generateBucket(bucket, act, regionPath); err != nil {
+	return nil
+}
+
+func (cg *Codegen) iterateQueues(tenantsDir string, accounts []*account.Account, tuple *internal.TenantTuple) error {
+	if tuple.Extension == nil {
+		return nil
+	}
+
+	for _, queue := range tuple.Extension.Queues {
+		for _, act := range cg.matchedAccounts(KindQueue, accounts, tuple, queue.Selector) {
+			// Start rendering the queue towards the matched account.
+			regionPath := path.Join(tenantsDir, tuple.TenantID, regionPathTemplate)
+			if err := cg.generateQueue(queue, act, regionPath); err != nil {
 				return err
 			}
 		}
@@ -86,6 +210,54 @@ func (cg *Codegen) iterateBuckets(tenantsDir string, accounts []*account.Account
 	return nil
 }
 
+// MatchedAccounts returns the accounts that a tenant's resource with the given selector fans out to.
+func MatchedAccounts(accounts []*account.Account, tuple *internal.TenantTuple, selector []*selector.Requirment) []*account.Account {
+	var matched []*account.Account
+	for _, act := range accounts {
+		// Env is an implicit matching criteria.
+		if !envMatches(act.Tags, tuple) {
+			continue
+		}
+		if !selectorMatches(act.Tags, selector) {
+			continue
+		}
+		matched = append(matched, act)
+	}
+	return matched
+}
+
+// matchedAccounts is MatchedAccounts restricted to the accounts that the filter selects for 'kind'.
+func (cg *Codegen) matchedAccounts(kind string, accounts []*account.Account, tuple *internal.TenantTuple, selector []*selector.Requirment) []*account.Account {
+	matched := MatchedAccounts(accounts, tuple, selector)
+	if cg.filter == nil {
+		return matched
+	}
+	var filtered []*account.Account
+	for _, act := range matched {
+		if cg.filter(kind, tuple.Env, act) {
+			filtered = append(filtered, act)
+		}
+	}
+	return filtered
+}
+
+// anyClaim returns whether any bucket is generated as a claim.
+func (cg *Codegen) anyClaim(accounts []*account.Account, tenantTuples []*internal.TenantTuple) bool {
+	for _, tuple := range tenantTuples {
+		if tuple.ResourceConfig == nil {
+			continue
+		}
+		for _, bucket := range tuple.ResourceConfig.Buckets {
+			for _, act := range cg.matchedAccounts(KindBucket, accounts, tuple, bucket.Selector) {
+				if cg.backendOf(act) == BackendCrossplaneClaim {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
 func generateKustomizationFiles(fs afero.Fs, dir string) error {
 	return afero.Walk(fs, dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -121,17 +293,10 @@ func generateOneKustomizationFile(fs afero.Fs, dir string) error {
 		return nil
 	}
 
-	// Strip prefix string ends with TenantsOutputDir
-	idx := strings.Index(dir, TenantsOutputDir)
-	if idx == -1 {
-		return fmt.Errorf("[internal error] '%s' doesn't look like a tenant directory", dir)
-	}
-	namePrefix := dir[idx+len(TenantsOutputDir):]
-	// Remove extra leading '/':
-	for len(namePrefix) > 0 && namePrefix[0] == '/' {
-		namePrefix = namePrefix[1:]
+	namePrefix, err := kustomizeNamePrefix(dir)
+	if err != nil {
+		return err
 	}
-	namePrefix = strings.Join(strings.Split(namePrefix, "/"), "-")
 	out, err := renderKustomization(namePrefix, yamlFiles)
 	if err != nil {
 		return err
@@ -145,6 +310,22 @@ func generateOneKustomizationFile(fs afero.Fs, dir string) error {
 	return nil
 }
 
+// kustomizeNamePrefix returns the namePrefix (without the trailing '-') that
+// kustomization.yaml of the given tenant directory applies to its resources.
+func kustomizeNamePrefix(dir string) (string, error) {
+	// Strip prefix string ends with TenantsOutputDir
+	idx := strings.Index(dir, TenantsOutputDir)
+	if idx == -1 {
+		return "", fmt.Errorf("[internal error] '%s' doesn't look like a tenant directory", dir)
+	}
+	namePrefix := dir[idx+len(TenantsOutputDir):]
+	// Remove extra leading '/':
+	for len(namePrefix) > 0 && namePrefix[0] == '/' {
+		namePrefix = namePrefix[1:]
+	}
+	return strings.Join(strings.Split(namePrefix, "/"), "-"), nil
+}
+
 // pathContext represents the context for generating directory paths
 type pathContext struct {
 	CloudProvider string
@@ -155,16 +336,57 @@ type pathContext struct {
 // generateBucket generates a bucket config for a specific account and region
 func (cg *Codegen) generateBucket(
 	bucket *resource.Bucket,
+	optOut *internal.BucketOptOut,
 	account *account.Account,
 	templatePath string,
 ) error {
-	// Generate the directory path using templating
+	if cg.backendOf(account) == BackendTerraform {
+		return cg.generateTerraformBucket(bucket, optOut, account, templatePath)
+	}
 	pathCtx := pathContext{
 		CloudProvider: account.CloudProvider,
 		AccountID:     account.AccountID,
 		RegionName:    bucket.Region,
 	}
+	// Render <provider>-bucket.yaml.tpl
+	return cg.writeArtifact(pathCtx, templatePath, fmt.Sprintf("bucket-%s.yaml", bucket.Name), func(namePrefix string) (string, error) {
+		out, err := renderBucket(bucket, optOut, account, namePrefix)
+		if err != nil {
+			return "", fmt.Errorf("failed to render buckets template: %w", err)
+		}
+		return out, nil
+	})
+}
+
+// generateQueue generates a queue config for a specific account and region
+func (cg *Codegen) generateQueue(
+	queue *internal.Queue,
+	account *account.Account,
+	templatePath string,
+) error {
+	if cg.backendOf(account) == BackendTerraform {
+		return cg.generateTerraformQueue(queue, account, templatePath)
+	}
+	pathCtx := pathContext{
+		CloudProvider: account.CloudProvider,
+		AccountID:     account.AccountID,
+		RegionName:    queue.Region,
+	}
+	// Render <provider>-queue.yaml.tpl
+	return cg.writeArtifact(pathCtx, templatePath, fmt.Sprintf("queue-%s.yaml", queue.Name), func(namePrefix string) (string, error) {
+		out, err := renderQueue(queue, account, namePrefix)
+		if err != nil {
+			return "", fmt.Errorf("failed to render queues template: %w", err)
+		}
+		return out, nil
+	})
+}
 
+// writeArtifact writes the output of 'render' into 'filename', under the directory generated
+// by 'templatePath'. 'render' is given the namePrefix that kustomize applies to the directory,
+// so that the rendered objects can refer to each other.
+func (cg *Codegen) writeArtifact(pathCtx pathContext, templatePath, filename string, render func(namePrefix string) (string, error)) error {
+	// Generate the directory path using templating
 	outputPath, err := cg.generateOutputPath(pathCtx, templatePath)
 	if err != nil {
 		return fmt.Errorf("failed to generate output path: %w", err)
@@ -174,13 +396,16 @@ func (cg *Codegen) generateBucket(
 		return fmt.Errorf("failed to create directory %s: %w", outputPath, err)
 	}
 
-	// Render <provider>-bucket.yaml.tpl
-	out, err := renderBucket(bucket, account)
+	namePrefix, err := kustomizeNamePrefix(outputPath)
 	if err != nil {
-		return fmt.Errorf("failed to render buckets template: %w", err)
+		return err
 	}
-	// Write bucket yaml
-	outputPath = filepath.Join(outputPath, fmt.Sprintf("bucket-%s.yaml", bucket.Name))
+
+	out, err := render(namePrefix)
+	if err != nil {
+		return err
+	}
+	outputPath = filepath.Join(outputPath, filename)
 	if err := afero.WriteFile(cg.fs, outputPath, []byte(out), 0755); err != nil {
 		return fmt.Errorf("failed to write file %s: %w", outputPath, err)
 	}
@@ -284,7 +509,12 @@ func deleteGeneratedFiles(fs afero.Fs, dstDir string) error {
 		if scanner.Scan() {
 			firstLine := scanner.Text()
 			// Check if the first line starts with "# Code generated"
-			if strings.HasPrefix(firstLine, "# Code generated") {
+			generated := strings.HasPrefix(firstLine, "# Code generated")
+			// Or, for .tf.json files, the second line carries the "//" header.
+			if !generated && firstLine == "{" && scanner.Scan() {
+				generated = strings.HasPrefix(strings.TrimSpace(scanner.Text()), `"//": "Code generated`)
+			}
+			if generated {
 				// Delete the file
 				if err := fs.Remove(path); err != nil {
 					return err
@@ -21,6 +21,9 @@ func TestFanOutArtifacts(t *testing.T) {
 	tests := []struct {
 		name             string
 		accounts         []*account.Account
+		accountSettings  map[string]*AccountSettings
+		providerSettings map[string]*ProviderSettings
+		filter           Filter
 		tenantTuples     []*internal.TenantTuple
 		wantFiles        []string
 		wantFileContents map[string]string
@@ -50,6 +53,11 @@ func TestFanOutArtifacts(t *testing.T) {
 							},
 						},
 					},
+					Extension: &internal.Extension{
+						BucketOptOuts: map[string]*internal.BucketOptOut{
+							"B": {PublicAccess: true, Versioning: true, Encryption: true, Reason: "scratch space"},
+						},
+					},
 				},
 			},
 			wantFiles: []string{
@@ -68,6 +76,51 @@ spec:
     region: us-east-1
   providerConfigRef:
     name: default
+---
+apiVersion: s3.aws.upbound.io/v1beta1
+kind: BucketPublicAccessBlock
+metadata:
+  name: A
+spec:
+  forProvider:
+    region: us-east-1
+    bucketRef:
+      name: tenant-X-aws-1234-us-east-1-A
+    blockPublicAcls: true
+    blockPublicPolicy: true
+    ignorePublicAcls: true
+    restrictPublicBuckets: true
+  providerConfigRef:
+    name: default
+---
+apiVersion: s3.aws.upbound.io/v1beta1
+kind: BucketVersioning
+metadata:
+  name: A
+spec:
+  forProvider:
+    region: us-east-1
+    bucketRef:
+      name: tenant-X-aws-1234-us-east-1-A
+    versioningConfiguration:
+    - status: Enabled
+  providerConfigRef:
+    name: default
+---
+apiVersion: s3.aws.upbound.io/v1beta1
+kind: BucketServerSideEncryptionConfiguration
+metadata:
+  name: A
+spec:
+  forProvider:
+    region: us-east-1
+    bucketRef:
+      name: tenant-X-aws-1234-us-east-1-A
+    rule:
+    - applyServerSideEncryptionByDefault:
+      - sseAlgorithm: AES256
+  providerConfigRef:
+    name: default
 `,
 				fmt.Sprintf("/%s/tenant-X/aws-1234/us-east-1/bucket-B.yaml", TenantsOutputDir): `# Code generated by kubecon-pr-generator. DO NOT EDIT.
 apiVersion: s3.aws.upbound.io/v1beta1
@@ -150,6 +203,8 @@ namePrefix: "tenant-X-aws-1234-us-east-1-"
 				},
 			},
 			wantFiles: []string{
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/iam.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/kustomization.yaml", TenantsOutputDir),
 				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/us-east-1/bucket-A.yaml", TenantsOutputDir),
 				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/us-east-1/kustomization.yaml", TenantsOutputDir),
 				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/us-west-1/bucket-B.yaml", TenantsOutputDir),
@@ -160,13 +215,792 @@ namePrefix: "tenant-X-aws-1234-us-east-1-"
 				fmt.Sprintf("/%s/tenant-Y/aws-1234/us-west-1/kustomization.yaml", TenantsOutputDir),
 			},
 		},
+		{
+			name: "terraform backend per provider, overridden per account",
+			accounts: []*account.Account{
+				{
+					AccountID:     "1234",
+					CloudProvider: "aws",
+				},
+				{
+					AccountID:     "5678",
+					CloudProvider: "aws",
+				},
+				{
+					AccountID:     "senzu-bean",
+					CloudProvider: "gcp",
+				},
+			},
+			accountSettings: map[string]*AccountSettings{
+				"5678": {Backend: BackendCrossplane},
+			},
+			providerSettings: map[string]*ProviderSettings{
+				"aws": {Backend: BackendTerraform},
+				"gcp": {Backend: BackendTerraform},
+			},
+			tenantTuples: []*internal.TenantTuple{
+				{
+					TenantID: "tenant-X",
+					ResourceConfig: &resource.ResourceConfig{
+						Buckets: []*resource.Bucket{
+							{
+								Name:   "A",
+								Region: "us-east-1",
+							},
+						},
+					},
+					Extension: &internal.Extension{
+						BucketOptOuts: map[string]*internal.BucketOptOut{
+							"A": {Versioning: true, Reason: "scratch data"},
+						},
+						Queues: []*internal.Queue{
+							{
+								Name:   "Q",
+								Region: "us-west-1",
+								Selector: []*selector.Requirment{
+									{Key: key.CloudProvider, Operator: operator.DoesNotExist},
+								},
+							},
+						},
+					},
+				},
+			},
+			wantFiles: []string{
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-east-1/bucket-A.tf.json", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-east-1/provider.tf.json", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-west-1/provider.tf.json", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-west-1/queue-Q.tf.json", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/aws-5678/us-east-1/bucket-A.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/aws-5678/us-east-1/kustomization.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/aws-5678/us-west-1/kustomization.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/aws-5678/us-west-1/queue-Q.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/us-east-1/bucket-A.tf.json", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/us-east-1/provider.tf.json", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/us-west-1/provider.tf.json", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/us-west-1/queue-Q.tf.json", TenantsOutputDir),
+			},
+			wantFileContents: map[string]string{
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-east-1/provider.tf.json", TenantsOutputDir): `{
+  "//": "Code generated by kubecon-pr-generator. DO NOT EDIT.",
+  "provider": {
+    "aws": [
+      {
+        "alias": "account_1234",
+        "allowed_account_ids": [
+          "1234"
+        ],
+        "region": "us-east-1"
+      }
+    ]
+  },
+  "terraform": {
+    "required_providers": {
+      "aws": {
+        "source": "hashicorp/aws"
+      }
+    }
+  }
+}
+`,
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-east-1/bucket-A.tf.json", TenantsOutputDir): `{
+  "//": "Code generated by kubecon-pr-generator. DO NOT EDIT.",
+  "resource": {
+    "aws_s3_bucket": {
+      "A": {
+        "bucket": "tenant-X-aws-1234-us-east-1-A",
+        "provider": "aws.account_1234"
+      }
+    },
+    "aws_s3_bucket_public_access_block": {
+      "A": {
+        "block_public_acls": true,
+        "block_public_policy": true,
+        "bucket": "${aws_s3_bucket.A.id}",
+        "ignore_public_acls": true,
+        "provider": "aws.account_1234",
+        "restrict_public_buckets": true
+      }
+    },
+    "aws_s3_bucket_server_side_encryption_configuration": {
+      "A": {
+        "bucket": "${aws_s3_bucket.A.id}",
+        "provider": "aws.account_1234",
+        "rule": [
+          {
+            "apply_server_side_encryption_by_default": {
+              "sse_algorithm": "AES256"
+            }
+          }
+        ]
+      }
+    }
+  }
+}
+`,
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/us-east-1/bucket-A.tf.json", TenantsOutputDir): `{
+  "//": "Code generated by kubecon-pr-generator. DO NOT EDIT.",
+  "resource": {
+    "google_storage_bucket": {
+      "A": {
+        "location": "us-east1",
+        "name": "tenant-X-gcp-senzu-bean-us-east-1-A",
+        "provider": "google.account_senzu-bean",
+        "public_access_prevention": "enforced",
+        "uniform_bucket_level_access": true
+      }
+    }
+  }
+}
+`,
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/us-west-1/queue-Q.tf.json", TenantsOutputDir): `{
+  "//": "Code generated by kubecon-pr-generator. DO NOT EDIT.",
+  "resource": {
+    "google_pubsub_subscription": {
+      "Q": {
+        "name": "tenant-X-gcp-senzu-bean-us-west-1-Q",
+        "provider": "google.account_senzu-bean",
+        "topic": "${google_pubsub_topic.Q.id}"
+      }
+    },
+    "google_pubsub_topic": {
+      "Q": {
+        "message_storage_policy": {
+          "allowed_persistence_regions": [
+            "us-west2"
+          ]
+        },
+        "name": "tenant-X-gcp-senzu-bean-us-west-1-Q",
+        "provider": "google.account_senzu-bean"
+      }
+    }
+  }
+}
+`,
+			},
+		},
+		{
+			name: "crossplane claims bundle the buckets per account and region",
+			accounts: []*account.Account{
+				{
+					AccountID:     "1234",
+					CloudProvider: "aws",
+				},
+			},
+			providerSettings: map[string]*ProviderSettings{
+				"aws": {Backend: BackendCrossplaneClaim},
+			},
+			tenantTuples: []*internal.TenantTuple{
+				{
+					TenantID: "tenant-X",
+					ResourceConfig: &resource.ResourceConfig{
+						Buckets: []*resource.Bucket{
+							{
+								Name:   "A",
+								Region: "us-east-1",
+							},
+							{
+								Name:   "B",
+								Region: "us-east-1",
+							},
+							{
+								Name:   "C",
+								Region: "us-west-1",
+							},
+						},
+					},
+					Extension: &internal.Extension{
+						BucketOptOuts: map[string]*internal.BucketOptOut{
+							"B": {PublicAccess: true, Reason: "static website"},
+						},
+					},
+				},
+			},
+			wantFiles: []string{
+				fmt.Sprintf("/%s/composition-tenantstorage-aws.yaml", PlatformOutputDir),
+				fmt.Sprintf("/%s/composition-tenantstorage-gcp.yaml", PlatformOutputDir),
+				fmt.Sprintf("/%s/kustomization.yaml", PlatformOutputDir),
+				fmt.Sprintf("/%s/xrd-tenantstorage.yaml", PlatformOutputDir),
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-east-1/kustomization.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-east-1/storage.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-west-1/kustomization.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-west-1/storage.yaml", TenantsOutputDir),
+			},
+			wantFileContents: map[string]string{
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-east-1/storage.yaml", TenantsOutputDir): `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: storage.codegen.kubecon.io/v1alpha1
+kind: TenantStorage
+metadata:
+  name: storage
+  namespace: tenant-x
+spec:
+  compositionSelector:
+    matchLabels:
+      provider: aws
+  tenantID: tenant-X
+  region: us-east-1
+  buckets:
+  - name: A
+    externalName: tenant-X-aws-1234-us-east-1-A
+    blockPublicAccess: true
+    versioning: true
+    encryption: true
+  - name: B
+    externalName: tenant-X-aws-1234-us-east-1-B
+    blockPublicAccess: false
+    versioning: true
+    encryption: true
+`,
+				fmt.Sprintf("/%s/kustomization.yaml", PlatformOutputDir): `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+resources:
+- composition-tenantstorage-aws.yaml
+- composition-tenantstorage-gcp.yaml
+- xrd-tenantstorage.yaml
+`,
+			},
+		},
+		{
+			name: "crossplane claims merge the env tuples of an untagged account",
+			accounts: []*account.Account{
+				{
+					AccountID:     "1234",
+					CloudProvider: "aws",
+				},
+			},
+			providerSettings: map[string]*ProviderSettings{
+				"aws": {Backend: BackendCrossplaneClaim},
+			},
+			tenantTuples: []*internal.TenantTuple{
+				{
+					TenantID: "tenant-X",
+					Env:      "dev",
+					ResourceConfig: &resource.ResourceConfig{
+						Buckets: []*resource.Bucket{{Name: "A", Region: "us-east-1"}},
+					},
+				},
+				{
+					TenantID: "tenant-X",
+					Env:      "prod",
+					ResourceConfig: &resource.ResourceConfig{
+						Buckets: []*resource.Bucket{{Name: "B", Region: "us-east-1"}},
+					},
+				},
+			},
+			wantFiles: []string{
+				fmt.Sprintf("/%s/composition-tenantstorage-aws.yaml", PlatformOutputDir),
+				fmt.Sprintf("/%s/composition-tenantstorage-gcp.yaml", PlatformOutputDir),
+				fmt.Sprintf("/%s/kustomization.yaml", PlatformOutputDir),
+				fmt.Sprintf("/%s/xrd-tenantstorage.yaml", PlatformOutputDir),
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-east-1/kustomization.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-east-1/storage.yaml", TenantsOutputDir),
+			},
+			wantFileContents: map[string]string{
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-east-1/storage.yaml", TenantsOutputDir): `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: storage.codegen.kubecon.io/v1alpha1
+kind: TenantStorage
+metadata:
+  name: storage
+  namespace: tenant-x
+spec:
+  compositionSelector:
+    matchLabels:
+      provider: aws
+  tenantID: tenant-X
+  region: us-east-1
+  buckets:
+  - name: A
+    externalName: tenant-X-aws-1234-us-east-1-A
+    blockPublicAccess: true
+    versioning: true
+    encryption: true
+  - name: B
+    externalName: tenant-X-aws-1234-us-east-1-B
+    blockPublicAccess: true
+    versioning: true
+    encryption: true
+`,
+			},
+		},
+		{
+			name: "IAM of the buckets composed from claims",
+			accounts: []*account.Account{
+				{
+					AccountID:     "senzu-bean",
+					CloudProvider: "gcp",
+				},
+			},
+			accountSettings: map[string]*AccountSettings{
+				"senzu-bean": {WorkloadIdentityProject: "gke-fleet"},
+			},
+			providerSettings: map[string]*ProviderSettings{
+				"gcp": {Backend: BackendCrossplaneClaim},
+			},
+			tenantTuples: []*internal.TenantTuple{
+				{
+					TenantID: "tenant-X",
+					ResourceConfig: &resource.ResourceConfig{
+						Kubernetes: &resource.Kubernetes{
+							Namespaces: []string{"x1"},
+						},
+						Buckets: []*resource.Bucket{{Name: "A", Region: "us-east-1"}},
+					},
+				},
+			},
+			wantFiles: []string{
+				fmt.Sprintf("/%s/composition-tenantstorage-aws.yaml", PlatformOutputDir),
+				fmt.Sprintf("/%s/composition-tenantstorage-gcp.yaml", PlatformOutputDir),
+				fmt.Sprintf("/%s/kustomization.yaml", PlatformOutputDir),
+				fmt.Sprintf("/%s/xrd-tenantstorage.yaml", PlatformOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/iam.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/k8s/kustomization.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/k8s/serviceaccount.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/kustomization.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/us-east-1/kustomization.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/us-east-1/storage.yaml", TenantsOutputDir),
+			},
+			wantFileContents: map[string]string{
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/iam.yaml", TenantsOutputDir): `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: cloudplatform.gcp.upbound.io/v1beta1
+kind: ServiceAccount
+metadata:
+  name: bucket-access
+  annotations:
+    crossplane.io/external-name: tenant-x-d77f7de3
+spec:
+  forProvider:
+    displayName: Bucket access of tenant tenant-X
+  providerConfigRef:
+    name: default
+---
+apiVersion: storage.gcp.upbound.io/v1beta1
+kind: BucketIAMMember
+metadata:
+  name: bucket-access-us-east-1-A
+spec:
+  forProvider:
+    bucket: tenant-X-gcp-senzu-bean-us-east-1-A
+    role: roles/storage.objectUser
+    member: serviceAccount:tenant-x-d77f7de3@senzu-bean.iam.gserviceaccount.com
+  providerConfigRef:
+    name: default
+---
+apiVersion: cloudplatform.gcp.upbound.io/v1beta1
+kind: ServiceAccountIAMMember
+metadata:
+  name: bucket-access-x1
+spec:
+  forProvider:
+    serviceAccountIdRef:
+      name: tenant-X-gcp-senzu-bean-bucket-access
+    role: roles/iam.workloadIdentityUser
+    member: serviceAccount:gke-fleet.svc.id.goog[x1/tenant-X-gcp-senzu-bean-k8s-bucket-access]
+  providerConfigRef:
+    name: default
+`,
+			},
+		},
+		{
+			name: "queues fan out along with buckets",
+			accounts: []*account.Account{
+				{
+					AccountID:     "1234",
+					CloudProvider: "aws",
+					Tags: map[key.Key]string{
+						key.CloudProvider: "aws",
+						key.Env:           "prod",
+					},
+				},
+				{
+					AccountID:     "senzu-bean",
+					CloudProvider: "gcp",
+					Tags: map[key.Key]string{
+						key.CloudProvider: "gcp",
+						key.Env:           "prod",
+					},
+				},
+			},
+			tenantTuples: []*internal.TenantTuple{
+				{
+					TenantID: "tenant-X",
+					Env:      "prod",
+					ResourceConfig: &resource.ResourceConfig{
+						Buckets: []*resource.Bucket{
+							{
+								Name:   "A",
+								Region: "us-east-1",
+								Selector: []*selector.Requirment{
+									{Key: key.CloudProvider, Operator: operator.In, Values: []string{"aws"}},
+								},
+							},
+						},
+					},
+					Extension: &internal.Extension{
+						Queues: []*internal.Queue{
+							{
+								Name:   "Q",
+								Region: "us-east-1",
+							},
+							{
+								Name:   "R",
+								Region: "us-west-1",
+								Selector: []*selector.Requirment{
+									{Key: key.CloudProvider, Operator: operator.NotIn, Values: []string{"aws"}},
+								},
+							},
+						},
+					},
+				},
+				{
+					TenantID: "tenant-Y",
+					Env:      "dev",
+					Extension: &internal.Extension{
+						Queues: []*internal.Queue{
+							{
+								Name:   "Q",
+								Region: "us-east-1",
+							},
+						},
+					},
+				},
+			},
+			wantFiles: []string{
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-east-1/bucket-A.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-east-1/kustomization.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-east-1/queue-Q.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/us-east-1/kustomization.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/us-east-1/queue-Q.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/us-west-1/kustomization.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/us-west-1/queue-R.yaml", TenantsOutputDir),
+			},
+			wantFileContents: map[string]string{
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-east-1/kustomization.yaml", TenantsOutputDir): `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+resources:
+- bucket-A.yaml
+- queue-Q.yaml
+
+namePrefix: "tenant-X-aws-1234-us-east-1-"
+`,
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/us-west-1/queue-R.yaml", TenantsOutputDir): `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: pubsub.gcp.upbound.io/v1beta1
+kind: Topic
+metadata:
+  name: R
+spec:
+  forProvider:
+    messageStoragePolicy:
+    - allowedPersistenceRegions:
+      - us-west2
+  providerConfigRef:
+    name: default
+---
+apiVersion: pubsub.gcp.upbound.io/v1beta1
+kind: Subscription
+metadata:
+  name: R
+spec:
+  forProvider:
+    topicRef:
+      name: tenant-X-gcp-senzu-bean-us-west-1-R
+  providerConfigRef:
+    name: default
+`,
+			},
+		},
+		{
+			name: "filter selects the resources per kind and account",
+			accounts: []*account.Account{
+				{AccountID: "1234", CloudProvider: "aws", Tags: map[key.Key]string{key.Env: "prod"}},
+				{AccountID: "senzu-bean", CloudProvider: "gcp", Tags: map[key.Key]string{key.Env: "prod"}},
+			},
+			filter: func(kind, _ string, act *account.Account) bool {
+				return kind == KindBucket && act.CloudProvider == "aws" || kind == KindQueue && act.CloudProvider == "gcp"
+			},
+			tenantTuples: []*internal.TenantTuple{
+				{
+					TenantID: "tenant-X",
+					Env:      "prod",
+					ResourceConfig: &resource.ResourceConfig{
+						Buckets: []*resource.Bucket{
+							{Name: "A", Region: "us-east-1"},
+						},
+					},
+					Extension: &internal.Extension{
+						Queues: []*internal.Queue{
+							{Name: "Q", Region: "us-east-1"},
+						},
+					},
+				},
+			},
+			wantFiles: []string{
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-east-1/bucket-A.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-east-1/kustomization.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/us-east-1/kustomization.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/us-east-1/queue-Q.yaml", TenantsOutputDir),
+			},
+		},
+		{
+			name: "IAM and workload identity per tenant and account",
+			accounts: []*account.Account{
+				{
+					AccountID:     "1234",
+					CloudProvider: "aws",
+					Tags: map[key.Key]string{
+						key.Env: "prod",
+					},
+				},
+				{
+					AccountID:     "senzu-bean",
+					CloudProvider: "gcp",
+					Tags: map[key.Key]string{
+						key.Env: "prod",
+					},
+				},
+			},
+			accountSettings: map[string]*AccountSettings{
+				"1234": {OIDCIssuers: []string{"oidc.eks.us-east-1.amazonaws.com/id/ABCD"}},
+			},
+			tenantTuples: []*internal.TenantTuple{
+				{
+					TenantID: "tenant-X",
+					Env:      "prod",
+					ResourceConfig: &resource.ResourceConfig{
+						Kubernetes: &resource.Kubernetes{
+							Namespaces: []string{"x1", "x2"},
+						},
+						Buckets: []*resource.Bucket{
+							{
+								Name:   "A",
+								Region: "us-east-1",
+							},
+							{
+								Name:   "B",
+								Region: "us-west-1",
+							},
+						},
+					},
+					Extension: &internal.Extension{
+						RolePrincipals: []string{"arn:aws:iam::1234:role/ci"},
+					},
+				},
+			},
+			wantFiles: []string{
+				fmt.Sprintf("/%s/tenant-X/aws-1234/iam.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/aws-1234/k8s/kustomization.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/aws-1234/k8s/serviceaccount.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/aws-1234/kustomization.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-east-1/bucket-A.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-east-1/kustomization.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-west-1/bucket-B.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/aws-1234/us-west-1/kustomization.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/iam.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/k8s/kustomization.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/k8s/serviceaccount.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/kustomization.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/us-east-1/bucket-A.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/us-east-1/kustomization.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/us-west-1/bucket-B.yaml", TenantsOutputDir),
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/us-west-1/kustomization.yaml", TenantsOutputDir),
+			},
+			wantFileContents: map[string]string{
+				fmt.Sprintf("/%s/tenant-X/aws-1234/iam.yaml", TenantsOutputDir): `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: iam.aws.upbound.io/v1beta1
+kind: Role
+metadata:
+  name: bucket-access
+spec:
+  forProvider:
+    assumeRolePolicy: |
+      {
+        "Version": "2012-10-17",
+        "Statement": [
+          {
+            "Effect": "Allow",
+            "Principal": {
+              "AWS": [
+                "arn:aws:iam::1234:role/ci"
+              ]
+            },
+            "Action": [
+              "sts:AssumeRole"
+            ]
+          },
+          {
+            "Effect": "Allow",
+            "Principal": {
+              "Federated": "arn:aws:iam::1234:oidc-provider/oidc.eks.us-east-1.amazonaws.com/id/ABCD"
+            },
+            "Action": [
+              "sts:AssumeRoleWithWebIdentity"
+            ],
+            "Condition": {
+              "StringEquals": {
+                "oidc.eks.us-east-1.amazonaws.com/id/ABCD:aud": "sts.amazonaws.com",
+                "oidc.eks.us-east-1.amazonaws.com/id/ABCD:sub": [
+                  "system:serviceaccount:x1:tenant-X-aws-1234-k8s-bucket-access",
+                  "system:serviceaccount:x2:tenant-X-aws-1234-k8s-bucket-access"
+                ]
+              }
+            }
+          }
+        ]
+      }
+  providerConfigRef:
+    name: default
+---
+apiVersion: iam.aws.upbound.io/v1beta1
+kind: Policy
+metadata:
+  name: bucket-access
+spec:
+  forProvider:
+    policy: |
+      {
+        "Version": "2012-10-17",
+        "Statement": [
+          {
+            "Effect": "Allow",
+            "Action": [
+              "s3:GetBucketLocation",
+              "s3:ListBucket",
+              "s3:GetObject",
+              "s3:PutObject",
+              "s3:DeleteObject"
+            ],
+            "Resource": [
+              "arn:aws:s3:::tenant-X-aws-1234-us-east-1-A",
+              "arn:aws:s3:::tenant-X-aws-1234-us-east-1-A/*",
+              "arn:aws:s3:::tenant-X-aws-1234-us-west-1-B",
+              "arn:aws:s3:::tenant-X-aws-1234-us-west-1-B/*"
+            ]
+          }
+        ]
+      }
+  providerConfigRef:
+    name: default
+---
+apiVersion: iam.aws.upbound.io/v1beta1
+kind: RolePolicyAttachment
+metadata:
+  name: bucket-access
+spec:
+  forProvider:
+    roleRef:
+      name: tenant-X-aws-1234-bucket-access
+    policyArnRef:
+      name: tenant-X-aws-1234-bucket-access
+  providerConfigRef:
+    name: default
+`,
+				fmt.Sprintf("/%s/tenant-X/aws-1234/k8s/serviceaccount.yaml", TenantsOutputDir): `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: bucket-access
+  namespace: x1
+  annotations:
+    eks.amazonaws.com/role-arn: arn:aws:iam::1234:role/tenant-X-aws-1234-bucket-access
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: bucket-access
+  namespace: x2
+  annotations:
+    eks.amazonaws.com/role-arn: arn:aws:iam::1234:role/tenant-X-aws-1234-bucket-access
+`,
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/iam.yaml", TenantsOutputDir): `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: cloudplatform.gcp.upbound.io/v1beta1
+kind: ServiceAccount
+metadata:
+  name: bucket-access
+  annotations:
+    crossplane.io/external-name: tenant-x-d77f7de3
+spec:
+  forProvider:
+    displayName: Bucket access of tenant tenant-X
+  providerConfigRef:
+    name: default
+---
+apiVersion: storage.gcp.upbound.io/v1beta1
+kind: BucketIAMMember
+metadata:
+  name: bucket-access-us-east-1-A
+spec:
+  forProvider:
+    bucketRef:
+      name: tenant-X-gcp-senzu-bean-us-east-1-A
+    role: roles/storage.objectUser
+    member: serviceAccount:tenant-x-d77f7de3@senzu-bean.iam.gserviceaccount.com
+  providerConfigRef:
+    name: default
+---
+apiVersion: storage.gcp.upbound.io/v1beta1
+kind: BucketIAMMember
+metadata:
+  name: bucket-access-us-west-1-B
+spec:
+  forProvider:
+    bucketRef:
+      name: tenant-X-gcp-senzu-bean-us-west-1-B
+    role: roles/storage.objectUser
+    member: serviceAccount:tenant-x-d77f7de3@senzu-bean.iam.gserviceaccount.com
+  providerConfigRef:
+    name: default
+---
+apiVersion: cloudplatform.gcp.upbound.io/v1beta1
+kind: ServiceAccountIAMMember
+metadata:
+  name: bucket-access-x1
+spec:
+  forProvider:
+    serviceAccountIdRef:
+      name: tenant-X-gcp-senzu-bean-bucket-access
+    role: roles/iam.workloadIdentityUser
+    member: serviceAccount:senzu-bean.svc.id.goog[x1/tenant-X-gcp-senzu-bean-k8s-bucket-access]
+  providerConfigRef:
+    name: default
+---
+apiVersion: cloudplatform.gcp.upbound.io/v1beta1
+kind: ServiceAccountIAMMember
+metadata:
+  name: bucket-access-x2
+spec:
+  forProvider:
+    serviceAccountIdRef:
+      name: tenant-X-gcp-senzu-bean-bucket-access
+    role: roles/iam.workloadIdentityUser
+    member: serviceAccount:senzu-bean.svc.id.goog[x2/tenant-X-gcp-senzu-bean-k8s-bucket-access]
+  providerConfigRef:
+    name: default
+`,
+				fmt.Sprintf("/%s/tenant-X/gcp-senzu-bean/k8s/serviceaccount.yaml", TenantsOutputDir): `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: bucket-access
+  namespace: x1
+  annotations:
+    iam.gke.io/gcp-service-account: tenant-x-d77f7de3@senzu-bean.iam.gserviceaccount.com
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: bucket-access
+  namespace: x2
+  annotations:
+    iam.gke.io/gcp-service-account: tenant-x-d77f7de3@senzu-bean.iam.gserviceaccount.com
+`,
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			fs := afero.NewMemMapFs()
 			cg := &Codegen{
-				fs: fs,
+				fs:               fs,
+				accountSettings:  tt.accountSettings,
+				providerSettings: tt.providerSettings,
+				filter:           tt.filter,
 			}
 			if err := cg.FanOutArtifacts(context.Background(), "/", tt.accounts, tt.tenantTuples); (err != nil) != tt.wantErr {
 				t.Errorf("FanOutArtifacts() error = %v, wantErr %v", err, tt.wantErr)
@@ -0,0 +1,221 @@
+package generator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	GitOpsOutputDir = OutputDir + "/gitops"
+
+	GitOpsFlavorArgoCD = "argocd"
+	GitOpsFlavorFlux   = "flux"
+
+	// GitOpsGranularityLeaf generates an object per generated leaf directory.
+	GitOpsGranularityLeaf = "leaf"
+	// GitOpsGranularityAccount generates an object (or a file, for Flux) per tenant and account.
+	GitOpsGranularityAccount = "account"
+)
+
+// GitOpsConfig configures the GitOps objects that wire the output tree into a
+// GitOps controller.
+type GitOpsConfig struct {
+	// Flavor is either "argocd" or "flux".
+	Flavor string `json:"flavor"`
+	// Granularity is either "leaf" (default) or "account".
+	Granularity string `json:"granularity,omitempty"`
+	// Namespace is where the GitOps objects live. Defaults to "argocd" or "flux-system".
+	Namespace string `json:"namespace,omitempty"`
+
+	// RepoURL is the URL of the downstream repo. Argo CD only.
+	RepoURL string `json:"repoURL,omitempty"`
+	// Revision is the branch or tag to sync. Defaults to "HEAD". Argo CD only.
+	Revision string `json:"revision,omitempty"`
+	// Project is the Argo CD project. Defaults to "default". Argo CD only.
+	Project string `json:"project,omitempty"`
+
+	// SourceRef is the name of the GitRepository of the downstream repo.
+	// Defaults to "flux-system". Flux only.
+	SourceRef string `json:"sourceRef,omitempty"`
+}
+
+// LoadGitOpsConfig loads the GitOps config from the given YAML file.
+func LoadGitOpsConfig(fs afero.Fs, path string) (*GitOpsConfig, error) {
+	data, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var config GitOpsConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := config.complete(); err != nil {
+		return nil, fmt.Errorf("invalid GitOps config %s: %w", path, err)
+	}
+	return &config, nil
+}
+
+// complete validates the config and fills in the defaults.
+func (c *GitOpsConfig) complete() error {
+	if c.Granularity == "" {
+		c.Granularity = GitOpsGranularityLeaf
+	}
+	if c.Granularity != GitOpsGranularityLeaf && c.Granularity != GitOpsGranularityAccount {
+		return fmt.Errorf("unsupported granularity: %q", c.Granularity)
+	}
+	switch c.Flavor {
+	case GitOpsFlavorArgoCD:
+		if c.RepoURL == "" {
+			return fmt.Errorf("repoURL is required by %s", c.Flavor)
+		}
+		if c.Namespace == "" {
+			c.Namespace = "argocd"
+		}
+		if c.Revision == "" {
+			c.Revision = "HEAD"
+		}
+		if c.Project == "" {
+			c.Project = "default"
+		}
+	case GitOpsFlavorFlux:
+		if c.Namespace == "" {
+			c.Namespace = "flux-system"
+		}
+		if c.SourceRef == "" {
+			c.SourceRef = "flux-system"
+		}
+	default:
+		return fmt.Errorf("unsupported flavor: %q", c.Flavor)
+	}
+	return nil
+}
+
+// gitOpsTarget is a generated directory to be synced to a cluster.
+type gitOpsTarget struct {
+	// Name is the kustomize namePrefix of the directory, which is unique in the output tree.
+	Name string
+	// Path is relative to the root of the downstream repo.
+	Path    string
+	Cluster string
+}
+
+// gitOpsData is the input of the gitops templates.
+type gitOpsData struct {
+	*GitOpsConfig
+	// Name is the name of the ApplicationSet.
+	Name    string
+	Targets []*gitOpsTarget
+}
+
+// generateGitOps generates a GitOps object for each directory of the output tree that has
+// a kustomization.yaml. The objects are re-generated from scratch on each run, so they
+// follow the directories as they appear and disappear.
+func (cg *Codegen) generateGitOps(dstDir string) error {
+	tenantsDir := cg.outputDir(dstDir, TenantsOutputDir)
+	exists, err := afero.DirExists(cg.fs, tenantsDir)
+	if err != nil {
+		return fmt.Errorf("failed to check if directory exists %s: %w", tenantsDir, err)
+	}
+	if !exists {
+		return nil
+	}
+
+	// Group the targets by the file they're rendered into.
+	groups := map[string][]*gitOpsTarget{}
+	err = afero.Walk(cg.fs, tenantsDir, func(dir string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if ok, err := afero.Exists(cg.fs, filepath.Join(dir, "kustomization.yaml")); err != nil || !ok {
+			return err
+		}
+
+		relPath, err := filepath.Rel(dstDir, dir)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path: %w", err)
+		}
+		tenantPath, err := filepath.Rel(tenantsDir, dir)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path: %w", err)
+		}
+		relPath = filepath.ToSlash(relPath)
+		// Expected structure: <tenant_id>/<provider>-<account_id>[/<region>|/k8s]
+		pathParts := strings.Split(filepath.ToSlash(tenantPath), "/")
+		if len(pathParts) < 2 {
+			return nil
+		}
+		_, accountID, _ := strings.Cut(pathParts[1], "-")
+
+		name, err := kustomizeNamePrefix(dir)
+		if err != nil {
+			return err
+		}
+		target := &gitOpsTarget{
+			Name:    name,
+			Path:    relPath,
+			Cluster: cg.settingsOf(accountID).Cluster,
+		}
+		if len(pathParts) > 2 && pathParts[2] == K8sDirName && cg.settingsOf(accountID).WorkloadCluster != "" {
+			target.Cluster = cg.settingsOf(accountID).WorkloadCluster
+		}
+		if target.Cluster == "" && cg.gitOps.Flavor == GitOpsFlavorArgoCD {
+			target.Cluster = "in-cluster"
+		}
+
+		group := name
+		if cg.gitOps.Granularity == GitOpsGranularityAccount {
+			// Named after the account directory, like the objects of its kustomization.
+			group, err = kustomizeNamePrefix(filepath.Join(tenantsDir, pathParts[0], pathParts[1]))
+			if err != nil {
+				return err
+			}
+		}
+		groups[group] = append(groups[group], target)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to walk directory tree: %w", err)
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+
+	gitOpsDir := cg.outputDir(dstDir, GitOpsOutputDir)
+	if err := cg.fs.MkdirAll(gitOpsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", gitOpsDir, err)
+	}
+	var filenames []string
+	for name, targets := range groups {
+		out, err := renderGitOps(&gitOpsData{GitOpsConfig: cg.gitOps, Name: name, Targets: targets})
+		if err != nil {
+			return fmt.Errorf("failed to render gitops template: %w", err)
+		}
+		filename := name + ".yaml"
+		outputPath := filepath.Join(gitOpsDir, filename)
+		if err := afero.WriteFile(cg.fs, outputPath, []byte(out), 0644); err != nil {
+			return fmt.Errorf("failed to write file %s: %w", outputPath, err)
+		}
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	// The GitOps objects are not prefixed, as their names are already unique.
+	out, err := renderKustomization("", filenames)
+	if err != nil {
+		return err
+	}
+	outputPath := filepath.Join(gitOpsDir, "kustomization.yaml")
+	if err := afero.WriteFile(cg.fs, outputPath, []byte(out), 0644); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", outputPath, err)
+	}
+	return nil
+}
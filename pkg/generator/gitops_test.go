@@ -0,0 +1,383 @@
+package generator
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/afero"
+)
+
+func TestLoadGitOpsConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *GitOpsConfig
+		wantErr bool
+	}{
+		{
+			name:    "argocd with defaults",
+			content: "flavor: argocd\nrepoURL: https://github.com/foo/bar\n",
+			want: &GitOpsConfig{
+				Flavor:      GitOpsFlavorArgoCD,
+				Granularity: GitOpsGranularityLeaf,
+				Namespace:   "argocd",
+				RepoURL:     "https://github.com/foo/bar",
+				Revision:    "HEAD",
+				Project:     "default",
+			},
+		},
+		{
+			name:    "flux with defaults",
+			content: "flavor: flux\ngranularity: account\n",
+			want: &GitOpsConfig{
+				Flavor:      GitOpsFlavorFlux,
+				Granularity: GitOpsGranularityAccount,
+				Namespace:   "flux-system",
+				SourceRef:   "flux-system",
+			},
+		},
+		{
+			name:    "argocd without repoURL",
+			content: "flavor: argocd\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown flavor",
+			content: "flavor: spinnaker\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown granularity",
+			content: "flavor: flux\ngranularity: region\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			if err := afero.WriteFile(fs, "/gitops.yaml", []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := LoadGitOpsConfig(fs, "/gitops.yaml")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadGitOpsConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("LoadGitOpsConfig() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_generateGitOps(t *testing.T) {
+	// The output tree generated by FanOutArtifacts.
+	leaves := []string{
+		"/_output/tenants/tenant-X/aws-1234",
+		"/_output/tenants/tenant-X/aws-1234/k8s",
+		"/_output/tenants/tenant-X/aws-1234/us-east-1",
+		"/_output/tenants/tenant-X/gcp-abcd/us-west-1",
+	}
+	accountSettings := map[string]*AccountSettings{
+		"1234": {Cluster: "mgmt-aws", WorkloadCluster: "workload-aws"},
+	}
+
+	tests := []struct {
+		name             string
+		config           *GitOpsConfig
+		wantFiles        []string
+		wantFileContents map[string]string
+	}{
+		{
+			name: "argocd application per leaf",
+			config: &GitOpsConfig{
+				Flavor:      GitOpsFlavorArgoCD,
+				Granularity: GitOpsGranularityLeaf,
+				Namespace:   "argocd",
+				RepoURL:     "https://github.com/foo/bar",
+				Revision:    "HEAD",
+				Project:     "default",
+			},
+			wantFiles: []string{
+				"/_output/gitops/kustomization.yaml",
+				"/_output/gitops/tenant-X-aws-1234-k8s.yaml",
+				"/_output/gitops/tenant-X-aws-1234-us-east-1.yaml",
+				"/_output/gitops/tenant-X-aws-1234.yaml",
+				"/_output/gitops/tenant-X-gcp-abcd-us-west-1.yaml",
+			},
+			wantFileContents: map[string]string{
+				"/_output/gitops/kustomization.yaml": `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+resources:
+- tenant-X-aws-1234-k8s.yaml
+- tenant-X-aws-1234-us-east-1.yaml
+- tenant-X-aws-1234.yaml
+- tenant-X-gcp-abcd-us-west-1.yaml
+`,
+				"/_output/gitops/tenant-X-aws-1234-k8s.yaml": `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: tenant-X-aws-1234-k8s
+  namespace: argocd
+  finalizers:
+  - resources-finalizer.argocd.argoproj.io
+spec:
+  project: default
+  source:
+    repoURL: https://github.com/foo/bar
+    targetRevision: HEAD
+    path: _output/tenants/tenant-X/aws-1234/k8s
+  destination:
+    name: workload-aws
+  syncPolicy:
+    automated:
+      prune: true
+      selfHeal: true
+`,
+				"/_output/gitops/tenant-X-gcp-abcd-us-west-1.yaml": `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: tenant-X-gcp-abcd-us-west-1
+  namespace: argocd
+  finalizers:
+  - resources-finalizer.argocd.argoproj.io
+spec:
+  project: default
+  source:
+    repoURL: https://github.com/foo/bar
+    targetRevision: HEAD
+    path: _output/tenants/tenant-X/gcp-abcd/us-west-1
+  destination:
+    name: in-cluster
+  syncPolicy:
+    automated:
+      prune: true
+      selfHeal: true
+`,
+			},
+		},
+		{
+			name: "argocd applicationset per account",
+			config: &GitOpsConfig{
+				Flavor:      GitOpsFlavorArgoCD,
+				Granularity: GitOpsGranularityAccount,
+				Namespace:   "argocd",
+				RepoURL:     "https://github.com/foo/bar",
+				Revision:    "main",
+				Project:     "tenants",
+			},
+			wantFiles: []string{
+				"/_output/gitops/kustomization.yaml",
+				"/_output/gitops/tenant-X-aws-1234.yaml",
+				"/_output/gitops/tenant-X-gcp-abcd.yaml",
+			},
+			wantFileContents: map[string]string{
+				"/_output/gitops/tenant-X-aws-1234.yaml": `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: argoproj.io/v1alpha1
+kind: ApplicationSet
+metadata:
+  name: tenant-X-aws-1234
+  namespace: argocd
+spec:
+  goTemplate: true
+  generators:
+  - list:
+      elements:
+      - name: tenant-X-aws-1234
+        path: _output/tenants/tenant-X/aws-1234
+        cluster: mgmt-aws
+      - name: tenant-X-aws-1234-k8s
+        path: _output/tenants/tenant-X/aws-1234/k8s
+        cluster: workload-aws
+      - name: tenant-X-aws-1234-us-east-1
+        path: _output/tenants/tenant-X/aws-1234/us-east-1
+        cluster: mgmt-aws
+  template:
+    metadata:
+      name: '{{ .name }}'
+      finalizers:
+      - resources-finalizer.argocd.argoproj.io
+    spec:
+      project: tenants
+      source:
+        repoURL: https://github.com/foo/bar
+        targetRevision: main
+        path: '{{ .path }}'
+      destination:
+        name: '{{ .cluster }}'
+      syncPolicy:
+        automated:
+          prune: true
+          selfHeal: true
+`,
+			},
+		},
+		{
+			name: "flux kustomizations per account",
+			config: &GitOpsConfig{
+				Flavor:      GitOpsFlavorFlux,
+				Granularity: GitOpsGranularityAccount,
+				Namespace:   "flux-system",
+				SourceRef:   "downstream",
+			},
+			wantFiles: []string{
+				"/_output/gitops/kustomization.yaml",
+				"/_output/gitops/tenant-X-aws-1234.yaml",
+				"/_output/gitops/tenant-X-gcp-abcd.yaml",
+			},
+			wantFileContents: map[string]string{
+				"/_output/gitops/tenant-X-gcp-abcd.yaml": `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: kustomize.toolkit.fluxcd.io/v1
+kind: Kustomization
+metadata:
+  name: tenant-X-gcp-abcd-us-west-1
+  namespace: flux-system
+spec:
+  interval: 10m
+  path: ./_output/tenants/tenant-X/gcp-abcd/us-west-1
+  prune: true
+  sourceRef:
+    kind: GitRepository
+    name: downstream
+`,
+				"/_output/gitops/tenant-X-aws-1234.yaml": `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: kustomize.toolkit.fluxcd.io/v1
+kind: Kustomization
+metadata:
+  name: tenant-X-aws-1234
+  namespace: flux-system
+spec:
+  interval: 10m
+  path: ./_output/tenants/tenant-X/aws-1234
+  prune: true
+  sourceRef:
+    kind: GitRepository
+    name: downstream
+  kubeConfig:
+    secretRef:
+      name: mgmt-aws
+---
+apiVersion: kustomize.toolkit.fluxcd.io/v1
+kind: Kustomization
+metadata:
+  name: tenant-X-aws-1234-k8s
+  namespace: flux-system
+spec:
+  interval: 10m
+  path: ./_output/tenants/tenant-X/aws-1234/k8s
+  prune: true
+  sourceRef:
+    kind: GitRepository
+    name: downstream
+  kubeConfig:
+    secretRef:
+      name: workload-aws
+---
+apiVersion: kustomize.toolkit.fluxcd.io/v1
+kind: Kustomization
+metadata:
+  name: tenant-X-aws-1234-us-east-1
+  namespace: flux-system
+spec:
+  interval: 10m
+  path: ./_output/tenants/tenant-X/aws-1234/us-east-1
+  prune: true
+  sourceRef:
+    kind: GitRepository
+    name: downstream
+  kubeConfig:
+    secretRef:
+      name: mgmt-aws
+`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			for _, dir := range leaves {
+				if err := afero.WriteFile(fs, dir+"/kustomization.yaml", []byte("resources: []\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cg := &Codegen{
+				fs:              fs,
+				accountSettings: accountSettings,
+				gitOps:          tt.config,
+			}
+			if err := cg.generateGitOps("/"); err != nil {
+				t.Fatalf("generateGitOps() error = %v", err)
+			}
+
+			var gotFiles []string
+			_ = afero.Walk(fs, "/"+GitOpsOutputDir, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if !info.IsDir() {
+					gotFiles = append(gotFiles, path)
+					if info.Mode().Perm() != 0644 {
+						t.Errorf("unexpected mode of %q: %v", path, info.Mode().Perm())
+					}
+				}
+				return nil
+			})
+			if diff := cmp.Diff(tt.wantFiles, gotFiles); diff != "" {
+				t.Fatalf("unexpected diff on files (-want +got):\n%s", diff)
+			}
+			for f, want := range tt.wantFileContents {
+				got, err := afero.ReadFile(fs, f)
+				if err != nil {
+					t.Fatalf("unexpected error reading file %q: %v", f, err)
+				}
+				if diff := cmp.Diff(want, string(got)); diff != "" {
+					t.Errorf("unexpected diff on '%v' (-want +got):\n%s", f, diff)
+				}
+			}
+		})
+	}
+}
+
+func Test_generateGitOpsWithOutputRoot(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, "/infra/_output/tenants/tenant-X/gcp-abcd/us-west-1/kustomization.yaml", []byte("resources: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cg := NewCodegen(
+		WithFs(fs),
+		WithOutputRoot("infra"),
+		WithGitOps(&GitOpsConfig{
+			Flavor:      GitOpsFlavorFlux,
+			Granularity: GitOpsGranularityLeaf,
+			Namespace:   "flux-system",
+			SourceRef:   "downstream",
+		}),
+	)
+	if err := cg.generateGitOps("/"); err != nil {
+		t.Fatalf("generateGitOps() error = %v", err)
+	}
+
+	// The path is relative to the root of the downstream repo.
+	want := `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: kustomize.toolkit.fluxcd.io/v1
+kind: Kustomization
+metadata:
+  name: tenant-X-gcp-abcd-us-west-1
+  namespace: flux-system
+spec:
+  interval: 10m
+  path: ./infra/_output/tenants/tenant-X/gcp-abcd/us-west-1
+  prune: true
+  sourceRef:
+    kind: GitRepository
+    name: downstream
+`
+	got, err := afero.ReadFile(fs, "/infra/_output/gitops/tenant-X-gcp-abcd-us-west-1.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error reading file: %v", err)
+	}
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("unexpected diff (-want +got):\n%s", diff)
+	}
+}
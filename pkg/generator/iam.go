@@ -0,0 +1,339 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/internal"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/infra/account"
+)
+
+const (
+	// iamObjectName is the name of the IAM objects (and Kubernetes service accounts)
+	// before kustomize prefixes it.
+	iamObjectName = "bucket-access"
+	// K8sDirName is the directory, relative to an account directory, which holds
+	// the Kubernetes objects to be applied to the workload clusters.
+	K8sDirName = "k8s"
+)
+
+// tenantAccount identifies the IAM grant of a tenant in an account.
+type tenantAccount struct {
+	tenantID  string
+	accountID string
+}
+
+// iamGrant collects what a tenant's identity is granted in an account.
+type iamGrant struct {
+	tenantID   string
+	account    *account.Account
+	buckets    map[string]*iamBucket
+	namespaces sets.Set[string]
+	// principals are the AWS principals that the tenant allows to assume its role.
+	principals sets.Set[string]
+}
+
+type iamBucket struct {
+	// Name is unique among the buckets of a grant.
+	Name string
+	// RefName is the name of the Bucket object after kustomize's namePrefix is applied,
+	// which is also the name of the bucket in the cloud provider.
+	RefName string
+}
+
+type k8sServiceAccount struct {
+	Namespace string
+	// Name is the name of the ServiceAccount after kustomize's namePrefix is applied.
+	Name string
+}
+
+// iamData is the input of <provider>-iam.yaml.tpl and serviceaccount.yaml.tpl.
+type iamData struct {
+	TenantID  string
+	AccountID string
+	// RefName is the name of the IAM role (AWS) or service account (GCP) after
+	// kustomize's namePrefix is applied.
+	RefName         string
+	Buckets         []*iamBucket
+	ServiceAccounts []*k8sServiceAccount
+
+	// AWS only.
+	TrustPolicy  string
+	AccessPolicy string
+
+	// GCP only.
+	GCPServiceAccountID    string
+	GCPServiceAccountEmail string
+	// WorkloadIdentityPool is the pool of the Kubernetes service accounts, e.g.,
+	// "my-project.svc.id.goog".
+	WorkloadIdentityPool string
+	// Claimed is set if the buckets are composed from a TenantStorage claim, so that they
+	// are referred to by their name in the cloud provider instead of their object.
+	Claimed bool
+
+	// The annotation that binds a Kubernetes service account to the cloud identity.
+	AnnotationKey   string
+	AnnotationValue string
+}
+
+// generateIAM generates an identity per tenant and account, which is granted access to
+// exactly the tenant's buckets in that account. If the tenant has Kubernetes namespaces,
+// the identity is also bound to a Kubernetes service account in each of them.
+// The accounts on the Terraform backend are skipped, as the IAM objects are Crossplane
+// objects. The ones on the Crossplane claim backend refer to the composed buckets by name.
+func (cg *Codegen) generateIAM(tenantsDir string, accounts []*account.Account, tenantTuples []*internal.TenantTuple) error {
+	grants := map[tenantAccount]*iamGrant{}
+	var order []tenantAccount
+
+	for _, tuple := range tenantTuples {
+		if tuple.ResourceConfig == nil {
+			continue
+		}
+		var namespaces []string
+		if tuple.ResourceConfig.Kubernetes != nil {
+			namespaces = tuple.ResourceConfig.Kubernetes.Namespaces
+		}
+		for _, bucket := range tuple.ResourceConfig.Buckets {
+			for _, act := range cg.matchedAccounts(KindBucket, accounts, tuple, bucket.Selector) {
+				if cg.backendOf(act) == BackendTerraform {
+					continue
+				}
+				key := tenantAccount{tenantID: tuple.TenantID, accountID: act.AccountID}
+				grant, ok := grants[key]
+				if !ok {
+					grant = &iamGrant{
+						tenantID:   tuple.TenantID,
+						account:    act,
+						buckets:    map[string]*iamBucket{},
+						namespaces: sets.New[string](),
+						principals: sets.New[string](),
+					}
+					grants[key] = grant
+					order = append(order, key)
+				}
+
+				regionDir, err := cg.generateOutputPath(pathContext{
+					CloudProvider: act.CloudProvider,
+					AccountID:     act.AccountID,
+					RegionName:    bucket.Region,
+				}, path.Join(tenantsDir, tuple.TenantID, regionPathTemplate))
+				if err != nil {
+					return fmt.Errorf("failed to generate output path: %w", err)
+				}
+				namePrefix, err := kustomizeNamePrefix(regionDir)
+				if err != nil {
+					return err
+				}
+				name := fmt.Sprintf("%s-%s", bucket.Region, bucket.Name)
+				grant.buckets[name] = &iamBucket{
+					Name:    name,
+					RefName: fmt.Sprintf("%s-%s", namePrefix, bucket.Name),
+				}
+				grant.namespaces.Insert(namespaces...)
+				if tuple.Extension != nil {
+					grant.principals.Insert(tuple.Extension.RolePrincipals...)
+				}
+			}
+		}
+	}
+
+	for _, key := range order {
+		if err := cg.generateOneIAM(tenantsDir, grants[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cg *Codegen) generateOneIAM(tenantsDir string, grant *iamGrant) error {
+	pathCtx := pathContext{
+		CloudProvider: grant.account.CloudProvider,
+		AccountID:     grant.account.AccountID,
+	}
+	accountDir, err := cg.generateOutputPath(pathCtx, path.Join(tenantsDir, grant.tenantID, accountPathTemplate))
+	if err != nil {
+		return fmt.Errorf("failed to generate output path: %w", err)
+	}
+	namePrefix, err := kustomizeNamePrefix(accountDir)
+	if err != nil {
+		return err
+	}
+	k8sDir := path.Join(accountDir, K8sDirName)
+	k8sNamePrefix, err := kustomizeNamePrefix(k8sDir)
+	if err != nil {
+		return err
+	}
+
+	data := &iamData{
+		TenantID:  grant.tenantID,
+		AccountID: grant.account.AccountID,
+		RefName:   fmt.Sprintf("%s-%s", namePrefix, iamObjectName),
+		Claimed:   cg.backendOf(grant.account) == BackendCrossplaneClaim,
+	}
+	for _, name := range sets.List(sets.KeySet(grant.buckets)) {
+		data.Buckets = append(data.Buckets, grant.buckets[name])
+	}
+	for _, ns := range sets.List(grant.namespaces) {
+		data.ServiceAccounts = append(data.ServiceAccounts, &k8sServiceAccount{
+			Namespace: ns,
+			Name:      fmt.Sprintf("%s-%s", k8sNamePrefix, iamObjectName),
+		})
+	}
+
+	switch grant.account.CloudProvider {
+	case "aws":
+		issuers := cg.settingsOf(grant.account.AccountID).OIDCIssuers
+		// IRSA can't be set up without knowing the OIDC issuers of the clusters.
+		if len(issuers) == 0 {
+			data.ServiceAccounts = nil
+		}
+		if data.TrustPolicy, err = awsTrustPolicy(grant.account.AccountID, sets.List(grant.principals), issuers, data.ServiceAccounts); err != nil {
+			return err
+		}
+		// A role that nobody may assume isn't generated.
+		if data.TrustPolicy == "" {
+			return nil
+		}
+		if data.AccessPolicy, err = awsAccessPolicy(data.Buckets); err != nil {
+			return err
+		}
+		data.AnnotationKey = "eks.amazonaws.com/role-arn"
+		data.AnnotationValue = fmt.Sprintf("arn:aws:iam::%s:role/%s", grant.account.AccountID, data.RefName)
+	case "gcp":
+		data.GCPServiceAccountID = gcpServiceAccountID(grant.tenantID, grant.account.AccountID)
+		data.GCPServiceAccountEmail = fmt.Sprintf("%s@%s.iam.gserviceaccount.com", data.GCPServiceAccountID, grant.account.AccountID)
+		project := cg.settingsOf(grant.account.AccountID).WorkloadIdentityProject
+		if project == "" {
+			project = grant.account.AccountID
+		}
+		data.WorkloadIdentityPool = project + ".svc.id.goog"
+		data.AnnotationKey = "iam.gke.io/gcp-service-account"
+		data.AnnotationValue = data.GCPServiceAccountEmail
+	}
+
+	// Render <provider>-iam.yaml.tpl
+	if err := cg.writeArtifact(pathCtx, accountDir, "iam.yaml", func(string) (string, error) {
+		out, err := renderIAM(data, grant.account)
+		if err != nil {
+			return "", fmt.Errorf("failed to render iam template: %w", err)
+		}
+		return out, nil
+	}); err != nil {
+		return err
+	}
+
+	if len(data.ServiceAccounts) == 0 {
+		return nil
+	}
+	// Render serviceaccount.yaml.tpl
+	return cg.writeArtifact(pathCtx, k8sDir, "serviceaccount.yaml", func(string) (string, error) {
+		out, err := renderServiceAccounts(data)
+		if err != nil {
+			return "", fmt.Errorf("failed to render serviceaccount template: %w", err)
+		}
+		return out, nil
+	})
+}
+
+type policyDocument struct {
+	Version   string             `json:"Version"`
+	Statement []*policyStatement `json:"Statement"`
+}
+
+type policyStatement struct {
+	Effect    string                    `json:"Effect"`
+	Principal map[string]any            `json:"Principal,omitempty"`
+	Action    []string                  `json:"Action"`
+	Resource  []string                  `json:"Resource,omitempty"`
+	Condition map[string]map[string]any `json:"Condition,omitempty"`
+}
+
+// awsTrustPolicy allows the principals configured by the tenant, and the given service accounts
+// via IRSA, to assume the role. It returns "" if nobody may assume the role.
+func awsTrustPolicy(accountID string, principals, issuers []string, serviceAccounts []*k8sServiceAccount) (string, error) {
+	doc := &policyDocument{Version: "2012-10-17"}
+	if len(principals) != 0 {
+		doc.Statement = append(doc.Statement, &policyStatement{
+			Effect:    "Allow",
+			Principal: map[string]any{"AWS": principals},
+			Action:    []string{"sts:AssumeRole"},
+		})
+	}
+	if len(serviceAccounts) != 0 {
+		var subjects []string
+		for _, sa := range serviceAccounts {
+			subjects = append(subjects, fmt.Sprintf("system:serviceaccount:%s:%s", sa.Namespace, sa.Name))
+		}
+		for _, issuer := range issuers {
+			doc.Statement = append(doc.Statement, &policyStatement{
+				Effect:    "Allow",
+				Principal: map[string]any{"Federated": fmt.Sprintf("arn:aws:iam::%s:oidc-provider/%s", accountID, issuer)},
+				Action:    []string{"sts:AssumeRoleWithWebIdentity"},
+				Condition: map[string]map[string]any{
+					"StringEquals": {
+						issuer + ":aud": "sts.amazonaws.com",
+						issuer + ":sub": subjects,
+					},
+				},
+			})
+		}
+	}
+	if len(doc.Statement) == 0 {
+		return "", nil
+	}
+	return marshalPolicy(doc)
+}
+
+// awsAccessPolicy grants read and write access to the given buckets.
+func awsAccessPolicy(buckets []*iamBucket) (string, error) {
+	var resources []string
+	for _, bucket := range buckets {
+		resources = append(resources, "arn:aws:s3:::"+bucket.RefName, "arn:aws:s3:::"+bucket.RefName+"/*")
+	}
+	return marshalPolicy(&policyDocument{
+		Version: "2012-10-17",
+		Statement: []*policyStatement{
+			{
+				Effect:   "Allow",
+				Action:   []string{"s3:GetBucketLocation", "s3:ListBucket", "s3:GetObject", "s3:PutObject", "s3:DeleteObject"},
+				Resource: resources,
+			},
+		},
+	})
+}
+
+func marshalPolicy(doc *policyDocument) (string, error) {
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal policy: %w", err)
+	}
+	return string(out), nil
+}
+
+var invalidGCPServiceAccountChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// gcpServiceAccountID returns a stable ID for the tenant's service account in a project.
+// GCP requires it to be 6-30 characters of [a-z0-9-] that starts with a letter, so it's
+// made of a readable tenant part and a hash that keeps it unique.
+func gcpServiceAccountID(tenantID, projectID string) string {
+	sum := sha256.Sum256([]byte(tenantID + "/" + projectID))
+	readable := invalidGCPServiceAccountChars.ReplaceAllString(strings.ToLower(tenantID), "-")
+	readable = strings.Trim(readable, "-")
+	if len(readable) > 21 {
+		readable = strings.TrimRight(readable[:21], "-")
+	}
+	if readable == "" || readable[0] < 'a' || readable[0] > 'z' {
+		readable = "t" + readable
+		if len(readable) > 21 {
+			readable = readable[:21]
+		}
+	}
+	return fmt.Sprintf("%s-%s", readable, hex.EncodeToString(sum[:])[:8])
+}
@@ -0,0 +1,312 @@
+package generator
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/infra/account"
+)
+
+func Test_gcpServiceAccountID(t *testing.T) {
+	validID := regexp.MustCompile(`^[a-z][a-z0-9-]{4,28}[a-z0-9]$`)
+
+	tests := []struct {
+		name      string
+		tenantID  string
+		projectID string
+		want      string
+	}{
+		{
+			name:      "short tenant",
+			tenantID:  "tenant-X",
+			projectID: "senzu-bean",
+			want:      "tenant-x-d77f7de3",
+		},
+		{
+			name:      "long tenant is truncated",
+			tenantID:  "a-very-long-tenant-name-that-overflows",
+			projectID: "senzu-bean",
+		},
+		{
+			name:      "tenant starting with a digit",
+			tenantID:  "42_tenant",
+			projectID: "senzu-bean",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := gcpServiceAccountID(tt.tenantID, tt.projectID)
+			if !validID.MatchString(got) {
+				t.Errorf("gcpServiceAccountID() = %q, which is not a valid GCP service account ID", got)
+			}
+			if tt.want != "" && got != tt.want {
+				t.Errorf("gcpServiceAccountID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_awsTrustPolicy(t *testing.T) {
+	serviceAccounts := []*k8sServiceAccount{{Namespace: "x1", Name: "tenant-X-aws-1234-k8s-bucket-access"}}
+	tests := []struct {
+		name            string
+		principals      []string
+		issuers         []string
+		serviceAccounts []*k8sServiceAccount
+		want            string
+	}{
+		{
+			name:            "nobody may assume the role",
+			serviceAccounts: serviceAccounts,
+		},
+		{
+			name:       "principals configured by the tenant",
+			principals: []string{"arn:aws:iam::1234:role/ci"},
+			want: `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Effect": "Allow",
+      "Principal": {
+        "AWS": [
+          "arn:aws:iam::1234:role/ci"
+        ]
+      },
+      "Action": [
+        "sts:AssumeRole"
+      ]
+    }
+  ]
+}`,
+		},
+		{
+			name:            "service accounts via IRSA",
+			issuers:         []string{"oidc.eks.us-east-1.amazonaws.com/id/ABCD"},
+			serviceAccounts: serviceAccounts,
+			want: `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Effect": "Allow",
+      "Principal": {
+        "Federated": "arn:aws:iam::1234:oidc-provider/oidc.eks.us-east-1.amazonaws.com/id/ABCD"
+      },
+      "Action": [
+        "sts:AssumeRoleWithWebIdentity"
+      ],
+      "Condition": {
+        "StringEquals": {
+          "oidc.eks.us-east-1.amazonaws.com/id/ABCD:aud": "sts.amazonaws.com",
+          "oidc.eks.us-east-1.amazonaws.com/id/ABCD:sub": [
+            "system:serviceaccount:x1:tenant-X-aws-1234-k8s-bucket-access"
+          ]
+        }
+      }
+    }
+  ]
+}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := awsTrustPolicy("1234", tt.principals, tt.issuers, tt.serviceAccounts)
+			if err != nil {
+				t.Fatalf("awsTrustPolicy() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("awsTrustPolicy() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_renderIAM(t *testing.T) {
+	buckets := []*iamBucket{{Name: "us-east-1-A", RefName: "tenant-X-acct-us-east-1-A"}}
+	tests := []struct {
+		name    string
+		data    *iamData
+		account *account.Account
+		want    string
+	}{
+		{
+			name: "aws access policy",
+			data: &iamData{
+				TenantID:    "tenant-X",
+				AccountID:   "1234",
+				RefName:     "tenant-X-aws-1234-bucket-access",
+				Buckets:     buckets,
+				TrustPolicy: "{}",
+			},
+			account: &account.Account{AccountID: "1234", CloudProvider: "aws"},
+			want: `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: iam.aws.upbound.io/v1beta1
+kind: Role
+metadata:
+  name: bucket-access
+spec:
+  forProvider:
+    assumeRolePolicy: |
+      {}
+  providerConfigRef:
+    name: default
+---
+apiVersion: iam.aws.upbound.io/v1beta1
+kind: Policy
+metadata:
+  name: bucket-access
+spec:
+  forProvider:
+    policy: |
+      {
+        "Version": "2012-10-17",
+        "Statement": [
+          {
+            "Effect": "Allow",
+            "Action": [
+              "s3:GetBucketLocation",
+              "s3:ListBucket",
+              "s3:GetObject",
+              "s3:PutObject",
+              "s3:DeleteObject"
+            ],
+            "Resource": [
+              "arn:aws:s3:::tenant-X-acct-us-east-1-A",
+              "arn:aws:s3:::tenant-X-acct-us-east-1-A/*"
+            ]
+          }
+        ]
+      }
+  providerConfigRef:
+    name: default
+---
+apiVersion: iam.aws.upbound.io/v1beta1
+kind: RolePolicyAttachment
+metadata:
+  name: bucket-access
+spec:
+  forProvider:
+    roleRef:
+      name: tenant-X-aws-1234-bucket-access
+    policyArnRef:
+      name: tenant-X-aws-1234-bucket-access
+  providerConfigRef:
+    name: default
+`,
+		},
+		{
+			name: "gcp bindings",
+			data: &iamData{
+				TenantID:               "tenant-X",
+				AccountID:              "senzu-bean",
+				RefName:                "tenant-X-gcp-senzu-bean-bucket-access",
+				Buckets:                buckets,
+				ServiceAccounts:        []*k8sServiceAccount{{Namespace: "x1", Name: "tenant-X-gcp-senzu-bean-k8s-bucket-access"}},
+				GCPServiceAccountID:    "tenant-x-d77f7de3",
+				GCPServiceAccountEmail: "tenant-x-d77f7de3@senzu-bean.iam.gserviceaccount.com",
+				WorkloadIdentityPool:   "gke-fleet.svc.id.goog",
+			},
+			account: &account.Account{AccountID: "senzu-bean", CloudProvider: "gcp"},
+			want: `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: cloudplatform.gcp.upbound.io/v1beta1
+kind: ServiceAccount
+metadata:
+  name: bucket-access
+  annotations:
+    crossplane.io/external-name: tenant-x-d77f7de3
+spec:
+  forProvider:
+    displayName: Bucket access of tenant tenant-X
+  providerConfigRef:
+    name: default
+---
+apiVersion: storage.gcp.upbound.io/v1beta1
+kind: BucketIAMMember
+metadata:
+  name: bucket-access-us-east-1-A
+spec:
+  forProvider:
+    bucketRef:
+      name: tenant-X-acct-us-east-1-A
+    role: roles/storage.objectUser
+    member: serviceAccount:tenant-x-d77f7de3@senzu-bean.iam.gserviceaccount.com
+  providerConfigRef:
+    name: default
+---
+apiVersion: cloudplatform.gcp.upbound.io/v1beta1
+kind: ServiceAccountIAMMember
+metadata:
+  name: bucket-access-x1
+spec:
+  forProvider:
+    serviceAccountIdRef:
+      name: tenant-X-gcp-senzu-bean-bucket-access
+    role: roles/iam.workloadIdentityUser
+    member: serviceAccount:gke-fleet.svc.id.goog[x1/tenant-X-gcp-senzu-bean-k8s-bucket-access]
+  providerConfigRef:
+    name: default
+`,
+		},
+		{
+			name: "gcp bindings of claimed buckets",
+			data: &iamData{
+				TenantID:               "tenant-X",
+				AccountID:              "senzu-bean",
+				RefName:                "tenant-X-gcp-senzu-bean-bucket-access",
+				Buckets:                buckets,
+				GCPServiceAccountID:    "tenant-x-d77f7de3",
+				GCPServiceAccountEmail: "tenant-x-d77f7de3@senzu-bean.iam.gserviceaccount.com",
+				Claimed:                true,
+			},
+			account: &account.Account{AccountID: "senzu-bean", CloudProvider: "gcp"},
+			want: `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: cloudplatform.gcp.upbound.io/v1beta1
+kind: ServiceAccount
+metadata:
+  name: bucket-access
+  annotations:
+    crossplane.io/external-name: tenant-x-d77f7de3
+spec:
+  forProvider:
+    displayName: Bucket access of tenant tenant-X
+  providerConfigRef:
+    name: default
+---
+apiVersion: storage.gcp.upbound.io/v1beta1
+kind: BucketIAMMember
+metadata:
+  name: bucket-access-us-east-1-A
+spec:
+  forProvider:
+    bucket: tenant-X-acct-us-east-1-A
+    role: roles/storage.objectUser
+    member: serviceAccount:tenant-x-d77f7de3@senzu-bean.iam.gserviceaccount.com
+  providerConfigRef:
+    name: default
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := *tt.data
+			if tt.account.CloudProvider == "aws" {
+				policy, err := awsAccessPolicy(data.Buckets)
+				if err != nil {
+					t.Fatalf("awsAccessPolicy() error = %v", err)
+				}
+				data.AccessPolicy = policy
+			}
+			got, err := renderIAM(&data, tt.account)
+			if err != nil {
+				t.Fatalf("renderIAM() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("renderIAM() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/internal"
 	"github.com/Huang-Wei/25-kubecon-jp/go/generated/infra/account"
 	"github.com/Huang-Wei/25-kubecon-jp/go/generated/tenant/resource"
 )
@@ -19,17 +20,65 @@ var awsBucketTpl = template.Must(template.New("aws-bucket").Parse(embedAWSBucket
 var embedGCPBucket string
 var gcpBucketTpl = template.Must(template.New("gcp-bucket").Funcs(customFuncMap()).Parse(embedGCPBucket))
 
+//go:embed templates/tenants/non-k8s/aws-queue.yaml.tpl
+var embedAWSQueue string
+var awsQueueTpl = template.Must(template.New("aws-queue").Parse(embedAWSQueue))
+
+//go:embed templates/tenants/non-k8s/gcp-queue.yaml.tpl
+var embedGCPQueue string
+var gcpQueueTpl = template.Must(template.New("gcp-queue").Funcs(customFuncMap()).Parse(embedGCPQueue))
+
+//go:embed templates/tenants/non-k8s/aws-iam.yaml.tpl
+var embedAWSIAM string
+var awsIAMTpl = template.Must(template.New("aws-iam").Funcs(customFuncMap()).Parse(embedAWSIAM))
+
+//go:embed templates/tenants/non-k8s/gcp-iam.yaml.tpl
+var embedGCPIAM string
+var gcpIAMTpl = template.Must(template.New("gcp-iam").Parse(embedGCPIAM))
+
+//go:embed templates/tenants/k8s/serviceaccount.yaml.tpl
+var embedServiceAccount string
+var serviceAccountTpl = template.Must(template.New("serviceaccount").Parse(embedServiceAccount))
+
+//go:embed templates/tenants/non-k8s/tenantstorage.yaml.tpl
+var embedTenantStorage string
+var tenantStorageTpl = template.Must(template.New("tenantstorage").Parse(embedTenantStorage))
+
 //go:embed templates/tenants/non-k8s/kustomization.yaml.tpl
 var embedKustomization string
 var kustomizationTpl = template.Must(template.New("kustomization").Parse(embedKustomization))
 
+//go:embed templates/gitops/argocd-application.yaml.tpl
+var embedArgoCDApplication string
+var argoCDApplicationTpl = template.Must(template.New("argocd-application").Parse(embedArgoCDApplication))
+
+//go:embed templates/gitops/argocd-applicationset.yaml.tpl
+var embedArgoCDApplicationSet string
+var argoCDApplicationSetTpl = template.Must(template.New("argocd-applicationset").Parse(embedArgoCDApplicationSet))
+
+//go:embed templates/gitops/flux-kustomization.yaml.tpl
+var embedFluxKustomization string
+var fluxKustomizationTpl = template.Must(template.New("flux-kustomization").Parse(embedFluxKustomization))
+
 func customFuncMap() template.FuncMap {
 	return template.FuncMap{
 		"toGCPRegion": toGCPRegion,
+		"indent":      indent,
 	}
 }
 
-func renderBucket(bucket *resource.Bucket, account *account.Account) (string, error) {
+// bucketData is the input of <provider>-bucket.yaml.tpl.
+type bucketData struct {
+	*resource.Bucket
+	// RefName is the name of the Bucket object after kustomize's namePrefix is applied.
+	RefName string
+	// The secure defaults which are on unless the tenant opts out.
+	BlockPublicAccess bool
+	Versioning        bool
+	Encryption        bool
+}
+
+func renderBucket(bucket *resource.Bucket, optOut *internal.BucketOptOut, account *account.Account, namePrefix string) (string, error) {
 	var tpl *template.Template
 	cloudProvider := account.CloudProvider
 	switch cloudProvider {
@@ -42,7 +91,44 @@ func renderBucket(bucket *resource.Bucket, account *account.Account) (string, er
 	}
 
 	buf := bytes.NewBuffer(nil)
-	err := tpl.Execute(buf, bucket)
+	err := tpl.Execute(buf, bucketData{
+		Bucket:            bucket,
+		RefName:           fmt.Sprintf("%s-%s", namePrefix, bucket.Name),
+		BlockPublicAccess: !optOut.PublicAccess,
+		Versioning:        !optOut.Versioning,
+		Encryption:        !optOut.Encryption,
+	})
+	if err != nil {
+		return "", fmt.Errorf("rendering error: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+// queueData is the input of <provider>-queue.yaml.tpl.
+type queueData struct {
+	*internal.Queue
+	// RefName is the name of the Queue (or Topic) object after kustomize's namePrefix is applied.
+	RefName string
+}
+
+func renderQueue(queue *internal.Queue, account *account.Account, namePrefix string) (string, error) {
+	var tpl *template.Template
+	cloudProvider := account.CloudProvider
+	switch cloudProvider {
+	case "aws":
+		tpl = awsQueueTpl
+	case "gcp":
+		tpl = gcpQueueTpl
+	default:
+		return "", fmt.Errorf("unsupported cloud provider: %s", cloudProvider)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err := tpl.Execute(buf, queueData{
+		Queue:   queue,
+		RefName: fmt.Sprintf("%s-%s", namePrefix, queue.Name),
+	})
 	if err != nil {
 		return "", fmt.Errorf("rendering error: %w", err)
 	}
@@ -50,6 +136,44 @@ func renderBucket(bucket *resource.Bucket, account *account.Account) (string, er
 	return buf.String(), nil
 }
 
+func renderIAM(data *iamData, account *account.Account) (string, error) {
+	var tpl *template.Template
+	cloudProvider := account.CloudProvider
+	switch cloudProvider {
+	case "aws":
+		tpl = awsIAMTpl
+	case "gcp":
+		tpl = gcpIAMTpl
+	default:
+		return "", fmt.Errorf("unsupported cloud provider: %s", cloudProvider)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := tpl.Execute(buf, data); err != nil {
+		return "", fmt.Errorf("rendering error: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+func renderServiceAccounts(data *iamData) (string, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := serviceAccountTpl.Execute(buf, data); err != nil {
+		return "", fmt.Errorf("rendering error: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+func renderClaim(data *claimData) (string, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := tenantStorageTpl.Execute(buf, data); err != nil {
+		return "", fmt.Errorf("rendering error: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
 func renderKustomization(namePrefix string, yamlFiles []string) (string, error) {
 	buf := bytes.NewBuffer(nil)
 	err := kustomizationTpl.Execute(buf, struct {
@@ -66,46 +190,81 @@ func renderKustomization(namePrefix string, yamlFiles []string) (string, error)
 	return buf.String(), nil
 }
 
+func renderGitOps(data *gitOpsData) (string, error) {
+	var tpl *template.Template
+	switch data.Flavor {
+	case GitOpsFlavorArgoCD:
+		tpl = argoCDApplicationTpl
+		if data.Granularity == GitOpsGranularityAccount {
+			tpl = argoCDApplicationSetTpl
+		}
+	case GitOpsFlavorFlux:
+		tpl = fluxKustomizationTpl
+	default:
+		return "", fmt.Errorf("unsupported gitops flavor: %s", data.Flavor)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := tpl.Execute(buf, data); err != nil {
+		return "", fmt.Errorf("rendering error: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+// indent indents every line of 's' with 'spaces' spaces.
+func indent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// awsToGCPRegions maps the AWS-style region names, which tenants use regardless of
+// cloud provider, to their GCP counterparts.
+var awsToGCPRegions = map[string]string{
+	// US regions
+	"us-east-1":     "us-east1",
+	"us-east-2":     "us-east4",
+	"us-west-1":     "us-west2",
+	"us-west-2":     "us-west1",
+	"us-gov-east-1": "us-east1", // Government regions map to regular regions
+	"us-gov-west-1": "us-west1",
+
+	// Europe regions
+	"eu-west-1":    "europe-west2",
+	"eu-west-2":    "europe-west2",
+	"eu-west-3":    "europe-west9",
+	"eu-central-1": "europe-west3",
+	"eu-north-1":   "europe-north1",
+	"eu-south-1":   "europe-southwest1",
+
+	// Asia Pacific regions
+	"ap-southeast-1": "asia-southeast1",
+	"ap-southeast-2": "asia-southeast2",
+	"ap-northeast-1": "asia-northeast1",
+	"ap-northeast-2": "asia-northeast3",
+	"ap-northeast-3": "asia-northeast2",
+	"ap-south-1":     "asia-south1",
+	"ap-east-1":      "asia-east2",
+
+	// Other regions
+	"ca-central-1": "northamerica-northeast1",
+	"sa-east-1":    "southamerica-east1",
+	"af-south-1":   "africa-south1",
+	"me-south-1":   "me-west1",
+}
+
+// IsKnownRegion returns whether the AWS-style region name has a known GCP counterpart.
+func IsKnownRegion(region string) bool {
+	_, ok := awsToGCPRegions[region]
+	return ok
+}
+
 // ToGCPRegion converts AWS-style region name to GCP format
 // AWS format: "us-east-1", "eu-west-2", "ap-southeast-1"
 // GCP format: "us-east1", "europe-west2", "asia-southeast1"
 func toGCPRegion(awsRegion string) string {
-	// Handle special region mappings first
-	regionMap := map[string]string{
-		// US regions
-		"us-east-1":     "us-east1",
-		"us-east-2":     "us-east4",
-		"us-west-1":     "us-west2",
-		"us-west-2":     "us-west1",
-		"us-gov-east-1": "us-east1", // Government regions map to regular regions
-		"us-gov-west-1": "us-west1",
-
-		// Europe regions
-		"eu-west-1":    "europe-west2",
-		"eu-west-2":    "europe-west2",
-		"eu-west-3":    "europe-west9",
-		"eu-central-1": "europe-west3",
-		"eu-north-1":   "europe-north1",
-		"eu-south-1":   "europe-southwest1",
-
-		// Asia Pacific regions
-		"ap-southeast-1": "asia-southeast1",
-		"ap-southeast-2": "asia-southeast2",
-		"ap-northeast-1": "asia-northeast1",
-		"ap-northeast-2": "asia-northeast3",
-		"ap-northeast-3": "asia-northeast2",
-		"ap-south-1":     "asia-south1",
-		"ap-east-1":      "asia-east2",
-
-		// Other regions
-		"ca-central-1": "northamerica-northeast1",
-		"sa-east-1":    "southamerica-east1",
-		"af-south-1":   "africa-south1",
-		"me-south-1":   "me-west1",
-	}
-
 	// Check if we have a direct mapping
-	if gcpRegion, exists := regionMap[awsRegion]; exists {
+	if gcpRegion, exists := awsToGCPRegions[awsRegion]; exists {
 		return gcpRegion
 	}
 
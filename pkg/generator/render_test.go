@@ -3,6 +3,7 @@ package generator
 import (
 	"testing"
 
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/internal"
 	"github.com/Huang-Wei/25-kubecon-jp/go/generated/infra/account"
 	"github.com/Huang-Wei/25-kubecon-jp/go/generated/tenant/resource"
 	"github.com/google/go-cmp/cmp"
@@ -12,6 +13,7 @@ func Test_renderBucket(t *testing.T) {
 	tests := []struct {
 		name    string
 		bucket  *resource.Bucket
+		optOut  *internal.BucketOptOut
 		account *account.Account
 		want    string
 		wantErr bool
@@ -28,6 +30,78 @@ func Test_renderBucket(t *testing.T) {
 			want: `# Code generated by kubecon-pr-generator. DO NOT EDIT.
 apiVersion: s3.aws.upbound.io/v1beta1
 kind: Bucket
+metadata:
+  name: foo
+spec:
+  forProvider:
+    region: us-east-1
+  providerConfigRef:
+    name: default
+---
+apiVersion: s3.aws.upbound.io/v1beta1
+kind: BucketPublicAccessBlock
+metadata:
+  name: foo
+spec:
+  forProvider:
+    region: us-east-1
+    bucketRef:
+      name: tenant-X-aws-1234-us-east-1-foo
+    blockPublicAcls: true
+    blockPublicPolicy: true
+    ignorePublicAcls: true
+    restrictPublicBuckets: true
+  providerConfigRef:
+    name: default
+---
+apiVersion: s3.aws.upbound.io/v1beta1
+kind: BucketVersioning
+metadata:
+  name: foo
+spec:
+  forProvider:
+    region: us-east-1
+    bucketRef:
+      name: tenant-X-aws-1234-us-east-1-foo
+    versioningConfiguration:
+    - status: Enabled
+  providerConfigRef:
+    name: default
+---
+apiVersion: s3.aws.upbound.io/v1beta1
+kind: BucketServerSideEncryptionConfiguration
+metadata:
+  name: foo
+spec:
+  forProvider:
+    region: us-east-1
+    bucketRef:
+      name: tenant-X-aws-1234-us-east-1-foo
+    rule:
+    - applyServerSideEncryptionByDefault:
+      - sseAlgorithm: AES256
+  providerConfigRef:
+    name: default
+`,
+		},
+		{
+			name: "AWS bucket opts out of all secure defaults",
+			account: &account.Account{
+				CloudProvider: "aws",
+			},
+			bucket: &resource.Bucket{
+				Name:   "foo",
+				Region: "us-east-1",
+			},
+			optOut: &internal.BucketOptOut{
+				PublicAccess: true,
+				Versioning:   true,
+				Encryption:   true,
+				Reason:       "static website",
+			},
+			want: `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: s3.aws.upbound.io/v1beta1
+kind: Bucket
 metadata:
   name: foo
 spec:
@@ -54,6 +128,38 @@ metadata:
 spec:
   forProvider:
     location: us-east1
+    uniformBucketLevelAccess: true
+    publicAccessPrevention: enforced
+    versioning:
+    - enabled: true
+  providerConfigRef:
+    name: default
+`,
+		},
+		{
+			name: "GCP bucket opts out of public access prevention and versioning",
+			account: &account.Account{
+				CloudProvider: "gcp",
+			},
+			bucket: &resource.Bucket{
+				Name:   "bar",
+				Region: "us-east-1",
+			},
+			optOut: &internal.BucketOptOut{
+				PublicAccess: true,
+				Versioning:   true,
+				Reason:       "public dataset",
+			},
+			want: `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: storage.gcp.upbound.io/v1beta1
+kind: Bucket
+metadata:
+  name: bar
+spec:
+  forProvider:
+    location: us-east1
+    uniformBucketLevelAccess: true
+    publicAccessPrevention: inherited
   providerConfigRef:
     name: default
 `,
@@ -62,7 +168,11 @@ spec:
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := renderBucket(tt.bucket, tt.account)
+			optOut := tt.optOut
+			if optOut == nil {
+				optOut = &internal.BucketOptOut{}
+			}
+			got, err := renderBucket(tt.bucket, optOut, tt.account, "tenant-X-aws-1234-us-east-1")
 			if (err != nil) != tt.wantErr {
 				t.Errorf("renderBucket() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -75,6 +185,98 @@ spec:
 	}
 }
 
+func Test_renderQueue(t *testing.T) {
+	tests := []struct {
+		name    string
+		queue   *internal.Queue
+		account *account.Account
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "AWS queue",
+			account: &account.Account{
+				CloudProvider: "aws",
+			},
+			queue: &internal.Queue{
+				Name:   "foo",
+				Region: "us-east-1",
+			},
+			want: `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: sqs.aws.upbound.io/v1beta1
+kind: Queue
+metadata:
+  name: foo
+spec:
+  forProvider:
+    region: us-east-1
+    sqsManagedSseEnabled: true
+  providerConfigRef:
+    name: default
+`,
+		},
+		{
+			name: "GCP queue",
+			account: &account.Account{
+				CloudProvider: "gcp",
+			},
+			queue: &internal.Queue{
+				Name:   "bar",
+				Region: "us-east-1",
+			},
+			want: `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: pubsub.gcp.upbound.io/v1beta1
+kind: Topic
+metadata:
+  name: bar
+spec:
+  forProvider:
+    messageStoragePolicy:
+    - allowedPersistenceRegions:
+      - us-east1
+  providerConfigRef:
+    name: default
+---
+apiVersion: pubsub.gcp.upbound.io/v1beta1
+kind: Subscription
+metadata:
+  name: bar
+spec:
+  forProvider:
+    topicRef:
+      name: tenant-X-gcp-1234-us-east-1-bar
+  providerConfigRef:
+    name: default
+`,
+		},
+		{
+			name: "unsupported cloud provider",
+			account: &account.Account{
+				CloudProvider: "azure",
+			},
+			queue: &internal.Queue{
+				Name:   "baz",
+				Region: "us-east-1",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderQueue(tt.queue, tt.account, "tenant-X-gcp-1234-us-east-1")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("renderQueue() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("renderQueue() unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func Test_renderKustomization(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -0,0 +1,108 @@
+package generator
+
+import (
+	"fmt"
+
+	"github.com/spf13/afero"
+	"sigs.k8s.io/yaml"
+
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/infra/account"
+)
+
+const (
+	// BackendCrossplane renders Crossplane manifests. It's the default backend.
+	BackendCrossplane = "crossplane"
+	// BackendCrossplaneClaim renders a TenantStorage claim per account and region, which
+	// bundles the buckets of a tenant. The claims are served by the XRD and Compositions
+	// in PlatformOutputDir.
+	BackendCrossplaneClaim = "crossplane-claim"
+	// BackendTerraform renders Terraform JSON configurations.
+	BackendTerraform = "terraform"
+)
+
+// AccountSettings holds the per-account knobs of the generator which are owned by
+// the platform team rather than tenants.
+type AccountSettings struct {
+	// OIDCIssuers lists the OIDC issuers (without the "https://" scheme) of the EKS
+	// clusters in the account. They're required to bind IAM roles to Kubernetes
+	// service accounts via IRSA.
+	OIDCIssuers []string `json:"oidcIssuers,omitempty"`
+	// Cluster is the cluster that the cloud resources of the account are synced to by
+	// the GitOps controller. It's the destination name on Argo CD, and the name of the
+	// kubeconfig Secret on Flux. Empty means the cluster the controller runs in.
+	Cluster string `json:"cluster,omitempty"`
+	// WorkloadCluster is the cluster that the Kubernetes objects (e.g., service accounts)
+	// of the account are synced to. Defaults to Cluster.
+	WorkloadCluster string `json:"workloadCluster,omitempty"`
+	// WorkloadIdentityProject is the GCP project of the GKE clusters, whose workload identity
+	// pool "<project>.svc.id.goog" holds the Kubernetes service accounts. Defaults to the
+	// project of the account. GCP only.
+	WorkloadIdentityProject string `json:"workloadIdentityProject,omitempty"`
+	// Backend is one of "crossplane", "crossplane-claim" or "terraform". It overrides
+	// the backend of the cloud provider.
+	Backend string `json:"backend,omitempty"`
+}
+
+// ProviderSettings holds the per-cloud-provider knobs of the generator.
+type ProviderSettings struct {
+	// Backend is one of "crossplane" (default), "crossplane-claim" or "terraform".
+	Backend string `json:"backend,omitempty"`
+}
+
+// Settings is the format of the file loaded by LoadSettings.
+type Settings struct {
+	// Accounts is keyed by account ID.
+	Accounts map[string]*AccountSettings `json:"accounts,omitempty"`
+	// Providers is keyed by cloud provider.
+	Providers map[string]*ProviderSettings `json:"providers,omitempty"`
+}
+
+// LoadSettings loads the per-account and per-provider settings from the given YAML file.
+func LoadSettings(fs afero.Fs, path string) (*Settings, error) {
+	data, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var s Settings
+	if err := yaml.UnmarshalStrict(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for id, a := range s.Accounts {
+		if a != nil && !validBackend(a.Backend) {
+			return nil, fmt.Errorf("unsupported backend %q of account %s in %s", a.Backend, id, path)
+		}
+	}
+	for provider, p := range s.Providers {
+		if p != nil && !validBackend(p.Backend) {
+			return nil, fmt.Errorf("unsupported backend %q of provider %s in %s", p.Backend, provider, path)
+		}
+	}
+	return &s, nil
+}
+
+func validBackend(backend string) bool {
+	switch backend {
+	case "", BackendCrossplane, BackendCrossplaneClaim, BackendTerraform:
+		return true
+	}
+	return false
+}
+
+func (cg *Codegen) settingsOf(accountID string) *AccountSettings {
+	if s, ok := cg.accountSettings[accountID]; ok && s != nil {
+		return s
+	}
+	return &AccountSettings{}
+}
+
+// backendOf returns the backend of the given account. The account's setting takes
+// precedence over its cloud provider's.
+func (cg *Codegen) backendOf(act *account.Account) string {
+	if backend := cg.settingsOf(act.AccountID).Backend; backend != "" {
+		return backend
+	}
+	if s, ok := cg.providerSettings[act.CloudProvider]; ok && s != nil && s.Backend != "" {
+		return s.Backend
+	}
+	return BackendCrossplane
+}
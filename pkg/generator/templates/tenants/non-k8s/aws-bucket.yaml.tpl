@@ -8,3 +8,54 @@ spec:
     region: {{ .Region }}
   providerConfigRef:
     name: default
+{{- if .BlockPublicAccess }}
+---
+apiVersion: s3.aws.upbound.io/v1beta1
+kind: BucketPublicAccessBlock
+metadata:
+  name: {{ .Name }}
+spec:
+  forProvider:
+    region: {{ .Region }}
+    bucketRef:
+      name: {{ .RefName }}
+    blockPublicAcls: true
+    blockPublicPolicy: true
+    ignorePublicAcls: true
+    restrictPublicBuckets: true
+  providerConfigRef:
+    name: default
+{{- end }}
+{{- if .Versioning }}
+---
+apiVersion: s3.aws.upbound.io/v1beta1
+kind: BucketVersioning
+metadata:
+  name: {{ .Name }}
+spec:
+  forProvider:
+    region: {{ .Region }}
+    bucketRef:
+      name: {{ .RefName }}
+    versioningConfiguration:
+    - status: Enabled
+  providerConfigRef:
+    name: default
+{{- end }}
+{{- if .Encryption }}
+---
+apiVersion: s3.aws.upbound.io/v1beta1
+kind: BucketServerSideEncryptionConfiguration
+metadata:
+  name: {{ .Name }}
+spec:
+  forProvider:
+    region: {{ .Region }}
+    bucketRef:
+      name: {{ .RefName }}
+    rule:
+    - applyServerSideEncryptionByDefault:
+      - sseAlgorithm: AES256
+  providerConfigRef:
+    name: default
+{{- end }}
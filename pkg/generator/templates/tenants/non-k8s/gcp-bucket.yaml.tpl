@@ -6,5 +6,11 @@ metadata:
 spec:
   forProvider:
     location: {{ .Region | toGCPRegion }}
+    uniformBucketLevelAccess: true
+    publicAccessPrevention: {{ if .BlockPublicAccess }}enforced{{ else }}inherited{{ end }}
+{{- if .Versioning }}
+    versioning:
+    - enabled: true
+{{- end }}
   providerConfigRef:
     name: default
@@ -3,5 +3,7 @@ resources:{{ if not .YAMLFiles }} []{{ end }}
 {{- range .YAMLFiles }}
 - {{ . }}
 {{- end }}
+{{- if .NamePrefix }}
 
 namePrefix: "{{ .NamePrefix }}-"
+{{- end }}
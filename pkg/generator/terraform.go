@@ -0,0 +1,233 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/internal"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/infra/account"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/tenant/resource"
+)
+
+const (
+	// terraformProviderFile holds the provider block of the account in each region directory.
+	terraformProviderFile = "provider.tf.json"
+	// terraformHeader marks a .tf.json file as generated. JSON has no comments, so it's
+	// set as the "//" property that Terraform ignores.
+	terraformHeader = "Code generated by kubecon-pr-generator. DO NOT EDIT."
+)
+
+// tfBlock is a JSON object of the Terraform JSON syntax.
+type tfBlock = map[string]any
+
+// generateTerraformBucket is the Terraform counterpart of generateBucket.
+func (cg *Codegen) generateTerraformBucket(
+	bucket *resource.Bucket,
+	optOut *internal.BucketOptOut,
+	account *account.Account,
+	templatePath string,
+) error {
+	pathCtx := pathContext{
+		CloudProvider: account.CloudProvider,
+		AccountID:     account.AccountID,
+		RegionName:    bucket.Region,
+	}
+	if err := cg.writeTerraformProvider(pathCtx, account, templatePath); err != nil {
+		return err
+	}
+	return cg.writeArtifact(pathCtx, templatePath, fmt.Sprintf("bucket-%s.tf.json", bucket.Name), func(namePrefix string) (string, error) {
+		out, err := renderTerraformBucket(bucket, optOut, account, namePrefix)
+		if err != nil {
+			return "", fmt.Errorf("failed to render terraform bucket: %w", err)
+		}
+		return out, nil
+	})
+}
+
+// generateTerraformQueue is the Terraform counterpart of generateQueue.
+func (cg *Codegen) generateTerraformQueue(
+	queue *internal.Queue,
+	account *account.Account,
+	templatePath string,
+) error {
+	pathCtx := pathContext{
+		CloudProvider: account.CloudProvider,
+		AccountID:     account.AccountID,
+		RegionName:    queue.Region,
+	}
+	if err := cg.writeTerraformProvider(pathCtx, account, templatePath); err != nil {
+		return err
+	}
+	return cg.writeArtifact(pathCtx, templatePath, fmt.Sprintf("queue-%s.tf.json", queue.Name), func(namePrefix string) (string, error) {
+		out, err := renderTerraformQueue(queue, account, namePrefix)
+		if err != nil {
+			return "", fmt.Errorf("failed to render terraform queue: %w", err)
+		}
+		return out, nil
+	})
+}
+
+// writeTerraformProvider writes the provider block of the account, which every resource
+// in the region directory refers to. It's idempotent.
+func (cg *Codegen) writeTerraformProvider(pathCtx pathContext, account *account.Account, templatePath string) error {
+	return cg.writeArtifact(pathCtx, templatePath, terraformProviderFile, func(string) (string, error) {
+		out, err := renderTerraformProvider(account, pathCtx.RegionName)
+		if err != nil {
+			return "", fmt.Errorf("failed to render terraform provider: %w", err)
+		}
+		return out, nil
+	})
+}
+
+func renderTerraformProvider(account *account.Account, region string) (string, error) {
+	alias := terraformProviderAlias(account)
+	var provider, source string
+	var config tfBlock
+	switch account.CloudProvider {
+	case "aws":
+		provider, source = "aws", "hashicorp/aws"
+		config = tfBlock{
+			"alias":               alias,
+			"region":              region,
+			"allowed_account_ids": []string{account.AccountID},
+		}
+	case "gcp":
+		provider, source = "google", "hashicorp/google"
+		config = tfBlock{
+			"alias":   alias,
+			"project": account.AccountID,
+			"region":  toGCPRegion(region),
+		}
+	default:
+		return "", fmt.Errorf("unsupported cloud provider: %s", account.CloudProvider)
+	}
+	return marshalTerraform(tfBlock{
+		"terraform": tfBlock{
+			"required_providers": tfBlock{
+				provider: tfBlock{"source": source},
+			},
+		},
+		"provider": tfBlock{
+			provider: []tfBlock{config},
+		},
+	})
+}
+
+func renderTerraformBucket(bucket *resource.Bucket, optOut *internal.BucketOptOut, account *account.Account, namePrefix string) (string, error) {
+	name := terraformIdentifier(bucket.Name)
+	refName := fmt.Sprintf("%s-%s", namePrefix, bucket.Name)
+	resources := tfBlock{}
+	switch account.CloudProvider {
+	case "aws":
+		provider := "aws." + terraformProviderAlias(account)
+		bucketID := fmt.Sprintf("${aws_s3_bucket.%s.id}", name)
+		resources["aws_s3_bucket"] = tfBlock{name: tfBlock{
+			"provider": provider,
+			"bucket":   refName,
+		}}
+		if !optOut.PublicAccess {
+			resources["aws_s3_bucket_public_access_block"] = tfBlock{name: tfBlock{
+				"provider":                provider,
+				"bucket":                  bucketID,
+				"block_public_acls":       true,
+				"block_public_policy":     true,
+				"ignore_public_acls":      true,
+				"restrict_public_buckets": true,
+			}}
+		}
+		if !optOut.Versioning {
+			resources["aws_s3_bucket_versioning"] = tfBlock{name: tfBlock{
+				"provider":                 provider,
+				"bucket":                   bucketID,
+				"versioning_configuration": tfBlock{"status": "Enabled"},
+			}}
+		}
+		if !optOut.Encryption {
+			resources["aws_s3_bucket_server_side_encryption_configuration"] = tfBlock{name: tfBlock{
+				"provider": provider,
+				"bucket":   bucketID,
+				"rule": []tfBlock{
+					{"apply_server_side_encryption_by_default": tfBlock{"sse_algorithm": "AES256"}},
+				},
+			}}
+		}
+	case "gcp":
+		config := tfBlock{
+			"provider":                    "google." + terraformProviderAlias(account),
+			"name":                        refName,
+			"location":                    toGCPRegion(bucket.Region),
+			"uniform_bucket_level_access": true,
+			"public_access_prevention":    "enforced",
+		}
+		if optOut.PublicAccess {
+			config["public_access_prevention"] = "inherited"
+		}
+		if !optOut.Versioning {
+			config["versioning"] = tfBlock{"enabled": true}
+		}
+		resources["google_storage_bucket"] = tfBlock{name: config}
+	default:
+		return "", fmt.Errorf("unsupported cloud provider: %s", account.CloudProvider)
+	}
+	return marshalTerraform(tfBlock{"resource": resources})
+}
+
+func renderTerraformQueue(queue *internal.Queue, account *account.Account, namePrefix string) (string, error) {
+	name := terraformIdentifier(queue.Name)
+	refName := fmt.Sprintf("%s-%s", namePrefix, queue.Name)
+	resources := tfBlock{}
+	switch account.CloudProvider {
+	case "aws":
+		resources["aws_sqs_queue"] = tfBlock{name: tfBlock{
+			"provider":                "aws." + terraformProviderAlias(account),
+			"name":                    refName,
+			"sqs_managed_sse_enabled": true,
+		}}
+	case "gcp":
+		provider := "google." + terraformProviderAlias(account)
+		resources["google_pubsub_topic"] = tfBlock{name: tfBlock{
+			"provider": provider,
+			"name":     refName,
+			"message_storage_policy": tfBlock{
+				"allowed_persistence_regions": []string{toGCPRegion(queue.Region)},
+			},
+		}}
+		resources["google_pubsub_subscription"] = tfBlock{name: tfBlock{
+			"provider": provider,
+			"name":     refName,
+			"topic":    fmt.Sprintf("${google_pubsub_topic.%s.id}", name),
+		}}
+	default:
+		return "", fmt.Errorf("unsupported cloud provider: %s", account.CloudProvider)
+	}
+	return marshalTerraform(tfBlock{"resource": resources})
+}
+
+// marshalTerraform marshals the config along with the generated header. As the keys
+// are sorted, the header always comes first.
+func marshalTerraform(config tfBlock) (string, error) {
+	config["//"] = terraformHeader
+	out, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal terraform config: %w", err)
+	}
+	return string(out) + "\n", nil
+}
+
+var invalidTerraformIdentifierChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// terraformIdentifier converts 's' into a valid Terraform identifier, which consists of
+// letters, digits, underscores and dashes, and doesn't start with a digit or dash.
+func terraformIdentifier(s string) string {
+	id := invalidTerraformIdentifierChars.ReplaceAllString(s, "_")
+	if id == "" || (id[0] >= '0' && id[0] <= '9') || id[0] == '-' {
+		id = "_" + id
+	}
+	return id
+}
+
+// terraformProviderAlias keys the provider block by the account.
+func terraformProviderAlias(account *account.Account) string {
+	return terraformIdentifier("account_" + account.AccountID)
+}
@@ -0,0 +1,59 @@
+package generator
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/afero"
+)
+
+func Test_terraformIdentifier(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "bucket-A", want: "bucket-A"},
+		{in: "my.bucket", want: "my_bucket"},
+		{in: "1st", want: "_1st"},
+		{in: "-x", want: "_-x"},
+		{in: "", want: "_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := terraformIdentifier(tt.in); got != tt.want {
+				t.Errorf("terraformIdentifier() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_deleteGeneratedFiles(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	files := map[string]string{
+		"/out/bucket-A.yaml":    "# Code generated by kubecon-pr-generator. DO NOT EDIT.\nkind: Bucket\n",
+		"/out/bucket-A.tf.json": "{\n  \"//\": \"Code generated by kubecon-pr-generator. DO NOT EDIT.\",\n  \"resource\": {}\n}\n",
+		"/out/manual.yaml":      "kind: Bucket\n",
+		"/out/manual.tf.json":   "{\n  \"resource\": {}\n}\n",
+	}
+	for path, content := range files {
+		if err := afero.WriteFile(fs, path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := deleteGeneratedFiles(fs, "/out"); err != nil {
+		t.Fatalf("deleteGeneratedFiles() error = %v", err)
+	}
+
+	var got []string
+	_ = afero.Walk(fs, "/out", func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			got = append(got, path)
+		}
+		return err
+	})
+	want := []string{"/out/manual.tf.json", "/out/manual.yaml"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected files (-want +got):\n%s", diff)
+	}
+}
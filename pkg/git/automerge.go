@@ -0,0 +1,174 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	githubql "github.com/shurcooL/githubv4"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/prow/pkg/github"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/config"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/plan"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/common/selector/key"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/infra/account"
+)
+
+// autoMergeBlocker returns why the PR of the object changes needs a review, or "" if it can be
+// auto-merged: it only creates resources, in the low-risk envs, without policy warnings.
+func autoMergeBlocker(autoMerge *config.AutoMerge, changes []*plan.ObjectChange, accounts []*account.Account, warned bool) string {
+	if len(changes) == 0 {
+		return "the plan has no resource change"
+	}
+	if warned {
+		return "the policies reported warnings"
+	}
+	envs := map[string]string{}
+	for _, act := range accounts {
+		envs[fmt.Sprintf("%s-%s", act.CloudProvider, act.AccountID)] = act.Tags[key.Env]
+	}
+	for _, c := range changes {
+		if c.Action != plan.Create {
+			where := c.Object.Account()
+			if where == "" {
+				where = c.Object.Path
+			}
+			return fmt.Sprintf("the plan %ss %s `%s` in %s", c.Action, c.Object.Kind, c.Object.Name, where)
+		}
+		// The shared objects, e.g., the GitOps Application of a new account, come along
+		// with the resources of the tenants.
+		if c.Object.AccountID == "" {
+			continue
+		}
+		env := envs[c.Object.Account()]
+		if !autoMerge.LowRisk(env) {
+			return fmt.Sprintf("%s `%s` is created in %s, whose env %q is not low-risk", c.Object.Kind, c.Object.Name, c.Object.Account(), env)
+		}
+	}
+	return ""
+}
+
+// AutoMergeLabel is set on the downstream PRs that GitHub refused to auto-merge. They are
+// merged by MergeIfChecksPassed on a later status event, once their checks passed.
+const AutoMergeLabel = "codegen/auto-merge"
+
+// autoMerge approves the downstream PR if configured, and enables the auto-merge of GitHub,
+// which merges it once the required checks pass. If GitHub refuses, e.g., because the repo
+// doesn't allow auto-merge, the PR is labeled with AutoMergeLabel instead. It is never merged
+// right away, as no check reported on the PR that was just opened.
+func (r *ResourceWorker) autoMerge(ctx context.Context, state *PipelineState) error {
+	org, repo, num := state.DownstreamOrg, state.DownstreamName, state.PullRequestNumber
+	if state.AutoMergeApprove {
+		// GitHub doesn't let the bot approve its own PRs, unless it reviews as another user.
+		review := github.DraftReview{Action: github.Approve, Body: "Approved by the auto-merge policy of the low-risk changes."}
+		if err := r.ghc.CreateReview(org, repo, num, review); err != nil {
+			r.logger.Error(err, "failed to approve the PR", "pr", num)
+		}
+	}
+
+	var pr *github.PullRequest
+	if err := r.retry(ctx, "getting the pull request", func() (err error) {
+		pr, err = r.ghc.GetPullRequest(org, repo, num)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	var m struct {
+		EnablePullRequestAutoMerge struct {
+			ClientMutationID githubql.String
+		} `graphql:"enablePullRequestAutoMerge(input: $input)"`
+	}
+	method := githubql.PullRequestMergeMethod(strings.ToUpper(state.AutoMergeMethod))
+	input := githubql.EnablePullRequestAutoMergeInput{PullRequestID: githubql.ID(pr.NodeID), MergeMethod: &method}
+	enableErr := r.ghc.MutateWithGitHubAppsSupport(ctx, &m, input, nil, org)
+	if enableErr == nil {
+		return nil
+	}
+
+	r.logger.Info("GitHub refused to auto-merge, waiting for the checks", "pr", num, "error", enableErr.Error())
+	if err := r.retry(ctx, "labeling the pull request for auto-merge", func() error {
+		return r.ghc.AddLabel(org, repo, num, AutoMergeLabel)
+	}); err != nil {
+		return fmt.Errorf("failed to enable auto-merge: %w, and to label the PR: %w", enableErr, err)
+	}
+	return nil
+}
+
+// AutoMergePullRequests returns the open PRs of the bot at 'sha' that wait for their checks
+// to be merged.
+func (r *ResourceWorker) AutoMergePullRequests(org, repo, sha string) ([]*github.PullRequest, error) {
+	prs, err := r.ghc.GetPullRequests(org, repo)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []*github.PullRequest
+	for i := range prs {
+		pr := &prs[i]
+		if pr.Head.SHA == sha && r.UpstreamOf(pr) != nil && github.HasLabel(AutoMergeLabel, pr.Labels) {
+			candidates = append(candidates, pr)
+		}
+	}
+	return candidates, nil
+}
+
+// MergeIfChecksPassed merges 'pr' with 'method' if all its checks passed, and returns whether
+// it was merged.
+func (r *ResourceWorker) MergeIfChecksPassed(org, repo string, pr *github.PullRequest, method string) (bool, error) {
+	passed, err := r.checksPassed(org, repo, pr.Base.Ref, pr.Head.SHA)
+	if err != nil || !passed {
+		return false, err
+	}
+	if err := r.ghc.Merge(org, repo, pr.Number, github.MergeDetails{SHA: pr.Head.SHA, MergeMethod: method}); err != nil {
+		return false, fmt.Errorf("failed to merge: %w", err)
+	}
+	return true, nil
+}
+
+// checksPassed returns whether all the statuses and check runs of 'sha' succeeded. There must
+// be some, including the ones required by the protection of the 'base' branch.
+func (r *ResourceWorker) checksPassed(org, repo, base, sha string) (bool, error) {
+	status, err := r.ghc.GetCombinedStatus(org, repo, sha)
+	if err != nil {
+		return false, err
+	}
+	checkRuns, err := r.ghc.ListCheckRuns(org, repo, sha)
+	if err != nil {
+		return false, err
+	}
+	if len(status.Statuses) == 0 && len(checkRuns.CheckRuns) == 0 {
+		return false, nil
+	}
+
+	passed := sets.New[string]()
+	// The combined state is pending if there is no status.
+	if len(status.Statuses) != 0 {
+		if status.State != github.StatusSuccess {
+			return false, nil
+		}
+		for _, s := range status.Statuses {
+			passed.Insert(s.Context)
+		}
+	}
+	for _, run := range checkRuns.CheckRuns {
+		if run.Status != "completed" || (run.Conclusion != "success" && run.Conclusion != "neutral" && run.Conclusion != "skipped") {
+			return false, nil
+		}
+		passed.Insert(run.Name)
+	}
+
+	// The protection is nil if the branch isn't protected.
+	protection, err := r.ghc.GetBranchProtection(org, repo, base)
+	if err != nil {
+		return false, fmt.Errorf("failed to get the protection of %s: %w", base, err)
+	}
+	if protection != nil && protection.RequiredStatusChecks != nil {
+		for _, required := range protection.RequiredStatusChecks.Contexts {
+			if !passed.Has(required) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
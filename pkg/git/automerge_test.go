@@ -0,0 +1,224 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	githubql "github.com/shurcooL/githubv4"
+	"sigs.k8s.io/prow/pkg/github"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/config"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/inventory"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/plan"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/common/selector/key"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/infra/account"
+)
+
+func Test_autoMergeBlocker(t *testing.T) {
+	autoMerge := &config.AutoMerge{LowRiskEnvs: []string{"dev"}, Method: config.DefaultMergeMethod}
+	accounts := []*account.Account{
+		{AccountID: "1111", CloudProvider: "aws", Tags: map[key.Key]string{key.Env: "dev"}},
+		{AccountID: "2222", CloudProvider: "aws", Tags: map[key.Key]string{key.Env: "prod"}},
+		{AccountID: "3333", CloudProvider: "gcp"},
+	}
+	change := func(action plan.Action, accountID string) *plan.ObjectChange {
+		return &plan.ObjectChange{
+			Action: action,
+			Object: &inventory.Object{TenantID: "bar", CloudProvider: "aws", AccountID: accountID, Kind: "Bucket", Name: "bucket-a"},
+		}
+	}
+	application := func(action plan.Action) *plan.ObjectChange {
+		return &plan.ObjectChange{
+			Action: action,
+			Object: &inventory.Object{Path: "_output/gitops/bar-aws-1111.yaml", Kind: "Application", Name: "bar-aws-1111"},
+		}
+	}
+	tests := []struct {
+		name    string
+		changes []*plan.ObjectChange
+		warned  bool
+		want    string
+	}{
+		{
+			name:    "additions in a low-risk env",
+			changes: []*plan.ObjectChange{change(plan.Create, "1111")},
+		},
+		{
+			name: "no change",
+			want: "the plan has no resource change",
+		},
+		{
+			name:    "policy warnings",
+			changes: []*plan.ObjectChange{change(plan.Create, "1111")},
+			warned:  true,
+			want:    "the policies reported warnings",
+		},
+		{
+			name:    "deletion",
+			changes: []*plan.ObjectChange{change(plan.Create, "1111"), change(plan.Delete, "1111")},
+			want:    "the plan deletes Bucket `bucket-a` in aws-1111",
+		},
+		{
+			name:    "update",
+			changes: []*plan.ObjectChange{change(plan.Update, "1111")},
+			want:    "the plan updates Bucket `bucket-a` in aws-1111",
+		},
+		{
+			name:    "prod",
+			changes: []*plan.ObjectChange{change(plan.Create, "2222")},
+			want:    "Bucket `bucket-a` is created in aws-2222, whose env \"prod\" is not low-risk",
+		},
+		{
+			name:    "unknown account",
+			changes: []*plan.ObjectChange{change(plan.Create, "3333")},
+			want:    "Bucket `bucket-a` is created in aws-3333, whose env \"\" is not low-risk",
+		},
+		{
+			name:    "shared object created along",
+			changes: []*plan.ObjectChange{change(plan.Create, "1111"), application(plan.Create)},
+		},
+		{
+			name:    "shared object updated",
+			changes: []*plan.ObjectChange{change(plan.Create, "1111"), application(plan.Update)},
+			want:    "the plan updates Application `bar-aws-1111` in _output/gitops/bar-aws-1111.yaml",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := autoMergeBlocker(autoMerge, tt.changes, accounts, tt.warned); got != tt.want {
+				t.Errorf("autoMergeBlocker() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// checksGitHub reports the checks of a commit, and refuses to enable auto-merge.
+type checksGitHub struct {
+	github.Client
+	statuses   []github.Status
+	state      string
+	checkRuns  []github.CheckRun
+	protection *github.BranchProtection
+	labels     []string
+	merged     []int
+}
+
+func (c *checksGitHub) GetPullRequest(org, repo string, number int) (*github.PullRequest, error) {
+	pr := &github.PullRequest{Number: number, NodeID: "PR_1"}
+	pr.Head.SHA = "abc"
+	return pr, nil
+}
+
+func (c *checksGitHub) MutateWithGitHubAppsSupport(ctx context.Context, m any, input githubql.Input, vars map[string]any, org string) error {
+	return errors.New("auto-merge is not allowed for this repository")
+}
+
+func (c *checksGitHub) AddLabel(org, repo string, number int, label string) error {
+	c.labels = append(c.labels, label)
+	return nil
+}
+
+func (c *checksGitHub) GetCombinedStatus(org, repo, ref string) (*github.CombinedStatus, error) {
+	return &github.CombinedStatus{SHA: ref, Statuses: c.statuses, State: c.state}, nil
+}
+
+func (c *checksGitHub) ListCheckRuns(org, repo, ref string) (*github.CheckRunList, error) {
+	return &github.CheckRunList{CheckRuns: c.checkRuns}, nil
+}
+
+func (c *checksGitHub) GetBranchProtection(org, repo, branch string) (*github.BranchProtection, error) {
+	return c.protection, nil
+}
+
+func (c *checksGitHub) Merge(org, repo string, number int, details github.MergeDetails) error {
+	c.merged = append(c.merged, number)
+	return nil
+}
+
+func TestResourceWorker_autoMerge(t *testing.T) {
+	ghc := &checksGitHub{state: github.StatusPending}
+	r := newTestWorker(ghc)
+	state := &PipelineState{DownstreamOrg: "foo", DownstreamName: "gitops", PullRequestNumber: 1, AutoMergeMethod: "squash"}
+	if err := r.autoMerge(context.Background(), state); err != nil {
+		t.Fatalf("autoMerge() error = %v", err)
+	}
+	// The PR that was just opened waits for its checks, which didn't report yet.
+	if !cmp.Equal(ghc.labels, []string{AutoMergeLabel}) || len(ghc.merged) != 0 {
+		t.Errorf("autoMerge() set labels %v and merged %v, want the %q label and no merge", ghc.labels, ghc.merged, AutoMergeLabel)
+	}
+}
+
+func TestResourceWorker_MergeIfChecksPassed(t *testing.T) {
+	success := github.CheckRun{Name: "lint", Status: "completed", Conclusion: "success"}
+	required := func(contexts ...string) *github.BranchProtection {
+		return &github.BranchProtection{RequiredStatusChecks: &github.RequiredStatusChecks{Contexts: contexts}}
+	}
+	tests := []struct {
+		name       string
+		statuses   []github.Status
+		state      string
+		checkRuns  []github.CheckRun
+		protection *github.BranchProtection
+		want       bool
+	}{
+		{
+			name:  "no status nor check run yet",
+			state: github.StatusPending,
+		},
+		{
+			name:      "check runs passed",
+			state:     github.StatusPending,
+			checkRuns: []github.CheckRun{success, {Name: "docs", Status: "completed", Conclusion: "skipped"}},
+			want:      true,
+		},
+		{
+			name:     "statuses passed",
+			statuses: []github.Status{{Context: "ci", State: github.StatusSuccess}},
+			state:    github.StatusSuccess,
+			want:     true,
+		},
+		{
+			name:      "a check run is in progress",
+			state:     github.StatusPending,
+			checkRuns: []github.CheckRun{success, {Name: "test", Status: "in_progress"}},
+		},
+		{
+			name:      "a status failed",
+			statuses:  []github.Status{{Context: "ci", State: github.StatusFailure}},
+			state:     github.StatusFailure,
+			checkRuns: []github.CheckRun{success},
+		},
+		{
+			name:       "a required check didn't report yet",
+			state:      github.StatusPending,
+			checkRuns:  []github.CheckRun{success},
+			protection: required("lint", "ci"),
+		},
+		{
+			name:       "the required checks passed",
+			statuses:   []github.Status{{Context: "ci", State: github.StatusSuccess}},
+			state:      github.StatusSuccess,
+			checkRuns:  []github.CheckRun{success},
+			protection: required("lint", "ci"),
+			want:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ghc := &checksGitHub{statuses: tt.statuses, state: tt.state, checkRuns: tt.checkRuns, protection: tt.protection}
+			r := newTestWorker(ghc)
+			pr := &github.PullRequest{Number: 1}
+			pr.Base.Ref = "main"
+			pr.Head.SHA = "abc"
+			merged, err := r.MergeIfChecksPassed("foo", "gitops", pr, "squash")
+			if err != nil {
+				t.Fatalf("MergeIfChecksPassed() error = %v", err)
+			}
+			if merged != tt.want || (len(ghc.merged) != 0) != tt.want {
+				t.Errorf("MergeIfChecksPassed() = %v with merges %v, want %v", merged, ghc.merged, tt.want)
+			}
+		})
+	}
+}
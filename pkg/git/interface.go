@@ -2,10 +2,12 @@ package git
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-logr/logr"
 	"sigs.k8s.io/prow/pkg/github"
 
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/config"
 	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/internal"
 	"github.com/Huang-Wei/25-kubecon-jp/go/generated/infra/account"
 )
@@ -14,12 +16,40 @@ type CodegenFunc func(ctx context.Context, dstDir string, accounts []*account.Ac
 
 type Worker interface {
 	GetPullRequest(org, repo string, number int) (*github.PullRequest, error)
-	// CreatePullRequest creates a pull request covering changes to all infra input defined in UpstreamRepo.
-	CreatePullRequest(context.Context, *GHRepo, PullRequestModifier, string, []*account.Account, []*internal.TenantTuple, CodegenFunc) error
+	// CreatePullRequest creates a pull request covering changes to all infra input defined in UpstreamRepo,
+	// in the downstream repo of the given mapping. The result is to be reported to the upstream PR.
+	// A failed run is resumed by the next one, from the step that failed.
+	CreatePullRequest(context.Context, *GHRepo, PullRequestModifier, *config.Mapping, *UpstreamConfig, CodegenFunc) (*Result, error)
+	// ClearPipelineState forgets the progress of CreatePullRequest once its result is reported.
+	ClearPipelineState(*GHRepo, PullRequestModifier, *config.Mapping) error
+	// CleanUpBranches deletes the generated branches of the downstream repo of the mapping that
+	// have no open PR, and weren't pushed for 'maxAge'.
+	CleanUpBranches(downstream *config.Mapping, maxAge time.Duration) error
 	// FetchUpstreamConfigs scans, parse and pre-process the given repo's user input into XYZTuple list.
-	FetchUpstreamConfigs(ctx context.Context, repo *GHRepo) ([]*account.Account, []*internal.TenantTuple, error)
+	FetchUpstreamConfigs(ctx context.Context, repo *GHRepo) (*UpstreamConfig, error)
 	// AddLabel adds the given 'label' to the 'org/repo' repo.
 	AddLabel(org, repo string, number int, label string) error
+	// RemoveLabel removes the given 'label' from the 'org/repo' PR.
+	RemoveLabel(org, repo string, number int, label string) error
+	// CreateComment posts the given 'comment' to the 'org/repo' PR.
+	CreateComment(org, repo string, number int, comment string) error
+	// UpsertComment edits the comment containing 'marker' in the 'org/repo' PR, or posts it.
+	UpsertComment(org, repo string, number int, marker, comment string) error
+	// IsMaintainer returns whether 'user' has the admin or maintain role on the 'org/repo' repo.
+	IsMaintainer(org, repo, user string) (bool, error)
+	// ResolveCommit returns the full SHA of the commit 'ref' of the 'org/repo' repo.
+	ResolveCommit(org, repo, ref string) (string, error)
+	// UpstreamOf returns the upstream PR of a downstream PR, or nil if it wasn't generated.
+	UpstreamOf(pr *github.PullRequest) *GHRepo
+	// DownstreamPullRequests returns the PRs generated from the upstream PR in the
+	// 'downstreams' "org/repo" repos, open or closed.
+	DownstreamPullRequests(upstreamRepo *GHRepo, downstreams []string) ([]*github.PullRequest, error)
+	// AutoMergePullRequests returns the open PRs at 'sha' of the 'org/repo' repo that wait for
+	// their checks to be auto-merged.
+	AutoMergePullRequests(org, repo, sha string) ([]*github.PullRequest, error)
+	// MergeIfChecksPassed merges 'pr' with 'method' if all its checks passed, and returns
+	// whether it was merged.
+	MergeIfChecksPassed(org, repo string, pr *github.PullRequest, method string) (bool, error)
 	// Logger returns the underlying logger for the worker.
 	Logger() logr.Logger
 }
@@ -31,4 +61,9 @@ type PullRequestModifier interface {
 	BranchPostFix() string
 	NoopMsg(GHRepo) string
 	TearDown() bool
+	// Labels are set on the downstream PR.
+	Labels() []string
+	// Rollback returns whether the PR restores the downstream at an earlier upstream commit,
+	// in which case its body shows the diff against the target branch.
+	Rollback() bool
 }
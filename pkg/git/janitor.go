@@ -0,0 +1,95 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/prow/pkg/github"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/config"
+)
+
+// generatedBranchPrefix is the prefix of the branches of the generated PRs after the configured
+// branch prefix, see checkoutBranchFmt.
+const generatedBranchPrefix = "auto-checkout-"
+
+// CleanUpBranches deletes the generated branches of the 'downstream' repo that have no open PR,
+// and weren't pushed for 'maxAge'. The branches are in the bot's fork, which is expected to be
+// named after the downstream repo, or in the downstream repo in the direct push mode.
+func (r *ResourceWorker) CleanUpBranches(downstream *config.Mapping, maxAge time.Duration) error {
+	dOrg, dRepo, _ := strings.Cut(downstream.Downstream, "/")
+	owner, name := dOrg, dRepo
+	if downstream.PushMode != config.PushModeDirect {
+		owner = r.botUser.Login
+		fork, err := r.ghc.GetRepo(owner, dRepo)
+		if err != nil {
+			if github.IsNotFound(err) {
+				return nil
+			}
+			return fmt.Errorf("failed to get the fork of %s: %w", downstream.Downstream, err)
+		}
+		if !fork.Fork || fork.Parent.FullName != downstream.Downstream {
+			return nil
+		}
+		name = fork.Name
+	}
+
+	branches, err := r.ghc.GetBranches(owner, name, false)
+	if err != nil {
+		return fmt.Errorf("failed to list the branches of %s/%s: %w", owner, name, err)
+	}
+	prs, err := r.ghc.GetPullRequests(dOrg, dRepo)
+	if err != nil {
+		return fmt.Errorf("failed to get pull requests for %s: %w", downstream.Downstream, err)
+	}
+	open := sets.New[string]()
+	for _, pr := range prs {
+		if pr.Head.Repo.Owner.Login == owner {
+			open.Insert(pr.Head.Ref)
+		}
+	}
+
+	var errs []error
+	for _, branch := range branches {
+		if !strings.HasPrefix(branch.Name, downstream.BranchPrefix+generatedBranchPrefix) || open.Has(branch.Name) {
+			continue
+		}
+		pushed, err := r.lastPush(owner, name, branch.Name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if time.Since(pushed) < maxAge {
+			continue
+		}
+		if err := r.deleteBranch(owner, name, branch.Name); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		r.logger.Info("deleted a stale branch", "repo", owner+"/"+name, "branch", branch.Name, "pushed", pushed)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// lastPush returns the commit time of the head of 'branch'.
+func (r *ResourceWorker) lastPush(org, repo, branch string) (time.Time, error) {
+	sha, err := r.ghc.GetRef(org, repo, "heads/"+branch)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get the head of %s: %w", branch, err)
+	}
+	commit, err := r.ghc.GetSingleCommit(org, repo, sha)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get the commit %s: %w", sha, err)
+	}
+	return commit.Commit.Committer.Date, nil
+}
+
+func (r *ResourceWorker) deleteBranch(org, repo, branch string) error {
+	if err := r.ghc.DeleteRef(org, repo, "heads/"+branch); err != nil {
+		return fmt.Errorf("failed to delete the branch %s of %s/%s: %w", branch, org, repo, err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package git
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/prow/pkg/github"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/config"
+)
+
+// forkGitHub serves "foo/gitops" and the bot's fork "bot/gitops" of it.
+type forkGitHub struct {
+	github.Client
+	branches []string
+	pushed   map[string]time.Time
+	prs      []github.PullRequest
+	deleted  []string
+}
+
+func (f *forkGitHub) GetRepo(owner, name string) (github.FullRepo, error) {
+	repo := github.FullRepo{}
+	repo.Name = name
+	repo.Fork = true
+	repo.Parent.FullName = "foo/" + name
+	return repo, nil
+}
+
+func (f *forkGitHub) GetBranches(org, repo string, onlyProtected bool) ([]github.Branch, error) {
+	var branches []github.Branch
+	for _, name := range f.branches {
+		branches = append(branches, github.Branch{Name: name})
+	}
+	return branches, nil
+}
+
+func (f *forkGitHub) GetPullRequests(org, repo string) ([]github.PullRequest, error) {
+	return f.prs, nil
+}
+
+func (f *forkGitHub) GetRef(org, repo, ref string) (string, error) {
+	return ref, nil
+}
+
+func (f *forkGitHub) GetSingleCommit(org, repo, sha string) (github.RepositoryCommit, error) {
+	commit := github.RepositoryCommit{SHA: sha}
+	commit.Commit.Committer.Date = f.pushed[sha]
+	return commit, nil
+}
+
+func (f *forkGitHub) DeleteRef(org, repo, ref string) error {
+	f.deleted = append(f.deleted, org+"/"+repo+":"+ref)
+	return nil
+}
+
+func TestResourceWorker_CleanUpBranches(t *testing.T) {
+	old, recent := time.Now().Add(-30*24*time.Hour), time.Now().Add(-time.Hour)
+	tests := []struct {
+		name       string
+		downstream *config.Mapping
+		owner      string
+		branches   []string
+		want       []string
+	}{
+		{
+			name:       "fork",
+			downstream: &config.Mapping{Downstream: "foo/gitops", PushMode: config.PushModeFork},
+			owner:      "bot",
+			branches:   []string{"main", "auto-checkout-1-to-main", "auto-checkout-2-to-main", "auto-checkout-3-to-main-dryrun", "auto-checkout-4-to-main"},
+			want:       []string{"bot/gitops:heads/auto-checkout-2-to-main", "bot/gitops:heads/auto-checkout-3-to-main-dryrun"},
+		},
+		{
+			name:       "direct",
+			downstream: &config.Mapping{Downstream: "foo/gitops", PushMode: config.PushModeDirect, BranchPrefix: "codegen/"},
+			owner:      "foo",
+			branches:   []string{"main", "auto-checkout-2-to-main", "codegen/auto-checkout-1-to-main", "codegen/auto-checkout-2-to-main", "codegen/auto-checkout-4-to-main"},
+			want:       []string{"foo/gitops:heads/codegen/auto-checkout-2-to-main"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix := tt.downstream.BranchPrefix
+			openPR := github.PullRequest{}
+			openPR.Head.Ref = prefix + "auto-checkout-1-to-main"
+			openPR.Head.Repo.Owner.Login = tt.owner
+			ghc := &forkGitHub{
+				branches: tt.branches,
+				pushed: map[string]time.Time{
+					"heads/auto-checkout-2-to-main":                      old,
+					"heads/" + prefix + "auto-checkout-1-to-main":        old,
+					"heads/" + prefix + "auto-checkout-2-to-main":        old,
+					"heads/" + prefix + "auto-checkout-3-to-main-dryrun": old,
+					"heads/" + prefix + "auto-checkout-4-to-main":        recent,
+				},
+				prs: []github.PullRequest{openPR},
+			}
+			r := newTestWorker(ghc)
+			if err := r.CleanUpBranches(tt.downstream, 7*24*time.Hour); err != nil {
+				t.Fatalf("CleanUpBranches() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.want, ghc.deleted); diff != "" {
+				t.Errorf("deleted branches mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
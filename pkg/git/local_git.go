@@ -1,27 +1,82 @@
 package git
 
 import (
-	"bytes"
-	"os/exec"
+	"fmt"
 	"strings"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
-func gitCmd(dir string, args ...string) (string, error) {
-	cmd := exec.Command("git", args...)
-	cmd.Dir = dir
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
-	return out.String(), err
+// Signature identifies a person in a commit.
+type Signature struct {
+	Name  string
+	Email string
+}
+
+func (s Signature) String() string {
+	return fmt.Sprintf("%s <%s>", s.Name, s.Email)
+}
+
+// Commit describes the commit of the generated artifacts.
+type Commit struct {
+	Message string
+	// Author is both the author and the committer.
+	Author Signature
+	// CoAuthors are credited with Co-authored-by trailers.
+	CoAuthors []Signature
+	// SignOff adds a Signed-off-by trailer of the author, as required by the DCO.
+	SignOff bool
+	// Signer signs the commit if set.
+	Signer gogit.Signer
 }
 
-func commit(dir, commitMsg string) error {
-	if _, err := gitCmd(dir, "add", "."); err != nil {
-		return err
+// FullMessage returns the message followed by the trailers.
+func (c *Commit) FullMessage() string {
+	var trailers []string
+	for _, coAuthor := range c.CoAuthors {
+		trailers = append(trailers, "Co-authored-by: "+coAuthor.String())
+	}
+	if c.SignOff {
+		trailers = append(trailers, "Signed-off-by: "+c.Author.String())
 	}
-	if output, _ := gitCmd(dir, "status"); strings.Contains(output, "nothing to commit") {
+	msg := strings.TrimRight(c.Message, "\n") + "\n"
+	if len(trailers) == 0 {
+		return msg
+	}
+	return msg + "\n" + strings.Join(trailers, "\n") + "\n"
+}
+
+// commit stages all the changes of the repo checked out at 'dir', and commits them.
+// It returns ErrNothingToCommit if there is no change.
+func commit(dir string, c *Commit) error {
+	repo, err := gogit.PlainOpenWithOptions(dir, &gogit.PlainOpenOptions{EnableDotGitCommonDir: true})
+	if err != nil {
+		return fmt.Errorf("failed to open the repo in %s: %w", dir, err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get the worktree: %w", err)
+	}
+	if err := worktree.AddWithOptions(&gogit.AddOptions{All: true}); err != nil {
+		return fmt.Errorf("failed to stage the changes: %w", err)
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		return fmt.Errorf("failed to get the status: %w", err)
+	}
+	if status.IsClean() {
 		return ErrNothingToCommit
 	}
-	_, err := gitCmd(dir, "commit", "-m", commitMsg)
-	return err
+
+	signature := &object.Signature{Name: c.Author.Name, Email: c.Author.Email, When: time.Now()}
+	if _, err := worktree.Commit(c.FullMessage(), &gogit.CommitOptions{
+		Author:    signature,
+		Committer: signature,
+		Signer:    c.Signer,
+	}); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	return nil
 }
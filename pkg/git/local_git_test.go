@@ -0,0 +1,66 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_commit(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gogit.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "_output"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "_output", "bucket.yaml"), []byte("kind: Bucket\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Commit{
+		Message:   "Generate artifacts from foo/infra#1\n",
+		Author:    Signature{Name: "codegen-bot", Email: "bot@example.com"},
+		CoAuthors: []Signature{{Name: "alice", Email: "1+alice@users.noreply.github.com"}},
+		SignOff:   true,
+	}
+	if err := commit(dir, c); err != nil {
+		t.Fatalf("commit() error = %v", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `Generate artifacts from foo/infra#1
+
+Co-authored-by: alice <1+alice@users.noreply.github.com>
+Signed-off-by: codegen-bot <bot@example.com>
+`
+	if diff := cmp.Diff(want, got.Message); diff != "" {
+		t.Errorf("commit message mismatch (-want +got):\n%s", diff)
+	}
+	if got.Author.Email != "bot@example.com" || got.Committer.Email != "bot@example.com" {
+		t.Errorf("commit author = %v, committer = %v, want the bot", got.Author, got.Committer)
+	}
+	files, err := got.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := files.Next(); err != nil {
+		t.Errorf("commit has no file: %v", err)
+	}
+
+	if err := commit(dir, c); !errors.Is(err, ErrNothingToCommit) {
+		t.Errorf("commit() without changes error = %v, want %v", err, ErrNothingToCommit)
+	}
+}
@@ -4,11 +4,18 @@ import "fmt"
 
 var (
 	noopMsgTemplate = "⏹️ %sNo changes on cloud resources detected. Skip creating downstream %s/%s PR"
+	// noUpdateMsgTemplate and updateMsgTemplate report a run on an existing downstream PR.
+	noUpdateMsgTemplate = "⏹️ No changes since the previous push to %s. Skip updating it."
+	updateMsgTemplate   = "🔄 Updated %s, %d file(s) changed since the previous push."
 
 	_ PullRequestModifier = DeployPRModifier{}
 	_ PullRequestModifier = DryrunPRModifier{}
+	_ PullRequestModifier = RollbackPRModifier{}
 )
 
+// RollbackLabel is set on the downstream PRs regenerated from an earlier upstream commit.
+const RollbackLabel = "codegen/rollback"
+
 type DeployPRModifier struct{}
 
 func (d DeployPRModifier) TearDown() bool {
@@ -31,6 +38,14 @@ func (d DeployPRModifier) PostCommentPrefix() string {
 	return "⭐ Auto-generated a PR: "
 }
 
+func (d DeployPRModifier) Labels() []string {
+	return nil
+}
+
+func (d DeployPRModifier) Rollback() bool {
+	return false
+}
+
 func NewDeployPRModifier() DeployPRModifier {
 	return DeployPRModifier{}
 }
@@ -57,6 +72,60 @@ func (d DryrunPRModifier) PostCommentPrefix() string {
 	return "🧪 Auto-generated a DRYRUN PR: "
 }
 
+func (d DryrunPRModifier) Labels() []string {
+	return nil
+}
+
+func (d DryrunPRModifier) Rollback() bool {
+	return false
+}
+
 func NewDryrunPRModifier() DryrunPRModifier {
 	return DryrunPRModifier{}
 }
+
+// RollbackPRModifier regenerates the downstream from the upstream commit 'SHA', e.g., to restore
+// a known-good state.
+type RollbackPRModifier struct {
+	SHA string
+}
+
+func (d RollbackPRModifier) TearDown() bool {
+	return false
+}
+
+func (d RollbackPRModifier) NoopMsg(repo GHRepo) string {
+	return fmt.Sprintf(noopMsgTemplate, "[ROLLBACK] ", repo.Org, repo.Name)
+}
+
+func (d RollbackPRModifier) BranchPostFix() string {
+	return "-rollback-" + shortSHA(d.SHA)
+}
+
+func (d RollbackPRModifier) TitleTag() string {
+	return fmt.Sprintf("[Rollback to %s] ", shortSHA(d.SHA))
+}
+
+func (d RollbackPRModifier) PostCommentPrefix() string {
+	return fmt.Sprintf("⏪ Auto-generated a ROLLBACK PR to %s: ", shortSHA(d.SHA))
+}
+
+func (d RollbackPRModifier) Labels() []string {
+	return []string{RollbackLabel}
+}
+
+func (d RollbackPRModifier) Rollback() bool {
+	return true
+}
+
+func NewRollbackPRModifier(sha string) RollbackPRModifier {
+	return RollbackPRModifier{SHA: sha}
+}
+
+// shortSHA abbreviates a commit SHA like GitHub does.
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
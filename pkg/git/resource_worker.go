@@ -6,16 +6,31 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
+	gogit "github.com/go-git/go-git/v5"
 	"github.com/go-logr/logr"
 	"github.com/spf13/afero"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"sigs.k8s.io/prow/pkg/git/v2"
 	"sigs.k8s.io/prow/pkg/github"
+	"sigs.k8s.io/yaml"
 
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/config"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/cost"
 	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/internal"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/inventory"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/plan"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/policy"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/quota"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/common/selector"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/common/selector/key"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/common/selector/operator"
 	"github.com/Huang-Wei/25-kubecon-jp/go/generated/infra/account"
 	"github.com/Huang-Wei/25-kubecon-jp/go/generated/tenant/resource"
 )
@@ -23,19 +38,45 @@ import (
 var (
 	checkoutBranchFmt = "auto-checkout-%d-to-%s%s"
 	GitHubURL         = "https://github.com"
+	// QuotaPath is the path of the quota config, relative to the upstream repo.
+	QuotaPath = "infra/quota.yaml"
+	// PolicyDir is the directory of the Rego policies, relative to the upstream repo.
+	PolicyDir = "policy"
+	// pullRequestBodyFmt starts the body of a downstream PR, and refers to its upstream PR.
+	pullRequestBodyFmt = "This is an auto-generated PR via prow bot from %s/%s/pull/%d."
+	upstreamRe         = regexp.MustCompile(`^This is an auto-generated PR via prow bot from ([^/\s]+)/([^/\s]+)/pull/(\d+)\.`)
+	// rolePrincipalRe matches the ARN of an IAM role or user.
+	rolePrincipalRe = regexp.MustCompile(`^arn:aws:iam::[0-9]+:(role|user)/[\w+=,.@/-]+$`)
+	// maxBodyLength is the size limit of the body of a PR or a comment on GitHub.
+	maxBodyLength = 65536
+	// truncatedNote ends a PR body or a comment cut at maxBodyLength.
+	truncatedNote = "\n\n... (truncated, see the changed files of the PR)"
 
-	ErrNothingToCommit          = errors.New("nothing to commit")
-	ErrPullRequestAlreadyExists = errors.New("pull request already exists")
+	ErrNothingToCommit = errors.New("nothing to commit")
 )
 
 var _ Worker = &ResourceWorker{}
 
 type ResourceWorker struct {
-	gc      git.ClientFactory
-	ghc     github.Client
-	botUser *github.UserData
-	email   string
-	logger  logr.Logger
+	gc         git.ClientFactory
+	ghc        github.Client
+	botUser    *github.UserData
+	email      string
+	signOff    bool
+	signer     func() gogit.Signer
+	backoff    wait.Backoff
+	states     StateStore
+	priceTable cost.PriceTable
+	logger     logr.Logger
+}
+
+// botSignature returns the identity of the bot in the generated commits.
+func (r *ResourceWorker) botSignature() Signature {
+	email := r.email
+	if email == "" {
+		email = r.botUser.Email
+	}
+	return Signature{Name: r.botUser.Login, Email: email}
 }
 
 func (r *ResourceWorker) GetPullRequest(org, repo string, number int) (*github.PullRequest, error) {
@@ -46,14 +87,43 @@ func (r *ResourceWorker) CreatePullRequest(
 	ctx context.Context,
 	upstreamRepo *GHRepo,
 	prModifier PullRequestModifier,
-	repo string,
-	accounts []*account.Account,
-	tenantTuples []*internal.TenantTuple,
+	mapping *config.Mapping,
+	upstreamConfig *UpstreamConfig,
 	codegenFunc CodegenFunc,
-) error {
-	downstreamRepo, err := r.CreateDownstreamRepo(repo, upstreamRepo)
+) (*Result, error) {
+	key := r.stateKey(upstreamRepo, prModifier, mapping)
+	state, err := r.states.Get(key)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	// Resume a previous run of the same merge commit, which failed after pushing the branch.
+	if state != nil && state.MergeSHA == upstreamRepo.MergeSHA {
+		r.logger.Info("resuming the pipeline", "step", state.Step, "branch", state.Branch)
+	} else {
+		var result *Result
+		if state, result, err = r.generatePullRequest(ctx, upstreamRepo, prModifier, mapping, upstreamConfig, codegenFunc); err != nil || result != nil {
+			return result, err
+		}
+		if err := r.states.Put(key, state); err != nil {
+			return nil, err
+		}
+	}
+	return r.publishPullRequest(ctx, key, state, prModifier)
+}
+
+// generatePullRequest generates the artifacts, and pushes them to the branch of the downstream PR.
+// It returns a result instead if no PR is to be opened.
+func (r *ResourceWorker) generatePullRequest(
+	ctx context.Context,
+	upstreamRepo *GHRepo,
+	prModifier PullRequestModifier,
+	mapping *config.Mapping,
+	upstreamConfig *UpstreamConfig,
+	codegenFunc CodegenFunc,
+) (*PipelineState, *Result, error) {
+	downstreamRepo, err := r.CreateDownstreamRepo(ctx, mapping.Downstream, mapping.PushMode == config.PushModeDirect, upstreamRepo)
+	if err != nil {
+		return nil, nil, err
 	}
 	defer func() {
 		if err := downstreamRepo.Client.Clean(); err != nil {
@@ -61,75 +131,491 @@ func (r *ResourceWorker) CreatePullRequest(
 		}
 	}()
 
-	downstreamBranch, err := r.CreateDownstreamBranch(upstreamRepo, downstreamRepo, prModifier)
+	downstreamBranch, err := r.CreateDownstreamBranch(ctx, upstreamRepo, downstreamRepo, prModifier, mapping)
 	if err != nil {
-		if errors.Is(err, ErrPullRequestAlreadyExists) {
-			return nil
-		}
-		return err
+		return nil, nil, err
 	}
+	existingNum := downstreamBranch.ExistingPullRequestNumber
 
 	dstDir := downstreamRepo.Client.Directory()
+	// outputRoot is where the codegen writes the output tree.
+	outputRoot := filepath.Join(dstDir, mapping.OutputRoot)
+	notes := &PullRequestNotes{}
+
+	// An existing PR is regenerated from scratch, and compared with its previous push.
+	var previousFiles plan.Files
+	if existingNum != 0 {
+		if previousFiles, err = r.snapshotPullRequest(downstreamRepo, downstreamBranch, outputRoot); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// A rollback PR shows the diff against the current state of the target branch.
+	var targetFiles plan.Files
+	if prModifier.Rollback() {
+		if targetFiles, err = plan.Snapshot(afero.NewOsFs(), outputRoot); err != nil {
+			return nil, nil, fmt.Errorf("failed to read the downstream artifacts: %w", err)
+		}
+	}
+
+	objectsBefore, err := inventory.Scan(afero.NewOsFs(), outputRoot)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to scan the downstream repo: %w", err)
+	}
 
 	// PR generation logic starts.
 	startPRGen := time.Now()
-	if err := codegenFunc(ctx, dstDir, accounts, tenantTuples); err != nil {
-		return fmt.Errorf("failed to generate PR: %w", err)
+	if err := codegenFunc(ctx, dstDir, upstreamConfig.Accounts, upstreamConfig.TenantTuples); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate PR: %w", err)
 	}
 	r.logger.WithValues("duration", time.Since(startPRGen)).Info("PR generation completed.")
 	// PR generation logic ends.
 
-	prNum, err := r.CommitChanges(dstDir, downstreamBranch, upstreamRepo, downstreamRepo, prModifier)
+	objectsAfter, err := inventory.Scan(afero.NewOsFs(), outputRoot)
 	if err != nil {
-		return err
+		return nil, nil, fmt.Errorf("failed to scan the generated artifacts: %w", err)
 	}
-	// Close the pr if needed.
-	if prModifier.TearDown() {
-		_ = r.ghc.ClosePullRequest(downstreamRepo.Org, downstreamRepo.Name, prNum)
+	objectChanges := plan.CompareObjects(objectsBefore, objectsAfter, &plan.Filter{})
+
+	warned := false
+	if upstreamConfig.Policies != nil {
+		result, err := upstreamConfig.Policies.Evaluate(ctx, upstreamConfig.Accounts, objectsAfter)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to evaluate policies: %w", err)
+		}
+		// Deny results block the downstream PR.
+		if len(result.Denies) != 0 {
+			r.logger.Info("denied by policies, skipping the downstream PR", "denies", len(result.Denies))
+			return nil, &Result{Comment: result.DenyMarkdown(PolicyDir)}, nil
+		}
+		if len(result.Warns) != 0 {
+			warned = true
+			notes.Body = append(notes.Body, result.WarnMarkdown())
+		}
 	}
-	return nil
+
+	autoMerge := mapping.AutoMerge != nil && !prModifier.TearDown()
+	if autoMerge {
+		if reason := autoMergeBlocker(mapping.AutoMerge, objectChanges, upstreamConfig.Accounts, warned); reason != "" {
+			autoMerge = false
+			notes.Body = append(notes.Body, fmt.Sprintf("🧑‍💻 This PR needs a review: %s.", reason))
+		} else {
+			notes.Body = append(notes.Body, "🤖 This PR only creates resources in low-risk envs. It's merged once the checks pass.")
+		}
+	}
+
+	if r.priceTable != nil {
+		costReport := cost.Estimate(r.priceTable, objectsBefore, objectsAfter).Markdown()
+		notes.Body = append(notes.Body, costReport)
+		notes.Comment = append(notes.Comment, costReport)
+	}
+
+	var changes []*plan.FileChange
+	if existingNum != 0 {
+		currentFiles, err := plan.Snapshot(afero.NewOsFs(), outputRoot)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read the generated artifacts: %w", err)
+		}
+		if changes = plan.Compare(previousFiles, currentFiles); len(changes) == 0 {
+			return nil, &Result{
+				PullRequestNumber: existingNum,
+				Comment:           fmt.Sprintf(noUpdateMsgTemplate, pullRequestURL(downstreamRepo, existingNum)),
+			}, nil
+		}
+	}
+
+	body := fmt.Sprintf(pullRequestBodyFmt, upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber)
+	// The change summary goes first, and its per-file details fill what is left of the body.
+	summary := plan.Markdown(objectChanges, maxBodyLength-len(withNotes(body, notes.Body))-len("\n\n"))
+	notes.Body = append([]string{summary}, notes.Body...)
+	if prModifier.Rollback() {
+		generatedFiles, err := plan.Snapshot(afero.NewOsFs(), outputRoot)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read the generated artifacts: %w", err)
+		}
+		// The diff fills what is left of the body after the other notes.
+		budget := maxBodyLength - len(withNotes(body, notes.Body)) - len("\n\n")
+		notes.Body = append(notes.Body, rollbackNote(upstreamRepo, mapping, plan.Compare(targetFiles, generatedFiles), budget))
+	}
+
+	if err := r.CommitChanges(ctx, dstDir, downstreamBranch, upstreamRepo, downstreamRepo); err != nil {
+		if errors.Is(err, ErrNothingToCommit) {
+			return nil, &Result{Comment: prModifier.NoopMsg(*downstreamRepo)}, nil
+		}
+		return nil, nil, err
+	}
+
+	from := fmt.Sprintf("%s/%s/pull/%v", upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber)
+	state := &PipelineState{
+		MergeSHA:          upstreamRepo.MergeSHA,
+		Step:              StepPushed,
+		DownstreamOrg:     downstreamRepo.Org,
+		DownstreamName:    downstreamRepo.Name,
+		Fork:              downstreamRepo.Fork,
+		TargetBranch:      downstreamBranch.TargetBranch,
+		Branch:            downstreamBranch.NewBranch,
+		Title:             fmt.Sprintf("%s%s from %s", prModifier.TitleTag(), mapping.Title, from),
+		Body:              withNotes(body, notes.Body),
+		PullRequestNumber: existingNum,
+		Labels:            prModifier.Labels(),
+		CommentNotes:      notes.Comment,
+	}
+	if autoMerge {
+		state.AutoMergeMethod = mapping.AutoMerge.Method
+		state.AutoMergeApprove = mapping.AutoMerge.Approve
+	}
+	if existingNum != 0 {
+		// Tell the reviewers of the downstream PR what the push changed.
+		state.UpdateComment = updateComment(upstreamRepo, changes)
+		state.ChangedFiles = len(changes)
+	}
+	return state, nil, nil
+}
+
+// publishPullRequest opens the downstream PR of a pushed branch, and records each completed step.
+func (r *ResourceWorker) publishPullRequest(ctx context.Context, key string, state *PipelineState, prModifier PullRequestModifier) (*Result, error) {
+	if state.Step == StepPushed {
+		num, err := r.ensurePullRequest(ctx, state)
+		if err != nil {
+			return nil, err
+		}
+		state.PullRequestNumber = num
+		state.Step = StepPullRequestOpened
+		if err := r.states.Put(key, state); err != nil {
+			return nil, err
+		}
+	}
+
+	if state.Step == StepPullRequestOpened {
+		// Close the pr if needed, and delete its branch. A PR left open is closed by the next
+		// run, while a branch left behind is deleted by the janitor.
+		if prModifier.TearDown() {
+			if err := r.retry(ctx, "closing the pull request", func() error {
+				return r.ghc.ClosePullRequest(state.DownstreamOrg, state.DownstreamName, state.PullRequestNumber)
+			}); err != nil {
+				return nil, fmt.Errorf("failed to close the pull request: %w", err)
+			}
+			_ = r.retry(ctx, "deleting the branch", func() error {
+				if state.Fork == "" {
+					return r.deleteBranch(state.DownstreamOrg, state.DownstreamName, state.Branch)
+				}
+				return r.deleteBranch(r.botUser.Login, state.Fork, state.Branch)
+			})
+		}
+		for _, label := range state.Labels {
+			if err := r.retry(ctx, "labeling the pull request", func() error {
+				return r.ghc.AddLabel(state.DownstreamOrg, state.DownstreamName, state.PullRequestNumber, label)
+			}); err != nil {
+				return nil, fmt.Errorf("failed to add label %q: %w", label, err)
+			}
+		}
+		if state.UpdateComment != "" {
+			if err := r.retry(ctx, "commenting on the downstream PR", func() error {
+				return r.ghc.CreateComment(state.DownstreamOrg, state.DownstreamName, state.PullRequestNumber, state.UpdateComment)
+			}); err != nil {
+				return nil, fmt.Errorf("failed to create comment: %w", err)
+			}
+		}
+		// A failed auto-merge leaves the PR to a review.
+		if state.AutoMergeMethod != "" {
+			if err := r.autoMerge(ctx, state); err != nil {
+				r.logger.Error(err, "failed to auto-merge the pull request")
+				state.CommentNotes = append(state.CommentNotes, fmt.Sprintf("⚠️ Failed to auto-merge the PR, it needs a review: %v", err))
+			} else {
+				state.CommentNotes = append(state.CommentNotes, "🤖 The PR is merged once the checks pass.")
+			}
+		}
+		state.Step = StepFinished
+		if err := r.states.Put(key, state); err != nil {
+			return nil, err
+		}
+	}
+
+	downstreamRepo := &GHRepo{Org: state.DownstreamOrg, Name: state.DownstreamName}
+	url := pullRequestURL(downstreamRepo, state.PullRequestNumber)
+	// Report the successful creation of auto-gen PR.
+	comment := prModifier.PostCommentPrefix() + url + "."
+	if state.UpdateComment != "" {
+		comment = fmt.Sprintf(updateMsgTemplate, url, state.ChangedFiles)
+	}
+	return &Result{
+		PullRequestNumber: state.PullRequestNumber,
+		Comment:           withNotes(comment, state.CommentNotes),
+	}, nil
+}
+
+// ensurePullRequest creates the downstream PR of the pushed branch, or updates it if it exists.
+// The PR is looked up again before creating it, so that a retry doesn't duplicate the PR of a
+// failed attempt.
+func (r *ResourceWorker) ensurePullRequest(ctx context.Context, state *PipelineState) (int, error) {
+	num := state.PullRequestNumber
+	err := r.retry(ctx, "opening the pull request", func() error {
+		if num == 0 {
+			var err error
+			if num, err = r.findPullRequest(state.DownstreamOrg, state.DownstreamName, state.Branch); err != nil {
+				return err
+			}
+		}
+		if num != 0 {
+			return r.ghc.UpdatePullRequest(state.DownstreamOrg, state.DownstreamName, num, &state.Title, &state.Body, nil, nil, nil)
+		}
+		head := state.Branch
+		if state.Fork != "" {
+			head = fmt.Sprintf("%s:%s", r.botUser.Login, state.Branch)
+		}
+		created, err := r.ghc.CreatePullRequest(state.DownstreamOrg, state.DownstreamName, state.Title, state.Body, head, state.TargetBranch, true)
+		if err != nil {
+			return err
+		}
+		num = created
+		return nil
+	})
+	if err != nil {
+		r.logger.Error(err, "failed to open pull request")
+		return 0, fmt.Errorf("pull request could not be opened: %w", err)
+	}
+	return num, nil
+}
+
+// findPullRequest returns the number of the open PR of 'branch', or 0 if there is none.
+func (r *ResourceWorker) findPullRequest(org, repo, branch string) (int, error) {
+	prs, err := r.ghc.GetPullRequests(org, repo)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get pull requests for %s/%s: %w", org, repo, err)
+	}
+	for _, pr := range prs {
+		if pr.Head.Ref == branch {
+			r.logger.WithValues("preexisting_pr", pr.HTMLURL).Info("PR already exists, updating it")
+			return pr.Number, nil
+		}
+	}
+	return 0, nil
+}
+
+// ClearPipelineState forgets the progress of the downstream PR once its result is reported,
+// so that the next run generates it again.
+func (r *ResourceWorker) ClearPipelineState(upstreamRepo *GHRepo, prModifier PullRequestModifier, mapping *config.Mapping) error {
+	return r.states.Delete(r.stateKey(upstreamRepo, prModifier, mapping))
+}
+
+func (r *ResourceWorker) stateKey(upstreamRepo *GHRepo, prModifier PullRequestModifier, mapping *config.Mapping) string {
+	return stateKey(upstreamRepo, mapping.Downstream, r.GetBranchName(upstreamRepo, mapping, prModifier))
+}
+
+func pullRequestURL(repo *GHRepo, number int) string {
+	return fmt.Sprintf("%s/%s/%s/pull/%d", GitHubURL, repo.Org, repo.Name, number)
+}
+
+// snapshotPullRequest reads the output tree of the existing PR, then checks out the new branch again.
+func (r *ResourceWorker) snapshotPullRequest(downstreamRepo *GHRepo, downstreamBranch *DownstreamBranch, outputRoot string) (plan.Files, error) {
+	num := downstreamBranch.ExistingPullRequestNumber
+	if err := downstreamRepo.Client.CheckoutPullRequest(num); err != nil {
+		return nil, fmt.Errorf("failed to checkout #%d: %w", num, err)
+	}
+	files, err := plan.Snapshot(afero.NewOsFs(), outputRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the artifacts of #%d: %w", num, err)
+	}
+	if err := downstreamRepo.Client.Checkout(downstreamBranch.NewBranch); err != nil {
+		return nil, fmt.Errorf("failed to checkout %s: %w", downstreamBranch.NewBranch, err)
+	}
+	return files, nil
+}
+
+// updateComment renders the changes of a push to an existing downstream PR.
+func updateComment(upstreamRepo *GHRepo, changes []*plan.FileChange) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🔄 Regenerated from %s/%s#%d at %s. Changes since the previous push:\n\n```\n",
+		upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber, upstreamRepo.MergeSHA)
+	_ = plan.Print(&sb, changes)
+	sb.WriteString("```")
+	return sb.String()
+}
+
+// rollbackNote introduces a rollback PR with its diff against the target branch. The diff is
+// truncated so that the note fits in 'limit' bytes, and left out if not even a line fits.
+func rollbackNote(upstreamRepo *GHRepo, mapping *config.Mapping, changes []*plan.FileChange, limit int) string {
+	for _, c := range changes {
+		c.Path = filepath.ToSlash(filepath.Join(mapping.OutputRoot, c.Path))
+	}
+	var diff strings.Builder
+	_ = plan.PrintUnified(&diff, changes)
+
+	intro := fmt.Sprintf("⏪ Rolls `%s` back to the state generated from %s/%s@%s. Diff against the current `%s`:",
+		mapping.TargetBranch, upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.MergeSHA, mapping.TargetBranch)
+	details := fmt.Sprintf("\n\n<details><summary>%d file(s) changed</summary>\n\n```diff\n%%s```\n\n</details>", len(changes))
+	unified := diff.String()
+	if len(intro)+len(details)+len(unified) > limit {
+		const suffix = "... (truncated, see the changed files of the PR)\n"
+		unified = truncateLines(unified, limit-len(intro)-len(details)-len(suffix))
+		if unified == "" {
+			return intro + " see the changed files of the PR."
+		}
+		unified += suffix
+	}
+	return intro + fmt.Sprintf(details, unified)
 }
 
 func (r *ResourceWorker) AddLabel(org, repo string, number int, label string) error {
 	return r.ghc.AddLabel(org, repo, number, label)
 }
 
+func (r *ResourceWorker) RemoveLabel(org, repo string, number int, label string) error {
+	return r.ghc.RemoveLabel(org, repo, number, label)
+}
+
+// IsMaintainer returns whether 'user' has the admin or maintain role on the 'org/repo' repo.
+// The permission API reports the maintain role as write, so the roles are read from the
+// permissions of the collaborators instead.
+func (r *ResourceWorker) IsMaintainer(org, repo, user string) (bool, error) {
+	collaborators, err := r.ghc.ListCollaborators(org, repo)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range collaborators {
+		if github.NormLogin(c.Login) == github.NormLogin(user) {
+			level := github.LevelFromPermissions(c.Permissions)
+			return level == github.Admin || level == github.Maintain, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *ResourceWorker) ResolveCommit(org, repo, ref string) (string, error) {
+	commit, err := r.ghc.GetSingleCommit(org, repo, ref)
+	if err != nil {
+		return "", err
+	}
+	return commit.SHA, nil
+}
+
+// UpstreamOf returns the upstream PR of a downstream PR opened by the bot, or nil if 'pr'
+// wasn't generated by the bot.
+func (r *ResourceWorker) UpstreamOf(pr *github.PullRequest) *GHRepo {
+	if pr.User.Login != r.botUser.Login {
+		return nil
+	}
+	match := upstreamRe.FindStringSubmatch(pr.Body)
+	if match == nil {
+		return nil
+	}
+	num, err := strconv.Atoi(match[3])
+	if err != nil {
+		return nil
+	}
+	return &GHRepo{Org: match[1], Name: match[2], PullRequestNumber: num}
+}
+
+// DownstreamPullRequests searches the PRs whose body refers to the upstream PR, and keeps
+// the ones the bot generated from it.
+func (r *ResourceWorker) DownstreamPullRequests(upstreamRepo *GHRepo, downstreams []string) ([]*github.PullRequest, error) {
+	body := fmt.Sprintf(pullRequestBodyFmt, upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber)
+	var prs []*github.PullRequest
+	for _, downstream := range downstreams {
+		org, repo, _ := strings.Cut(downstream, "/")
+		query := fmt.Sprintf("is:pr repo:%s in:body %q", downstream, body)
+		issues, err := r.ghc.FindIssuesWithOrg(org, query, "", false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search the PRs of %s: %w", downstream, err)
+		}
+		for _, issue := range issues {
+			// The search result has no merge state.
+			pr, err := r.ghc.GetPullRequest(org, repo, issue.Number)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get %s#%d: %w", downstream, issue.Number, err)
+			}
+			// The search matches the words of the body, not the exact upstream PR.
+			if up := r.UpstreamOf(pr); up != nil && up.Org == upstreamRepo.Org && up.Name == upstreamRepo.Name &&
+				up.PullRequestNumber == upstreamRepo.PullRequestNumber {
+				prs = append(prs, pr)
+			}
+		}
+	}
+	return prs, nil
+}
+
+// UpsertComment edits the bot's comment containing 'marker', or posts 'comment' if there is none.
+func (r *ResourceWorker) UpsertComment(org, repo string, number int, marker, comment string) error {
+	comments, err := r.ghc.ListIssueComments(org, repo, number)
+	if err != nil {
+		return fmt.Errorf("failed to list comments: %w", err)
+	}
+	for _, c := range comments {
+		if c.User.Login == r.botUser.Login && strings.Contains(c.Body, marker) {
+			return r.ghc.EditComment(org, repo, c.ID, comment)
+		}
+	}
+	return r.CreateComment(org, repo, number, comment)
+}
+
+func (r *ResourceWorker) CreateComment(org, repo string, number int, comment string) error {
+	return r.retry(context.Background(), "commenting", func() error {
+		return r.ghc.CreateComment(org, repo, number, comment)
+	})
+}
+
 func (r *ResourceWorker) Logger() logr.Logger {
 	return r.logger
 }
 
 // FetchUpstreamConfigs fetches and parses the user input configured in upstream repo.
-func (r *ResourceWorker) FetchUpstreamConfigs(ctx context.Context, upstreamRepo *GHRepo) ([]*account.Account, []*internal.TenantTuple, error) {
-	_, err := r.ghc.GetPullRequestChanges(upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber)
-	if err != nil {
-		return nil, nil, fmt.Errorf("cannot list PR changes: %w", err)
+func (r *ResourceWorker) FetchUpstreamConfigs(ctx context.Context, upstreamRepo *GHRepo) (*UpstreamConfig, error) {
+	if err := r.retry(ctx, "listing PR changes", func() error {
+		_, err := r.ghc.GetPullRequestChanges(upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("cannot list PR changes: %w", err)
 	}
 
-	uRepoClient, err := r.gc.ClientFor(upstreamRepo.Org, upstreamRepo.Name)
-	if err != nil {
-		return nil, nil, err
+	var uRepoClient git.RepoClient
+	if err := r.retry(ctx, "cloning", func() (err error) {
+		uRepoClient, err = r.gc.ClientFor(upstreamRepo.Org, upstreamRepo.Name)
+		return err
+	}); err != nil {
+		return nil, err
 	}
 	if err := uRepoClient.Checkout(upstreamRepo.MergeSHA); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	if err := uRepoClient.CheckoutNewBranch(fmt.Sprintf("src-%v", upstreamRepo.PullRequestNumber)); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	uDir := uRepoClient.Directory()
 
+	return LoadUpstreamConfig(ctx, uRepoClient.Directory())
+}
+
+// LoadUpstreamConfig parses the user input of an upstream repo checked out at 'uDir'.
+func LoadUpstreamConfig(ctx context.Context, uDir string) (*UpstreamConfig, error) {
 	// Parse infra/account.pkl
 	accounts, err := parseAccounts(ctx, afero.NewOsFs(), filepath.Join(uDir, "infra"))
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	// Iterate upstream repo's `tenants/` folder.
 	tenantTuples, err := parseTenants(ctx, afero.NewOsFs(), filepath.Join(uDir, "tenants"))
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+
+	// Parse the optional infra/quota.yaml
+	quotaConfig, err := quota.Load(afero.NewOsFs(), filepath.Join(uDir, QuotaPath))
+	if err != nil {
+		return nil, err
 	}
 
-	return accounts, tenantTuples, nil
+	// Compile the optional policy/*.rego
+	policies, err := policy.Load(ctx, afero.NewOsFs(), filepath.Join(uDir, PolicyDir))
+	if err != nil {
+		return nil, err
+	}
+
+	return &UpstreamConfig{
+		Accounts:     accounts,
+		TenantTuples: tenantTuples,
+		Quota:        quotaConfig,
+		Policies:     policies,
+	}, nil
 }
 
 // parseAccounts parses `infra/account.pkl` and return a list of Account.
@@ -156,6 +642,26 @@ func parseAccounts(ctx context.Context, fs afero.Fs, rootPath string) ([]*accoun
 func parseTenants(ctx context.Context, fs afero.Fs, rootPath string) ([]*internal.TenantTuple, error) {
 	var tenantTuples []*internal.TenantTuple
 
+	paths, err := tenantFiles(fs, rootPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		tuple, err := parseTenant(ctx, fs, rootPath, path)
+		if err != nil {
+			return nil, err
+		}
+		// Add to tenants slice
+		tenantTuples = append(tenantTuples, tuple)
+	}
+
+	return tenantTuples, nil
+}
+
+// tenantFiles returns the paths of the resource.pkl files under the `tenants/` folder.
+func tenantFiles(fs afero.Fs, rootPath string) ([]string, error) {
+	var paths []string
+
 	// Walk through the root directory
 	err := afero.Walk(fs, rootPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -173,105 +679,231 @@ func parseTenants(ctx context.Context, fs afero.Fs, rootPath string) ([]*interna
 			return fmt.Errorf("failed to get relative path: %w", err)
 		}
 
-		// Extract tenant_id and env from the path
 		// Expected structure: tenants/<tenant_id>/<env>/resource.pkl
-		pathParts := strings.Split(relPath, "/")
-		if len(pathParts) < 3 {
+		if len(strings.Split(relPath, "/")) < 3 {
 			// Skip if path doesn't match expected structure
 			return nil
 		}
 
-		// Parse resource.pkl
-		resourceConfig, err := resource.LoadFromPath(ctx, path)
+		paths = append(paths, path)
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk directory tree: %w", err)
+	}
+
+	return paths, nil
+}
+
+// parseTenant parses a resource.pkl, along with its extension.yaml, into a tenant tuple.
+func parseTenant(ctx context.Context, fs afero.Fs, rootPath, path string) (*internal.TenantTuple, error) {
+	relPath, err := filepath.Rel(rootPath, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get relative path: %w", err)
+	}
+	// Extract tenant_id and env from the path
+	pathParts := strings.Split(relPath, "/")
+
+	// Parse resource.pkl
+	resourceConfig, err := resource.LoadFromPath(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse '%s': %w", path, err)
+	}
+
+	// Parse the optional extension.yaml next to resource.pkl.
+	extension, err := parseExtension(fs, filepath.Join(filepath.Dir(path), "extension.yaml"), resourceConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &internal.TenantTuple{
+		TenantID:       pathParts[0],
+		Env:            pathParts[1],
+		ResourceConfig: resourceConfig,
+		Extension:      extension,
+	}, nil
+}
+
+// FileError is an error of a file in the upstream repo.
+type FileError struct {
+	// Path is relative to the upstream repo.
+	Path string
+	Err  error
+}
+
+// CollectUpstreamConfig is the lenient version of LoadUpstreamConfig: each account.pkl and
+// resource.pkl is parsed independently, so that a broken file doesn't hide the errors of
+// the others. The returned config only holds the files that were parsed successfully.
+func CollectUpstreamConfig(ctx context.Context, uDir string) (*UpstreamConfig, []*FileError) {
+	fs := afero.NewOsFs()
+	upstreamConfig := &UpstreamConfig{}
+	var fileErrs []*FileError
+
+	accounts, err := parseAccounts(ctx, fs, filepath.Join(uDir, "infra"))
+	if err != nil {
+		fileErrs = append(fileErrs, &FileError{Path: "infra/account.pkl", Err: err})
+	}
+	upstreamConfig.Accounts = accounts
+
+	tenantsDir := filepath.Join(uDir, "tenants")
+	paths, err := tenantFiles(fs, tenantsDir)
+	if err != nil {
+		fileErrs = append(fileErrs, &FileError{Path: "tenants", Err: err})
+	}
+	for _, path := range paths {
+		tuple, err := parseTenant(ctx, fs, tenantsDir, path)
 		if err != nil {
-			return fmt.Errorf("failed to parse '%s': %w", path, err)
+			relPath, _ := filepath.Rel(uDir, path)
+			fileErrs = append(fileErrs, &FileError{Path: filepath.ToSlash(relPath), Err: err})
+			continue
 		}
+		upstreamConfig.TenantTuples = append(upstreamConfig.TenantTuples, tuple)
+	}
 
-		// Add to tenants slice
-		tenantTuples = append(tenantTuples, &internal.TenantTuple{
-			TenantID:       pathParts[0],
-			Env:            pathParts[1],
-			ResourceConfig: resourceConfig,
-		})
+	return upstreamConfig, fileErrs
+}
 
-		return nil
-	})
+// parseExtension parses the given `extension.yaml` and validates it against the resource config.
+// It returns nil if the file doesn't exist.
+func parseExtension(fs afero.Fs, path string, resourceConfig *resource.ResourceConfig) (*internal.Extension, error) {
+	exists, err := afero.Exists(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if file exists %s: %w", path, err)
+	}
+	if !exists {
+		return nil, nil
+	}
 
+	data, err := afero.ReadFile(fs, path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to walk directory tree: %w", err)
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var extension internal.Extension
+	if err := yaml.UnmarshalStrict(data, &extension); err != nil {
+		return nil, fmt.Errorf("failed to parse '%s': %w", path, err)
 	}
 
-	return tenantTuples, nil
+	buckets := sets.New[string]()
+	if resourceConfig != nil {
+		for _, bucket := range resourceConfig.Buckets {
+			buckets.Insert(bucket.Name)
+		}
+	}
+	var errs []error
+	for _, name := range sets.List(sets.KeySet(extension.BucketOptOuts)) {
+		optOut := extension.BucketOptOuts[name]
+		if !buckets.Has(name) {
+			errs = append(errs, fmt.Errorf("bucketOptOuts: bucket %q is not defined", name))
+			continue
+		}
+		if optOut == nil || (!optOut.PublicAccess && !optOut.Versioning && !optOut.Encryption) {
+			errs = append(errs, fmt.Errorf("bucketOptOuts: bucket %q doesn't opt out of anything", name))
+			continue
+		}
+		if strings.TrimSpace(optOut.Reason) == "" {
+			errs = append(errs, fmt.Errorf("bucketOptOuts: bucket %q must provide a reason", name))
+		}
+	}
+	queues := sets.New[string]()
+	for i, queue := range extension.Queues {
+		switch {
+		case queue == nil || queue.Name == "":
+			errs = append(errs, fmt.Errorf("queues[%d]: name must be specified", i))
+			continue
+		case queues.Has(queue.Name):
+			errs = append(errs, fmt.Errorf("queues[%d]: duplicated queue %q", i, queue.Name))
+		case queue.Region == "":
+			errs = append(errs, fmt.Errorf("queues[%d]: region must be specified", i))
+		}
+		queues.Insert(queue.Name)
+		for j, req := range queue.Selector {
+			if err := validateRequirement(req); err != nil {
+				errs = append(errs, fmt.Errorf("queues[%d].selector[%d]: %w", i, j, err))
+			}
+		}
+	}
+	for i, principal := range extension.RolePrincipals {
+		// The root of an account would let any of its principals assume the roles.
+		if !rolePrincipalRe.MatchString(principal) {
+			errs = append(errs, fmt.Errorf("rolePrincipals[%d]: %q is not the ARN of an IAM role or user", i, principal))
+		}
+	}
+
+	if len(errs) != 0 {
+		return nil, fmt.Errorf("invalid '%s': %w", path, utilerrors.NewAggregate(errs))
+	}
+
+	return &extension, nil
+}
+
+// validateRequirement performs the validations that pkl does on a selector.Requirment.
+func validateRequirement(req *selector.Requirment) error {
+	if req == nil {
+		return errors.New("requirement must not be empty")
+	}
+	if err := new(key.Key).UnmarshalBinary([]byte(req.Key)); err != nil {
+		return err
+	}
+	if err := new(operator.Operator).UnmarshalBinary([]byte(req.Operator)); err != nil {
+		return err
+	}
+	return nil
 }
 
-func (r *ResourceWorker) CreateDownstreamRepo(repo string, upstreamRepo *GHRepo) (*GHRepo, error) {
+// CreateDownstreamRepo clones the downstream repo. Unless the branches are pushed 'direct'ly
+// to the downstream repo, it ensures the bot's fork exists.
+func (r *ResourceWorker) CreateDownstreamRepo(ctx context.Context, repo string, direct bool, upstreamRepo *GHRepo) (*GHRepo, error) {
 	startTime := time.Now()
 	dOrg, dRepo := strings.Split(repo, "/")[0], strings.Split(repo, "/")[1]
 	// Ensure downstream repo's fork exists.
-	forkName, err := r.ghc.EnsureFork(r.botUser.Login, dOrg, dRepo)
-	if err != nil {
-		r.logger.Error(err, "failed to ensure fork exists")
-		resp := fmt.Sprintf("cannot fork %s/%s: %v", upstreamRepo.Org, upstreamRepo.Name, err)
-		if err = r.ghc.CreateComment(upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber, resp); err != nil {
-			return nil, err
+	var forkName string
+	if !direct {
+		if err := r.retry(ctx, "forking", func() (err error) {
+			forkName, err = r.ghc.EnsureFork(r.botUser.Login, dOrg, dRepo)
+			return err
+		}); err != nil {
+			r.logger.Error(err, "failed to ensure fork exists")
+			return nil, fmt.Errorf("cannot fork %s/%s: %w", dOrg, dRepo, err)
 		}
-		return nil, errors.New(resp)
 	}
 
-	dRepoClient, err := r.gc.ClientFor(dOrg, dRepo)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get git client for %s/%s: %w", upstreamRepo.Org, forkName, err)
+	var dRepoClient git.RepoClient
+	if err := r.retry(ctx, "cloning", func() (err error) {
+		dRepoClient, err = r.gc.ClientFor(dOrg, dRepo)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("failed to get git client for %s/%s: %w", dOrg, dRepo, err)
 	}
-	r.logger.WithValues("duration", time.Since(startTime)).Info("Finished forking target repo.")
+	r.logger.WithValues("duration", time.Since(startTime)).Info("Finished cloning target repo.")
 
 	return &GHRepo{
 		Org:    dOrg,
 		Name:   dRepo,
+		Fork:   forkName,
 		Client: dRepoClient,
 	}, nil
 }
 
-func (r *ResourceWorker) CreateDownstreamBranch(upstreamRepo, downstreamRepo *GHRepo, prModifier PullRequestModifier) (*DownstreamBranch, error) {
-	targetBranch, newBranch := r.GetBranchNames(upstreamRepo, downstreamRepo, prModifier)
+func (r *ResourceWorker) CreateDownstreamBranch(ctx context.Context, upstreamRepo, downstreamRepo *GHRepo, prModifier PullRequestModifier, mapping *config.Mapping) (*DownstreamBranch, error) {
+	targetBranch := mapping.TargetBranch
+	newBranch := r.GetBranchName(upstreamRepo, mapping, prModifier)
 
 	startTime := time.Now()
 	if err := downstreamRepo.Client.Checkout(targetBranch); err != nil {
 		r.logger.Error(err, "failed to checkout target branch")
-		resp := fmt.Sprintf("cannot checkout `%s`: %v", targetBranch, err)
-		return nil, r.ghc.CreateComment(upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber, resp)
+		return nil, fmt.Errorf("cannot checkout `%s`: %w", targetBranch, err)
 	}
 	r.logger.WithValues("duration", time.Since(startTime)).Info("Checked out target branch.")
 
-	// Set user.name and user.email.
-	if err := downstreamRepo.Client.Config("user.name", r.botUser.Login); err != nil {
-		return nil, fmt.Errorf("failed to configure git user: %w", err)
-	}
-	email := r.email
-	if email == "" {
-		email = r.botUser.Email
-	}
-	if err := downstreamRepo.Client.Config("user.email", email); err != nil {
-		return nil, fmt.Errorf("failed to configure git email: %w", err)
-	}
-
 	// New branch for the automated PR.
-	// Check if there is already a PR created. If so, find the PR and link to it.
-	prs, err := r.ghc.GetPullRequests(downstreamRepo.Org, downstreamRepo.Name)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get pull requests for %s/%s: %w", downstreamRepo.Org, downstreamRepo.Name, err)
-	}
-	for _, pr := range prs {
-		r.logger.Info(fmt.Sprintf("pull request reference: %v", pr.Head.Ref))
-		if pr.Head.Ref == newBranch {
-			r.logger.WithValues("preexisting_pr", pr.HTMLURL).Info("PR already exists")
-			resp := fmt.Sprintf("Looks like #%d has already been created in %s", pr.Number, pr.HTMLURL)
-			if err = r.ghc.CreateComment(upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber, resp); err != nil {
-				return nil, err
-			}
-			return &DownstreamBranch{
-				ExistingPullRequestNumber: pr.Number,
-			}, ErrPullRequestAlreadyExists
-		}
+	// Check if there is already a PR created. If so, its branch is overwritten.
+	var existingNum int
+	if err := r.retry(ctx, "listing pull requests", func() (err error) {
+		existingNum, err = r.findPullRequest(downstreamRepo.Org, downstreamRepo.Name, newBranch)
+		return err
+	}); err != nil {
+		return nil, err
 	}
 	// Create the branch for the auto-generated PR.
 	if err := downstreamRepo.Client.CheckoutNewBranch(newBranch); err != nil {
@@ -279,66 +911,126 @@ func (r *ResourceWorker) CreateDownstreamBranch(upstreamRepo, downstreamRepo *GH
 	}
 
 	return &DownstreamBranch{
-		TargetBranch: targetBranch,
-		NewBranch:    newBranch,
+		TargetBranch:              targetBranch,
+		NewBranch:                 newBranch,
+		ExistingPullRequestNumber: existingNum,
 	}, nil
 }
 
-func (r *ResourceWorker) GetBranchNames(upstreamRepo, _ *GHRepo, prModifier PullRequestModifier) (string, string) {
-	// If the downstream repo's default branch is "master", tweak it here.
-	targetBranch := "main"
-
-	newBranch := fmt.Sprintf(checkoutBranchFmt, upstreamRepo.PullRequestNumber, targetBranch, prModifier.BranchPostFix())
-	return targetBranch, newBranch
+// GetBranchName returns the name of the branch that is merged into the target branch of the mapping.
+func (r *ResourceWorker) GetBranchName(upstreamRepo *GHRepo, mapping *config.Mapping, prModifier PullRequestModifier) string {
+	return mapping.BranchPrefix + fmt.Sprintf(checkoutBranchFmt, upstreamRepo.PullRequestNumber, mapping.TargetBranch, prModifier.BranchPostFix())
 }
 
-func (r *ResourceWorker) CommitChanges(dstDir string, downstreamBranch *DownstreamBranch, upstreamRepo, downstreamRepo *GHRepo, prModifier PullRequestModifier) (int, error) {
-	commitMsg := "autogenerated"
-	// There is a NPE issue when using r.Commit(). Hack it around..
-	// if err := r.Commit("Fake changes on Mitosis", ""); err != nil {
-	if err := commit(dstDir, commitMsg); err != nil {
+// CommitChanges commits the generated artifacts, and pushes them to the branch of the downstream PR.
+func (r *ResourceWorker) CommitChanges(ctx context.Context, dstDir string, downstreamBranch *DownstreamBranch, upstreamRepo, downstreamRepo *GHRepo) error {
+	c := &Commit{
+		Message: commitMessage(upstreamRepo),
+		Author:  r.botSignature(),
+		SignOff: r.signOff,
+	}
+	if r.signer != nil {
+		c.Signer = r.signer()
+	}
+	// Credit the upstream author, whose change the commit is generated from.
+	if upstreamRepo.Author != "" {
+		c.CoAuthors = append(c.CoAuthors, Signature{Name: upstreamRepo.Author, Email: upstreamRepo.AuthorEmail})
+	}
+	if err := commit(dstDir, c); err != nil {
 		if errors.Is(err, ErrNothingToCommit) {
-			return 0, r.ghc.CreateComment(upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber, prModifier.NoopMsg(*downstreamRepo))
+			return err
 		}
-
-		errs := []error{fmt.Errorf("failed to `git add & git commit`: %w", err)}
 		r.logger.Error(err, "failed to apply PR on top of target branch")
-		resp := fmt.Sprintf("#%d failed to apply on top of branch %q:\n```\n%v\n```", upstreamRepo.PullRequestNumber, downstreamBranch.TargetBranch, err)
-		if err := r.ghc.CreateComment(upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber, resp); err != nil {
-			errs = append(errs, fmt.Errorf("failed to create comment: %w", err))
-		}
-		return 0, utilerrors.NewAggregate(errs)
+		return fmt.Errorf("#%d failed to apply on top of branch %q: %w", upstreamRepo.PullRequestNumber, downstreamBranch.TargetBranch, err)
 	}
-	// Push the new branch in the bot's fork.
-	if err := downstreamRepo.Client.PushToFork(downstreamBranch.NewBranch, true); err != nil {
+	// Push the new branch in the bot's fork, or in the downstream repo without a fork.
+	// The push is forced, so that it can be retried.
+	if err := r.retry(ctx, "pushing", func() error {
+		if downstreamRepo.Fork == "" {
+			return downstreamRepo.Client.PushToCentral(downstreamBranch.NewBranch, true)
+		}
+		return downstreamRepo.Client.PushToFork(downstreamBranch.NewBranch, true)
+	}); err != nil {
 		r.logger.Error(err, "failed to push auto-generated changes to GitHub")
-		resp := fmt.Sprintf("failed to push auto-generated changes in GitHub: %v", err)
-		return 0, utilerrors.NewAggregate([]error{err, r.ghc.CreateComment(upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber, resp)})
+		return fmt.Errorf("failed to push auto-generated changes in GitHub: %w", err)
 	}
-	// Last step to create the PR.
-	from := fmt.Sprintf("%s/%s/pull/%v", upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber)
-	title := fmt.Sprintf("%s🇯🇵 25 KubeCon CodeGen from %s", prModifier.TitleTag(), from)
-	head := fmt.Sprintf("%s:%s", r.botUser.Login, downstreamBranch.NewBranch)
-	createdNum, err := r.ghc.CreatePullRequest(downstreamRepo.Org, downstreamRepo.Name, title,
-		fmt.Sprintf("This is an auto-generated PR via prow bot from %s.", from), head, downstreamBranch.TargetBranch, true)
-	if err != nil {
-		r.logger.Error(err, "failed to create new pull request")
-		resp := fmt.Sprintf("new pull request could not be created: %v", err)
-		return 0, utilerrors.NewAggregate([]error{err, r.ghc.CreateComment(upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber, resp)})
+	return nil
+}
+
+// commitMessage describes the upstream PR that the generated commit comes from.
+func commitMessage(upstreamRepo *GHRepo) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Generate artifacts from %s/%s#%d\n\n", upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber)
+	fmt.Fprintf(&sb, "Upstream PR: %s\n", pullRequestURL(upstreamRepo, upstreamRepo.PullRequestNumber))
+	fmt.Fprintf(&sb, "Merge SHA: %s\n", upstreamRepo.MergeSHA)
+	if upstreamRepo.Author != "" {
+		fmt.Fprintf(&sb, "Author: @%s\n", upstreamRepo.Author)
+	}
+	return sb.String()
+}
+
+// withNotes appends the markdown sections to 'text', and truncates the result to the size
+// limit of a PR body. The code blocks and the <details> cut by the truncation are closed, so
+// that the truncated note isn't swallowed by them.
+func withNotes(text string, notes []string) string {
+	for _, note := range notes {
+		text += "\n\n" + note
 	}
+	if len(text) <= maxBodyLength {
+		return text
+	}
+	limit := maxBodyLength - len(truncatedNote)
+	text = truncateLines(text, limit)
+	closing := closingMarkdown(text)
+	for len(text)+len(closing) > limit {
+		text = truncateLines(text, limit-len(closing))
+		closing = closingMarkdown(text)
+	}
+	return text + closing + truncatedNote
+}
+
+// closingMarkdown returns the lines closing the code block and the <details> left open at the
+// end of 'text'.
+func closingMarkdown(text string) string {
+	fenced, details := false, 0
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "```"):
+			fenced = !fenced
+		case fenced:
+		case strings.HasPrefix(line, "<details"):
+			details++
+		case strings.HasPrefix(line, "</details>") && details > 0:
+			details--
+		}
+	}
+	var sb strings.Builder
+	if fenced {
+		sb.WriteString("```\n")
+	}
+	sb.WriteString(strings.Repeat("</details>\n", details))
+	return sb.String()
+}
 
-	// Comment on the original PR about the successful creation of auto-gen PR.
-	resp := fmt.Sprintf(`%s%s/%s/%s/pull/%d.`, prModifier.PostCommentPrefix(), GitHubURL, downstreamRepo.Org, downstreamRepo.Name, createdNum)
-	if err := r.ghc.CreateComment(upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber, resp); err != nil {
-		return 0, fmt.Errorf("failed to create comment: %w", err)
+// truncateLines keeps the whole lines of 'text' within 'limit' bytes.
+func truncateLines(text string, limit int) string {
+	if len(text) <= limit {
+		return text
 	}
-	return createdNum, nil
+	if limit <= 0 {
+		return ""
+	}
+	return text[:strings.LastIndex(text[:limit], "\n")+1]
 }
 
 type ResourceWorkerOption func(*ResourceWorker)
 
 func NewResourceWorker(opts ...ResourceWorkerOption) *ResourceWorker {
-	resWorker := &ResourceWorker{}
+	resWorker := &ResourceWorker{
+		backoff: DefaultBackoff,
+		states:  NewMemoryStateStore(),
+	}
 	for _, opt := range opts {
 		opt(resWorker)
 	}
@@ -369,8 +1061,44 @@ func WithEmail(email string) ResourceWorkerOption {
 	}
 }
 
+// WithSignOff adds a DCO Signed-off-by trailer to the generated commits.
+func WithSignOff(signOff bool) ResourceWorkerOption {
+	return func(rw *ResourceWorker) {
+		rw.signOff = signOff
+	}
+}
+
+// WithSigner signs the generated commits with the signer it returns. It's called for every
+// commit, so that the signing key can be rotated.
+func WithSigner(signer func() gogit.Signer) ResourceWorkerOption {
+	return func(rw *ResourceWorker) {
+		rw.signer = signer
+	}
+}
+
+// WithBackoff sets the backoff of the retried steps.
+func WithBackoff(backoff wait.Backoff) ResourceWorkerOption {
+	return func(rw *ResourceWorker) {
+		rw.backoff = backoff
+	}
+}
+
+// WithStateStore sets where the progress of the downstream PRs is recorded.
+func WithStateStore(states StateStore) ResourceWorkerOption {
+	return func(rw *ResourceWorker) {
+		rw.states = states
+	}
+}
+
 func WithLogger(logger logr.Logger) ResourceWorkerOption {
 	return func(rw *ResourceWorker) {
 		rw.logger = logger
 	}
 }
+
+// WithPriceTable sets the price table used to estimate the cost of the generated PRs.
+func WithPriceTable(priceTable cost.PriceTable) ResourceWorkerOption {
+	return func(rw *ResourceWorker) {
+		rw.priceTable = priceTable
+	}
+}
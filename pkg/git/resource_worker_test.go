@@ -2,14 +2,21 @@ package git
 
 import (
 	"context"
+	"errors"
 	"os/exec"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/spf13/afero"
+	"sigs.k8s.io/prow/pkg/github"
 
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/config"
 	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/internal"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/plan"
 	"github.com/Huang-Wei/25-kubecon-jp/go/generated/common/selector"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/common/selector/key"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/common/selector/operator"
 	"github.com/Huang-Wei/25-kubecon-jp/go/generated/tenant/resource"
 )
 
@@ -108,3 +115,395 @@ func Test_parseTenants(t *testing.T) {
 		})
 	}
 }
+
+func Test_parseExtension(t *testing.T) {
+	resourceConfig := &resource.ResourceConfig{
+		Buckets: []*resource.Bucket{
+			{Name: "foo"},
+			{Name: "bar"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    *internal.Extension
+		wantErr bool
+	}{
+		{
+			name: "no extension.yaml",
+		},
+		{
+			name: "valid opt-outs",
+			content: `bucketOptOuts:
+  foo:
+    publicAccess: true
+    reason: hosts a static website
+  bar:
+    versioning: true
+    encryption: true
+    reason: scratch space
+`,
+			want: &internal.Extension{
+				BucketOptOuts: map[string]*internal.BucketOptOut{
+					"foo": {PublicAccess: true, Reason: "hosts a static website"},
+					"bar": {Versioning: true, Encryption: true, Reason: "scratch space"},
+				},
+			},
+		},
+		{
+			name:    "valid role principals",
+			content: "rolePrincipals:\n- arn:aws:iam::123456789012:role/ci\n",
+			want:    &internal.Extension{RolePrincipals: []string{"arn:aws:iam::123456789012:role/ci"}},
+		},
+		{
+			name:    "account root as a role principal",
+			content: "rolePrincipals:\n- arn:aws:iam::123456789012:root\n",
+			wantErr: true,
+		},
+		{
+			name: "valid queues",
+			content: `queues:
+- name: foo
+  region: us-east-1
+- name: bar
+  region: us-west-2
+  selector:
+  - key: cloudProvider
+    operator: In
+    values:
+    - gcp
+`,
+			want: &internal.Extension{
+				Queues: []*internal.Queue{
+					{Name: "foo", Region: "us-east-1"},
+					{
+						Name:   "bar",
+						Region: "us-west-2",
+						Selector: []*selector.Requirment{
+							{Key: key.CloudProvider, Operator: operator.In, Values: []string{"gcp"}},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "duplicated queues",
+			content: `queues:
+- name: foo
+  region: us-east-1
+- name: foo
+  region: us-west-2
+`,
+			wantErr: true,
+		},
+		{
+			name: "queue with an invalid selector",
+			content: `queues:
+- name: foo
+  region: us-east-1
+  selector:
+  - key: team
+    operator: In
+    values:
+    - foo
+`,
+			wantErr: true,
+		},
+		{
+			name: "opt-out without a reason",
+			content: `bucketOptOuts:
+  foo:
+    publicAccess: true
+`,
+			wantErr: true,
+		},
+		{
+			name: "opt-out of nothing",
+			content: `bucketOptOuts:
+  foo:
+    reason: no idea
+`,
+			wantErr: true,
+		},
+		{
+			name: "opt-out of an unknown bucket",
+			content: `bucketOptOuts:
+  baz:
+    versioning: true
+    reason: typo
+`,
+			wantErr: true,
+		},
+		{
+			name: "unknown field",
+			content: `bucketOptOut:
+  foo:
+    versioning: true
+    reason: typo
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			path := "/tenants/foo/dev/extension.yaml"
+			if tt.content != "" {
+				if err := afero.WriteFile(fs, path, []byte(tt.content), 0644); err != nil {
+					t.Fatalf("failed to write %s: %v", path, err)
+				}
+			}
+			got, err := parseExtension(fs, path, resourceConfig)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseExtension() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("parseExtension() = (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_updateComment(t *testing.T) {
+	upstreamRepo := &GHRepo{Org: "foo", Name: "infra", PullRequestNumber: 42, MergeSHA: "abc123"}
+	changes := []*plan.FileChange{
+		{Path: "_output/tenants/bar/aws-1234/us-east-1/bucket-A.yaml", Action: plan.Create},
+		{Path: "_output/tenants/bar/aws-1234/us-east-1/kustomization.yaml", Action: plan.Update},
+	}
+	want := "🔄 Regenerated from foo/infra#42 at abc123. Changes since the previous push:\n\n```\n" +
+		"+ _output/tenants/bar/aws-1234/us-east-1/bucket-A.yaml\n" +
+		"~ _output/tenants/bar/aws-1234/us-east-1/kustomization.yaml\n" +
+		"\nPlan: 1 to create, 1 to update, 0 to delete.\n```"
+	if diff := cmp.Diff(want, updateComment(upstreamRepo, changes)); diff != "" {
+		t.Errorf("updateComment() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_rollbackNote(t *testing.T) {
+	upstreamRepo := &GHRepo{Org: "foo", Name: "infra", PullRequestNumber: 42, MergeSHA: "abc123"}
+	mapping := &config.Mapping{TargetBranch: "main", OutputRoot: "generated"}
+	changes := []*plan.FileChange{
+		{Path: "_output/bucket-A.yaml", Action: plan.Delete, Before: []byte("name: A\n")},
+		{Path: "_output/bucket-B.yaml", Action: plan.Update, Before: []byte("name: B\nversioning: false\n"), After: []byte("name: B\nversioning: true\n")},
+	}
+	want := "⏪ Rolls `main` back to the state generated from foo/infra@abc123. Diff against the current `main`:\n\n" +
+		"<details><summary>2 file(s) changed</summary>\n\n```diff\n" +
+		"--- a/generated/_output/bucket-A.yaml\n+++ /dev/null\n@@ -1 +0,0 @@\n-name: A\n" +
+		"--- a/generated/_output/bucket-B.yaml\n+++ b/generated/_output/bucket-B.yaml\n@@ -1,2 +1,2 @@\n name: B\n-versioning: false\n+versioning: true\n" +
+		"```\n\n</details>"
+	if diff := cmp.Diff(want, rollbackNote(upstreamRepo, mapping, changes, maxBodyLength)); diff != "" {
+		t.Errorf("rollbackNote() mismatch (-want +got):\n%s", diff)
+	}
+
+	large := []*plan.FileChange{{Path: "large.yaml", Action: plan.Create, After: []byte(strings.Repeat("line\n", maxBodyLength))}}
+	note := rollbackNote(upstreamRepo, mapping, large, 1000)
+	if len(note) > 1000 || !strings.Contains(note, "line\n... (truncated, see the changed files of the PR)\n```") {
+		t.Errorf("rollbackNote() of a large diff is not truncated, got %d bytes", len(note))
+	}
+
+	want = "⏪ Rolls `main` back to the state generated from foo/infra@abc123. Diff against the current `main`: see the changed files of the PR."
+	if diff := cmp.Diff(want, rollbackNote(upstreamRepo, mapping, large, 100)); diff != "" {
+		t.Errorf("rollbackNote() without room for the diff mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_withNotes(t *testing.T) {
+	if diff := cmp.Diff("body\n\nnote-1\n\nnote-2", withNotes("body", []string{"note-1", "note-2"})); diff != "" {
+		t.Errorf("withNotes() mismatch (-want +got):\n%s", diff)
+	}
+
+	notes := []string{strings.Repeat("cost\n", maxBodyLength/10), strings.Repeat("warning\n", maxBodyLength/10)}
+	got := withNotes("body", notes)
+	if len(got) > maxBodyLength || !strings.HasSuffix(got, "warning\n"+truncatedNote) {
+		t.Errorf("withNotes() of large notes is not truncated, got %d bytes", len(got))
+	}
+
+	// The code block and the <details> of a plan cut by the truncation are closed.
+	planNote := "<details>\n<summary>Terraform plan</summary>\n\n```diff\n" + strings.Repeat("+ resource\n", maxBodyLength/10) + "```\n\n</details>"
+	got = withNotes("body", []string{planNote})
+	if len(got) > maxBodyLength || !strings.HasSuffix(got, "+ resource\n```\n</details>\n"+truncatedNote) {
+		t.Errorf("withNotes() of a large plan doesn't close its blocks, got %d bytes ending with %q", len(got), got[len(got)-100:])
+	}
+}
+
+func Test_closingMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "closed blocks",
+			text: "<details>\n<summary>a</summary>\n\n```\nplan\n```\n\n</details>\n",
+		},
+		{
+			name: "open code block",
+			text: "<details>\n<summary>a</summary>\n\n```\nplan\n",
+			want: "```\n</details>\n",
+		},
+		{
+			name: "details in a code block",
+			text: "```\n<details>\n",
+			want: "```\n",
+		},
+		{
+			name: "nested details",
+			text: "<details>\n<details>\n</details>\n<details>\n",
+			want: "</details>\n</details>\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := closingMarkdown(tt.text); got != tt.want {
+				t.Errorf("closingMarkdown() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_commitMessage(t *testing.T) {
+	upstreamRepo := &GHRepo{Org: "foo", Name: "infra", PullRequestNumber: 42, MergeSHA: "abc123", Author: "alice"}
+	want := `Generate artifacts from foo/infra#42
+
+Upstream PR: https://github.com/foo/infra/pull/42
+Merge SHA: abc123
+Author: @alice
+`
+	if diff := cmp.Diff(want, commitMessage(upstreamRepo)); diff != "" {
+		t.Errorf("commitMessage() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestResourceWorker_UpstreamOf(t *testing.T) {
+	r := NewResourceWorker(WithBotUser(&github.UserData{Login: "bot"}))
+	tests := []struct {
+		name  string
+		login string
+		body  string
+		want  *GHRepo
+	}{
+		{
+			name:  "generated PR",
+			login: "bot",
+			body:  "This is an auto-generated PR via prow bot from foo/infra/pull/42.\n\n#### 📋 Change summary",
+			want:  &GHRepo{Org: "foo", Name: "infra", PullRequestNumber: 42},
+		},
+		{
+			name:  "not opened by the bot",
+			login: "alice",
+			body:  "This is an auto-generated PR via prow bot from foo/infra/pull/42.",
+		},
+		{
+			name:  "not generated",
+			login: "bot",
+			body:  "Bump the base image",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr := &github.PullRequest{Body: tt.body}
+			pr.User.Login = tt.login
+			if diff := cmp.Diff(tt.want, r.UpstreamOf(pr)); diff != "" {
+				t.Errorf("UpstreamOf() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// searchGitHub finds the PRs of 'prs' whose repo is in the query.
+type searchGitHub struct {
+	github.Client
+	prs map[string][]*github.PullRequest
+}
+
+func (s *searchGitHub) FindIssuesWithOrg(org, query, sort string, asc bool) ([]github.Issue, error) {
+	var issues []github.Issue
+	for repo, prs := range s.prs {
+		if strings.Contains(query, "repo:"+repo+" ") {
+			for _, pr := range prs {
+				issues = append(issues, github.Issue{Number: pr.Number})
+			}
+		}
+	}
+	return issues, nil
+}
+
+func (s *searchGitHub) GetPullRequest(org, repo string, number int) (*github.PullRequest, error) {
+	for _, pr := range s.prs[org+"/"+repo] {
+		if pr.Number == number {
+			return pr, nil
+		}
+	}
+	return nil, errors.New("404 Not Found")
+}
+
+func TestResourceWorker_DownstreamPullRequests(t *testing.T) {
+	pr := func(number int, login, body string, merged bool) *github.PullRequest {
+		pr := &github.PullRequest{Number: number, Body: body, Merged: merged}
+		pr.User.Login = login
+		return pr
+	}
+	merged := pr(1, "bot", "This is an auto-generated PR via prow bot from foo/infra/pull/42.", true)
+	open := pr(7, "bot", "This is an auto-generated PR via prow bot from foo/infra/pull/42.", false)
+	ghc := &searchGitHub{prs: map[string][]*github.PullRequest{
+		"foo/gitops": {
+			merged,
+			pr(2, "bot", "This is an auto-generated PR via prow bot from foo/infra/pull/4.", false),
+			pr(3, "alice", "This is an auto-generated PR via prow bot from foo/infra/pull/42.", false),
+		},
+		"bar/gitops":   {open},
+		"baz/untapped": {pr(9, "bot", "This is an auto-generated PR via prow bot from foo/infra/pull/42.", false)},
+	}}
+	r := newTestWorker(ghc)
+	got, err := r.DownstreamPullRequests(&GHRepo{Org: "foo", Name: "infra", PullRequestNumber: 42}, []string{"foo/gitops", "bar/gitops"})
+	if err != nil {
+		t.Fatalf("DownstreamPullRequests() error = %v", err)
+	}
+	if diff := cmp.Diff([]*github.PullRequest{merged, open}, got); diff != "" {
+		t.Errorf("DownstreamPullRequests() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// collaboratorsGitHub lists the collaborators with their permissions.
+type collaboratorsGitHub struct {
+	github.Client
+	collaborators []github.User
+}
+
+func (c *collaboratorsGitHub) ListCollaborators(org, repo string) ([]github.User, error) {
+	return c.collaborators, nil
+}
+
+func TestResourceWorker_IsMaintainer(t *testing.T) {
+	ghc := &collaboratorsGitHub{collaborators: []github.User{
+		{Login: "Alice", Permissions: github.RepoPermissions{Pull: true, Triage: true, Push: true, Maintain: true, Admin: true}},
+		{Login: "bob", Permissions: github.RepoPermissions{Pull: true, Triage: true, Push: true, Maintain: true}},
+		{Login: "carol", Permissions: github.RepoPermissions{Pull: true, Triage: true, Push: true}},
+		{Login: "dave", Permissions: github.RepoPermissions{Pull: true}},
+	}}
+	r := newTestWorker(ghc)
+	tests := []struct {
+		user string
+		want bool
+	}{
+		{user: "alice", want: true},
+		{user: "bob", want: true},
+		{user: "carol", want: false},
+		{user: "dave", want: false},
+		{user: "mallory", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.user, func(t *testing.T) {
+			got, err := r.IsMaintainer("foo", "infra", tt.user)
+			if err != nil {
+				t.Fatalf("IsMaintainer() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("IsMaintainer() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
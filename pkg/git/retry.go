@@ -0,0 +1,39 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// DefaultBackoff is the backoff of the steps talking to GitHub: 4 attempts over about 14 seconds.
+var DefaultBackoff = wait.Backoff{
+	Duration: 2 * time.Second,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    4,
+}
+
+// retry runs the idempotent 'fn' until it succeeds, with the backoff of the worker.
+// It returns the error of the last attempt.
+func (r *ResourceWorker) retry(ctx context.Context, step string, fn func() error) error {
+	var lastErr error
+	attempt := 0
+	err := wait.ExponentialBackoffWithContext(ctx, r.backoff, func(context.Context) (bool, error) {
+		attempt++
+		if lastErr = fn(); lastErr != nil {
+			r.logger.Error(lastErr, "step failed", "step", step, "attempt", attempt)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		if lastErr != nil {
+			return fmt.Errorf("%s failed after %d attempt(s): %w", step, attempt, lastErr)
+		}
+		return fmt.Errorf("%s: %w", step, err)
+	}
+	return nil
+}
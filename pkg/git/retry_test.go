@@ -0,0 +1,204 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/prow/pkg/github"
+)
+
+// flakyGitHub fails the first call of each method, after performing it like a lost response.
+type flakyGitHub struct {
+	github.Client
+	prs      []github.PullRequest
+	comments []string
+	failed   map[string]bool
+	// closeErr fails every attempt to close a PR.
+	closeErr error
+	closed   []int
+}
+
+func (f *flakyGitHub) flake(method string) error {
+	if f.failed[method] {
+		return nil
+	}
+	f.failed[method] = true
+	return errors.New("502 Bad Gateway")
+}
+
+func (f *flakyGitHub) GetPullRequests(org, repo string) ([]github.PullRequest, error) {
+	return f.prs, nil
+}
+
+func (f *flakyGitHub) CreatePullRequest(org, repo, title, body, head, base string, canModify bool) (int, error) {
+	num := len(f.prs) + 1
+	pr := github.PullRequest{Number: num, Title: title}
+	pr.Head.Ref = strings.TrimPrefix(head, "bot:")
+	f.prs = append(f.prs, pr)
+	return num, f.flake("CreatePullRequest")
+}
+
+func (f *flakyGitHub) UpdatePullRequest(org, repo string, number int, title, body *string, open *bool, branch *string, canModify *bool) error {
+	return nil
+}
+
+func (f *flakyGitHub) CreateComment(org, repo string, number int, comment string) error {
+	if err := f.flake("CreateComment"); err != nil {
+		return err
+	}
+	f.comments = append(f.comments, comment)
+	return nil
+}
+
+func (f *flakyGitHub) ClosePullRequest(org, repo string, number int) error {
+	if f.closeErr != nil {
+		return f.closeErr
+	}
+	f.closed = append(f.closed, number)
+	return nil
+}
+
+func (f *flakyGitHub) DeleteRef(org, repo, ref string) error {
+	return nil
+}
+
+func newTestWorker(ghc github.Client) *ResourceWorker {
+	return NewResourceWorker(
+		WithGHC(ghc),
+		WithBotUser(&github.UserData{Login: "bot"}),
+		WithBackoff(wait.Backoff{Steps: 3}),
+		WithLogger(logr.Discard()),
+	)
+}
+
+func TestResourceWorker_retry(t *testing.T) {
+	r := newTestWorker(nil)
+	calls := 0
+	if err := r.retry(context.Background(), "step", func() error {
+		if calls++; calls < 3 {
+			return errors.New("transient")
+		}
+		return nil
+	}); err != nil {
+		t.Errorf("retry() error = %v, want nil", err)
+	}
+
+	calls = 0
+	err := r.retry(context.Background(), "step", func() error {
+		calls++
+		return errors.New("permanent")
+	})
+	if err == nil || calls != 3 {
+		t.Errorf("retry() = %v after %d calls, want an error after 3 calls", err, calls)
+	}
+}
+
+func TestResourceWorker_publishPullRequest(t *testing.T) {
+	ghc := &flakyGitHub{failed: map[string]bool{}}
+	r := newTestWorker(ghc)
+	state := &PipelineState{
+		MergeSHA:       "abc",
+		Step:           StepPushed,
+		DownstreamOrg:  "foo",
+		DownstreamName: "gitops",
+		Fork:           "gitops",
+		TargetBranch:   "main",
+		Branch:         "auto-checkout-1-to-main",
+		Title:          "codegen",
+	}
+	if err := r.states.Put("key", state); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := r.publishPullRequest(context.Background(), "key", state, NewDeployPRModifier())
+	if err != nil {
+		t.Fatalf("publishPullRequest() error = %v", err)
+	}
+	// The lost response of the first attempt must not open a second PR.
+	if len(ghc.prs) != 1 || result.PullRequestNumber != 1 {
+		t.Errorf("opened %d PR(s), result #%d, want a single PR #1", len(ghc.prs), result.PullRequestNumber)
+	}
+	recorded, err := r.states.Get("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorded.Step != StepFinished || recorded.PullRequestNumber != 1 {
+		t.Errorf("recorded step %q of #%d, want %q of #1", recorded.Step, recorded.PullRequestNumber, StepFinished)
+	}
+
+	// Resuming a finished pipeline only reports the result again.
+	resumed, err := r.publishPullRequest(context.Background(), "key", recorded, NewDeployPRModifier())
+	if err != nil {
+		t.Fatalf("publishPullRequest() of a finished pipeline error = %v", err)
+	}
+	if resumed.Comment != result.Comment || len(ghc.prs) != 1 {
+		t.Errorf("resumed result = %q with %d PR(s), want %q with 1 PR", resumed.Comment, len(ghc.prs), result.Comment)
+	}
+}
+
+func TestResourceWorker_publishPullRequestUpdate(t *testing.T) {
+	ghc := &flakyGitHub{failed: map[string]bool{}}
+	r := newTestWorker(ghc)
+	state := &PipelineState{
+		MergeSHA:          "abc",
+		Step:              StepPushed,
+		DownstreamOrg:     "foo",
+		DownstreamName:    "gitops",
+		Branch:            "auto-checkout-1-to-main",
+		PullRequestNumber: 7,
+		UpdateComment:     "🔄 Regenerated",
+		ChangedFiles:      2,
+	}
+	result, err := r.publishPullRequest(context.Background(), "key", state, NewDeployPRModifier())
+	if err != nil {
+		t.Fatalf("publishPullRequest() error = %v", err)
+	}
+	if len(ghc.prs) != 0 || len(ghc.comments) != 1 {
+		t.Errorf("opened %d PR(s) and posted %d comment(s), want 0 and 1", len(ghc.prs), len(ghc.comments))
+	}
+	want := "🔄 Updated https://github.com/foo/gitops/pull/7, 2 file(s) changed since the previous push."
+	if result.Comment != want {
+		t.Errorf("result comment = %q, want %q", result.Comment, want)
+	}
+}
+
+func TestResourceWorker_publishPullRequestTearDown(t *testing.T) {
+	ghc := &flakyGitHub{failed: map[string]bool{}, closeErr: errors.New("502 Bad Gateway")}
+	r := newTestWorker(ghc)
+	state := &PipelineState{
+		MergeSHA:       "abc",
+		Step:           StepPushed,
+		DownstreamOrg:  "foo",
+		DownstreamName: "gitops",
+		TargetBranch:   "main",
+		Branch:         "auto-checkout-1-to-main-dryrun",
+		Title:          "codegen",
+	}
+	if _, err := r.publishPullRequest(context.Background(), "key", state, NewDryrunPRModifier()); err == nil {
+		t.Fatal("publishPullRequest() of a PR that cannot be closed succeeded")
+	}
+	// The next run closes the PR it opened.
+	recorded, err := r.states.Get("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorded.Step != StepPullRequestOpened {
+		t.Fatalf("recorded step %q, want %q", recorded.Step, StepPullRequestOpened)
+	}
+
+	ghc.closeErr = nil
+	if _, err := r.publishPullRequest(context.Background(), "key", recorded, NewDryrunPRModifier()); err != nil {
+		t.Fatalf("publishPullRequest() of the next run error = %v", err)
+	}
+	if len(ghc.prs) != 1 || !cmp.Equal(ghc.closed, []int{1}) {
+		t.Errorf("opened %d PR(s) and closed %v, want PR #1 opened and closed", len(ghc.prs), ghc.closed)
+	}
+	if recorded, _ = r.states.Get("key"); recorded.Step != StepFinished {
+		t.Errorf("recorded step %q, want %q", recorded.Step, StepFinished)
+	}
+}
@@ -0,0 +1,118 @@
+package git
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseSigner_SSH(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ParseSigner(pem.EncodeToMemory(block))
+	if err != nil {
+		t.Fatalf("ParseSigner() error = %v", err)
+	}
+
+	message := "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n"
+	armored, err := signer.Sign(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	s := string(armored)
+	if !strings.HasPrefix(s, "-----BEGIN SSH SIGNATURE-----\n") || !strings.HasSuffix(s, "-----END SSH SIGNATURE-----\n") {
+		t.Fatalf("Sign() = %q, want an armored SSH signature", s)
+	}
+	body := strings.TrimSuffix(strings.TrimPrefix(s, "-----BEGIN SSH SIGNATURE-----\n"), "-----END SSH SIGNATURE-----\n")
+	blob, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(body, "\n", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sigBlob struct {
+		MagicPreamble [6]byte
+		Version       uint32
+		PublicKey     string
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     string
+	}
+	if err := ssh.Unmarshal(blob, &sigBlob); err != nil {
+		t.Fatalf("failed to unmarshal the signature: %v", err)
+	}
+	if sigBlob.Namespace != "git" || sigBlob.HashAlgorithm != "sha512" {
+		t.Errorf("signature namespace = %q, hash algorithm = %q, want git and sha512", sigBlob.Namespace, sigBlob.HashAlgorithm)
+	}
+	pub, err := ssh.ParsePublicKey([]byte(sigBlob.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sig ssh.Signature
+	if err := ssh.Unmarshal([]byte(sigBlob.Signature), &sig); err != nil {
+		t.Fatal(err)
+	}
+	hash := sha512.Sum512([]byte(message))
+	signedData := ssh.Marshal(struct {
+		MagicPreamble [6]byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          string
+	}{sshMagicPreamble, "git", "", "sha512", string(hash[:])})
+	if err := pub.Verify(signedData, &sig); err != nil {
+		t.Errorf("failed to verify the signature: %v", err)
+	}
+}
+
+func TestParseSigner_GPG(t *testing.T) {
+	entity, err := openpgp.NewEntity("codegen-bot", "", "bot@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var key bytes.Buffer
+	w, err := armor.Encode(&key, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.SerializePrivate(w, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ParseSigner(key.Bytes())
+	if err != nil {
+		t.Fatalf("ParseSigner() error = %v", err)
+	}
+
+	message := "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n"
+	sig, err := signer.Sign(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if _, err := openpgp.CheckArmoredDetachedSignature(openpgp.EntityList{entity}, strings.NewReader(message), bytes.NewReader(sig), nil); err != nil {
+		t.Errorf("failed to verify the signature: %v", err)
+	}
+}
+
+func TestParseSigner_Invalid(t *testing.T) {
+	if _, err := ParseSigner([]byte("not a key")); err == nil {
+		t.Error("ParseSigner() succeeded, want an error")
+	}
+}
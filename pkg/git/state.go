@@ -0,0 +1,159 @@
+package git
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/spf13/afero"
+)
+
+// Step is the last completed step of the PR creation pipeline of a downstream PR.
+type Step string
+
+const (
+	// StepPushed means the generated branch is pushed, but the downstream PR isn't created or updated yet.
+	StepPushed Step = "pushed"
+	// StepPullRequestOpened means the downstream PR is created or updated, but not closed or commented yet.
+	StepPullRequestOpened Step = "pullRequestOpened"
+	// StepFinished means the result only needs to be reported to the upstream PR.
+	StepFinished Step = "finished"
+)
+
+// PipelineState records the progress of a downstream PR, so that a re-run resumes from the
+// failed step instead of generating and pushing again.
+type PipelineState struct {
+	// MergeSHA is the upstream merge commit the state was recorded for.
+	MergeSHA string `json:"mergeSHA"`
+	Step     Step   `json:"step"`
+
+	DownstreamOrg  string `json:"downstreamOrg"`
+	DownstreamName string `json:"downstreamName"`
+	// Fork is the name of the bot's fork that the branch is pushed to, or empty if the branch
+	// is pushed to the downstream repo.
+	Fork         string `json:"fork"`
+	TargetBranch string `json:"targetBranch"`
+	Branch       string `json:"branch"`
+	Title        string `json:"title"`
+	Body         string `json:"body"`
+	// PullRequestNumber is the PR to update, or the PR opened by the pipeline.
+	PullRequestNumber int `json:"pullRequestNumber,omitempty"`
+	// Labels are set on the downstream PR once it's opened.
+	Labels []string `json:"labels,omitempty"`
+	// UpdateComment is posted to the downstream PR if it's updated.
+	UpdateComment string `json:"updateComment,omitempty"`
+	// ChangedFiles is the number of files changed by an update.
+	ChangedFiles int      `json:"changedFiles,omitempty"`
+	CommentNotes []string `json:"commentNotes,omitempty"`
+	// AutoMergeMethod is the merge method of a low-risk PR, or empty if the PR needs a review.
+	AutoMergeMethod  string `json:"autoMergeMethod,omitempty"`
+	AutoMergeApprove bool   `json:"autoMergeApprove,omitempty"`
+}
+
+// StateStore persists the pipeline states by key.
+type StateStore interface {
+	// Get returns nil if there is no state for 'key'.
+	Get(key string) (*PipelineState, error)
+	Put(key string, state *PipelineState) error
+	Delete(key string) error
+}
+
+// NewMemoryStateStore returns a store that only lives as long as the process.
+func NewMemoryStateStore() StateStore {
+	return &memoryStateStore{states: map[string]*PipelineState{}}
+}
+
+type memoryStateStore struct {
+	mu     sync.Mutex
+	states map[string]*PipelineState
+}
+
+func (s *memoryStateStore) Get(key string) (*PipelineState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[key]
+	if !ok {
+		return nil, nil
+	}
+	copied := *state
+	return &copied, nil
+}
+
+func (s *memoryStateStore) Put(key string, state *PipelineState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *state
+	s.states[key] = &copied
+	return nil
+}
+
+func (s *memoryStateStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, key)
+	return nil
+}
+
+// NewFileStateStore returns a store keeping a JSON file per key in 'dir', which survives restarts.
+func NewFileStateStore(fs afero.Fs, dir string) StateStore {
+	return &fileStateStore{fs: fs, dir: dir}
+}
+
+type fileStateStore struct {
+	fs  afero.Fs
+	dir string
+}
+
+func (s *fileStateStore) path(key string) string {
+	return filepath.Join(s.dir, url.PathEscape(key)+".json")
+}
+
+func (s *fileStateStore) Get(key string) (*PipelineState, error) {
+	data, err := afero.ReadFile(s.fs, s.path(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read the pipeline state: %w", err)
+	}
+	var state PipelineState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse the pipeline state %s: %w", s.path(key), err)
+	}
+	return &state, nil
+}
+
+func (s *fileStateStore) Put(key string, state *PipelineState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := s.fs.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", s.dir, err)
+	}
+	// Write then rename, so that a crash never leaves a truncated state.
+	tmp := s.path(key) + ".tmp"
+	if err := afero.WriteFile(s.fs, tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write the pipeline state: %w", err)
+	}
+	if err := s.fs.Rename(tmp, s.path(key)); err != nil {
+		return fmt.Errorf("failed to write the pipeline state: %w", err)
+	}
+	return nil
+}
+
+func (s *fileStateStore) Delete(key string) error {
+	if err := s.fs.Remove(s.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete the pipeline state: %w", err)
+	}
+	return nil
+}
+
+// stateKey identifies the downstream PR of an upstream PR.
+func stateKey(upstreamRepo *GHRepo, downstream, branch string) string {
+	return fmt.Sprintf("%s/%s#%d:%s:%s", upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber, downstream, branch)
+}
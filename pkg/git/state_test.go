@@ -0,0 +1,49 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/afero"
+)
+
+func TestStateStore(t *testing.T) {
+	stores := map[string]StateStore{
+		"memory": NewMemoryStateStore(),
+		"file":   NewFileStateStore(afero.NewMemMapFs(), "/state"),
+	}
+	key := stateKey(&GHRepo{Org: "foo", Name: "infra", PullRequestNumber: 1}, "foo/gitops", "auto-checkout-1-to-main")
+	state := &PipelineState{
+		MergeSHA:      "abc",
+		Step:          StepPushed,
+		DownstreamOrg: "foo",
+		Branch:        "auto-checkout-1-to-main",
+		CommentNotes:  []string{"note"},
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			if got, err := store.Get(key); err != nil || got != nil {
+				t.Fatalf("Get() before Put() = (%v, %v), want (nil, nil)", got, err)
+			}
+			if err := store.Put(key, state); err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			got, err := store.Get(key)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if diff := cmp.Diff(state, got); diff != "" {
+				t.Errorf("Get() mismatch (-want +got):\n%s", diff)
+			}
+			if err := store.Delete(key); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if got, err := store.Get(key); err != nil || got != nil {
+				t.Errorf("Get() after Delete() = (%v, %v), want (nil, nil)", got, err)
+			}
+			if err := store.Delete(key); err != nil {
+				t.Errorf("Delete() of a missing state error = %v", err)
+			}
+		})
+	}
+}
@@ -2,6 +2,11 @@ package git
 
 import (
 	"sigs.k8s.io/prow/pkg/git/v2"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/internal"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/policy"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/quota"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/infra/account"
 )
 
 type GHRepo struct {
@@ -9,7 +14,12 @@ type GHRepo struct {
 	Name              string
 	PullRequestNumber int
 	MergeSHA          string
-	Client            git.RepoClient
+	// Author is the login of the upstream PR's author, and AuthorEmail is their email.
+	Author      string
+	AuthorEmail string
+	// Fork is the name of the bot's fork of a downstream repo, or empty if there is no fork.
+	Fork   string
+	Client git.RepoClient
 }
 
 type DownstreamBranch struct {
@@ -17,3 +27,29 @@ type DownstreamBranch struct {
 	NewBranch                 string
 	ExistingPullRequestNumber int
 }
+
+// PullRequestNotes are the extra markdown sections attached to a generated PR.
+type PullRequestNotes struct {
+	// Body is appended to the downstream PR body.
+	Body []string
+	// Comment is appended to the comment posted back to the upstream PR.
+	Comment []string
+}
+
+// Result is the outcome of a downstream PR, which is reported back to the upstream PR.
+type Result struct {
+	// PullRequestNumber is 0 if no downstream PR was created.
+	PullRequestNumber int
+	// Comment is the markdown reported to the upstream PR.
+	Comment string
+}
+
+// UpstreamConfig is the pre-processed user input of the upstream repo.
+type UpstreamConfig struct {
+	Accounts     []*account.Account
+	TenantTuples []*internal.TenantTuple
+	// Quota is nil if the upstream repo doesn't define one.
+	Quota *quota.Config
+	// Policies is nil if the upstream repo doesn't define any.
+	Policies *policy.Policies
+}
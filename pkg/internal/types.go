@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/common/selector"
 	"github.com/Huang-Wei/25-kubecon-jp/go/generated/tenant/resource"
 )
 
@@ -8,4 +9,52 @@ type TenantTuple struct {
 	TenantID       string
 	Env            string
 	ResourceConfig *resource.ResourceConfig
+	// Extension carries the tenant input that's not modeled in ResourceConfig.
+	// It's nil if the tenant doesn't provide one.
+	Extension *Extension
+}
+
+// Extension is the content of the optional `extension.yaml` that sits next to
+// `resource.pkl`. It hosts the codegen-specific knobs of a tenant.
+type Extension struct {
+	// BucketOptOuts relaxes the secure defaults of buckets, keyed by bucket name.
+	BucketOptOuts map[string]*BucketOptOut `json:"bucketOptOuts,omitempty"`
+	// Queues defines the message queues of the tenant.
+	Queues []*Queue `json:"queues,omitempty"`
+	// RolePrincipals are the ARNs of the AWS roles and users, e.g., of a CI, that may assume
+	// the tenant's IAM roles besides its Kubernetes service accounts.
+	RolePrincipals []string `json:"rolePrincipals,omitempty"`
+}
+
+// Queue is a message queue. It's rendered as an SQS Queue on AWS, and a Pub/Sub
+// Topic along with its Subscription on GCP.
+type Queue struct {
+	Name   string `json:"name"`
+	Region string `json:"region"`
+	// Selector maps the queue to accounts, the same way as Bucket's selector does.
+	Selector []*selector.Requirment `json:"selector,omitempty"`
+}
+
+// BucketOptOut explicitly disables some of the secure defaults of a bucket.
+// Each opt-out must come with a reason so that it can be reviewed.
+type BucketOptOut struct {
+	// PublicAccess allows the bucket to be publicly accessible.
+	PublicAccess bool `json:"publicAccess,omitempty"`
+	// Versioning disables object versioning.
+	Versioning bool `json:"versioning,omitempty"`
+	// Encryption disables the default server-side encryption.
+	// It only applies to AWS, as GCS always encrypts data at rest.
+	Encryption bool `json:"encryption,omitempty"`
+	// Reason describes why the secure defaults have to be relaxed.
+	Reason string `json:"reason"`
+}
+
+// BucketOptOut returns the opt-out of the given bucket, or an empty one if it's absent.
+func (t *TenantTuple) BucketOptOut(name string) *BucketOptOut {
+	if t.Extension != nil {
+		if optOut, ok := t.Extension.BucketOptOuts[name]; ok && optOut != nil {
+			return optOut
+		}
+	}
+	return &BucketOptOut{}
 }
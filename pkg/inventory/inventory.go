@@ -0,0 +1,213 @@
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/generator"
+)
+
+// TerraformAPIVersion is the APIVersion of the objects read from the Terraform output, whose
+// Kind is the Terraform resource type, e.g., "aws_s3_bucket".
+const TerraformAPIVersion = "terraform"
+
+// Object is an object rendered in the output tree of the generator.
+type Object struct {
+	// Path is the path of the file containing the object, relative to generator.TenantsOutputDir
+	// for the objects of the tenants. The shared objects have a path relative to the output root,
+	// e.g., "_output/gitops/...", and no tenant nor account.
+	Path          string
+	TenantID      string
+	CloudProvider string
+	AccountID     string
+	// Region is empty for the artifacts that are not regional, e.g., IAM.
+	Region string
+
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+	// Raw is the YAML document of the object. The document of a Terraform resource is shaped
+	// like a Kubernetes object, with the resource block as its spec, so that the policies
+	// address both backends the same way.
+	Raw []byte
+}
+
+// ID identifies an object across two scans of the output tree.
+func (o *Object) ID() string {
+	return fmt.Sprintf("%s/%s/%s/%s", o.Path, o.Kind, o.Namespace, o.Name)
+}
+
+// Account returns the "<provider>-<account>" string that names the account's directory, or ""
+// for a shared object.
+func (o *Object) Account() string {
+	if o.AccountID == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s-%s", o.CloudProvider, o.AccountID)
+}
+
+type objectMeta struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+}
+
+// Scan reads all the objects generated under 'dstDir', including the resources of the Terraform
+// output, and the shared objects out of the tenants output directory, e.g., the GitOps
+// Applications and the XRDs. Kustomization files are not considered as objects.
+func Scan(fs afero.Fs, dstDir string) ([]*Object, error) {
+	outputDir := filepath.Join(dstDir, generator.OutputDir)
+	exists, err := afero.DirExists(fs, outputDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if directory exists %s: %w", outputDir, err)
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	tenantsDir := filepath.Join(dstDir, generator.TenantsOutputDir)
+	var objects []*Object
+	err = afero.Walk(fs, outputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		terraform := strings.HasSuffix(info.Name(), ".tf.json")
+		if info.IsDir() || (!terraform && !strings.HasSuffix(info.Name(), ".yaml")) || info.Name() == "kustomization.yaml" {
+			return nil
+		}
+
+		var template Object
+		if relPath, err := filepath.Rel(tenantsDir, path); err == nil && !strings.HasPrefix(relPath, "..") {
+			// Expected structure: <tenant_id>/<provider>-<account_id>[/<region>]/<file>
+			pathParts := strings.Split(filepath.ToSlash(relPath), "/")
+			if len(pathParts) < 3 {
+				return nil
+			}
+			cloudProvider, accountID, ok := strings.Cut(pathParts[1], "-")
+			if !ok {
+				return nil
+			}
+			template = Object{Path: filepath.ToSlash(relPath), TenantID: pathParts[0], CloudProvider: cloudProvider, AccountID: accountID}
+			if len(pathParts) > 3 && pathParts[2] != generator.K8sDirName {
+				template.Region = pathParts[2]
+			}
+		} else {
+			// The shared objects belong to no tenant nor account.
+			relPath, err := filepath.Rel(dstDir, path)
+			if err != nil {
+				return fmt.Errorf("failed to get relative path: %w", err)
+			}
+			template = Object{Path: filepath.ToSlash(relPath)}
+		}
+
+		data, err := afero.ReadFile(fs, path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		var docs [][]byte
+		if terraform {
+			docs, err = terraformDocuments(data)
+		} else {
+			docs, err = splitDocuments(data)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		for _, doc := range docs {
+			var meta objectMeta
+			if err := yaml.Unmarshal(doc, &meta); err != nil {
+				return fmt.Errorf("failed to parse %s: %w", path, err)
+			}
+			if meta.Kind == "" {
+				continue
+			}
+			obj := template
+			obj.APIVersion = meta.APIVersion
+			obj.Kind = meta.Kind
+			obj.Namespace = meta.Metadata.Namespace
+			obj.Name = meta.Metadata.Name
+			obj.Raw = doc
+			objects = append(objects, &obj)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk directory tree: %w", err)
+	}
+
+	return objects, nil
+}
+
+// splitDocuments splits a multi-document YAML file.
+func splitDocuments(data []byte) ([][]byte, error) {
+	var docs [][]byte
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(doc)) != 0 {
+			docs = append(docs, doc)
+		}
+	}
+}
+
+type terraformConfig struct {
+	// Resource maps the resource types to the resources by name.
+	Resource map[string]map[string]json.RawMessage `json:"resource"`
+}
+
+// terraformDocuments returns a document per resource of a .tf.json file, sorted by type and name.
+func terraformDocuments(data []byte) ([][]byte, error) {
+	var config terraformConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	var docs [][]byte
+	for _, typ := range sortedKeys(config.Resource) {
+		resources := config.Resource[typ]
+		for _, name := range sortedKeys(resources) {
+			doc := map[string]any{
+				"apiVersion": TerraformAPIVersion,
+				"kind":       typ,
+				"metadata":   map[string]string{"name": name},
+				"spec":       resources[name],
+			}
+			out, err := json.Marshal(doc)
+			if err != nil {
+				return nil, err
+			}
+			docs = append(docs, out)
+		}
+	}
+	return docs, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
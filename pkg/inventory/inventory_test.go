@@ -0,0 +1,146 @@
+package inventory
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/spf13/afero"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/generator"
+)
+
+func TestScan(t *testing.T) {
+	files := map[string]string{
+		"tenants/tenant-X/aws-1234/us-east-1/bucket-A.yaml": `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: s3.aws.upbound.io/v1beta1
+kind: Bucket
+metadata:
+  name: A
+---
+apiVersion: s3.aws.upbound.io/v1beta1
+kind: BucketVersioning
+metadata:
+  name: A
+`,
+		"tenants/tenant-X/aws-1234/us-east-1/kustomization.yaml": `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+resources:
+- bucket-A.yaml
+`,
+		"tenants/tenant-X/aws-1234/iam.yaml": `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: iam.aws.upbound.io/v1beta1
+kind: Role
+metadata:
+  name: bucket-access
+`,
+		"tenants/tenant-X/gcp-senzu-bean/k8s/serviceaccount.yaml": `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: bucket-access
+  namespace: x1
+`,
+		"gitops/tenant-X-aws-1234.yaml": `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: tenant-X-aws-1234
+  namespace: argocd
+`,
+		"gitops/kustomization.yaml": `# Code generated by kubecon-pr-generator. DO NOT EDIT.
+resources:
+- tenant-X-aws-1234.yaml
+`,
+		"README.md": "not an object",
+	}
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    []*Object
+		wantErr bool
+	}{
+		{
+			name: "no output directory",
+		},
+		{
+			name:  "objects of the output tree",
+			files: files,
+			want: []*Object{
+				{Path: "_output/gitops/tenant-X-aws-1234.yaml", APIVersion: "argoproj.io/v1alpha1", Kind: "Application", Namespace: "argocd", Name: "tenant-X-aws-1234"},
+				{Path: "tenant-X/aws-1234/iam.yaml", TenantID: "tenant-X", CloudProvider: "aws", AccountID: "1234", APIVersion: "iam.aws.upbound.io/v1beta1", Kind: "Role", Name: "bucket-access"},
+				{Path: "tenant-X/aws-1234/us-east-1/bucket-A.yaml", TenantID: "tenant-X", CloudProvider: "aws", AccountID: "1234", Region: "us-east-1", APIVersion: "s3.aws.upbound.io/v1beta1", Kind: "Bucket", Name: "A"},
+				{Path: "tenant-X/aws-1234/us-east-1/bucket-A.yaml", TenantID: "tenant-X", CloudProvider: "aws", AccountID: "1234", Region: "us-east-1", APIVersion: "s3.aws.upbound.io/v1beta1", Kind: "BucketVersioning", Name: "A"},
+				{Path: "tenant-X/gcp-senzu-bean/k8s/serviceaccount.yaml", TenantID: "tenant-X", CloudProvider: "gcp", AccountID: "senzu-bean", APIVersion: "v1", Kind: "ServiceAccount", Namespace: "x1", Name: "bucket-access"},
+			},
+		},
+		{
+			name: "resources of the terraform output",
+			files: map[string]string{
+				"tenants/tenant-X/aws-5678/us-east-1/provider.tf.json": `{"provider": {"aws": [{"alias": "account_5678", "region": "us-east-1"}]}}`,
+				"tenants/tenant-X/aws-5678/us-east-1/bucket-A.tf.json": `{
+  "resource": {
+    "aws_s3_bucket_versioning": {"A": {"bucket": "${aws_s3_bucket.A.id}"}},
+    "aws_s3_bucket": {"A": {"bucket": "tenant-X-aws-5678-us-east-1-A"}}
+  }
+}`,
+			},
+			want: []*Object{
+				{Path: "tenant-X/aws-5678/us-east-1/bucket-A.tf.json", TenantID: "tenant-X", CloudProvider: "aws", AccountID: "5678", Region: "us-east-1", APIVersion: TerraformAPIVersion, Kind: "aws_s3_bucket", Name: "A"},
+				{Path: "tenant-X/aws-5678/us-east-1/bucket-A.tf.json", TenantID: "tenant-X", CloudProvider: "aws", AccountID: "5678", Region: "us-east-1", APIVersion: TerraformAPIVersion, Kind: "aws_s3_bucket_versioning", Name: "A"},
+			},
+		},
+		{
+			name: "malformed YAML",
+			files: map[string]string{
+				"tenants/tenant-X/aws-1234/us-east-1/bucket-A.yaml": "kind: [",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			for name, content := range tt.files {
+				path := fmt.Sprintf("/%s/%s", generator.OutputDir, name)
+				if err := afero.WriteFile(fs, path, []byte(content), 0644); err != nil {
+					t.Fatalf("failed to write %s: %v", path, err)
+				}
+			}
+			got, err := Scan(fs, "/")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Scan() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if diff := cmp.Diff(tt.want, got, cmpopts.IgnoreFields(Object{}, "Raw")); diff != "" {
+				t.Errorf("Scan() unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_terraformDocuments(t *testing.T) {
+	data := `{
+  "resource": {
+    "aws_s3_bucket_versioning": {"A": {"bucket": "${aws_s3_bucket.A.id}"}},
+    "aws_s3_bucket": {"A": {"bucket": "tenant-X-aws-5678-us-east-1-A"}}
+  }
+}`
+	got, err := terraformDocuments([]byte(data))
+	if err != nil {
+		t.Fatalf("terraformDocuments() error = %v", err)
+	}
+	want := []string{
+		`{"apiVersion":"terraform","kind":"aws_s3_bucket","metadata":{"name":"A"},"spec":{"bucket":"tenant-X-aws-5678-us-east-1-A"}}`,
+		`{"apiVersion":"terraform","kind":"aws_s3_bucket_versioning","metadata":{"name":"A"},"spec":{"bucket":"${aws_s3_bucket.A.id}"}}`,
+	}
+	var gotDocs []string
+	for _, doc := range got {
+		gotDocs = append(gotDocs, string(doc))
+	}
+	if diff := cmp.Diff(want, gotDocs); diff != "" {
+		t.Errorf("terraformDocuments() mismatch (-want +got):\n%s", diff)
+	}
+}
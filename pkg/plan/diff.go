@@ -0,0 +1,164 @@
+package plan
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/generator"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/inventory"
+)
+
+// Filter narrows the changes down to some tenants and accounts. An empty field matches all.
+// The files out of the tenants output directory only match an empty filter.
+type Filter struct {
+	TenantID      string
+	CloudProvider string
+	AccountID     string
+}
+
+func (f *Filter) empty() bool {
+	return f.TenantID == "" && f.CloudProvider == "" && f.AccountID == ""
+}
+
+func (f *Filter) matches(tenantID, cloudProvider, accountID string) bool {
+	return (f.TenantID == "" || f.TenantID == tenantID) &&
+		(f.CloudProvider == "" || f.CloudProvider == cloudProvider) &&
+		(f.AccountID == "" || f.AccountID == accountID)
+}
+
+// MatchesPath returns whether the file at 'path', relative to the repo root, passes the filter.
+func (f *Filter) MatchesPath(path string) bool {
+	if f.empty() {
+		return true
+	}
+	relPath, ok := strings.CutPrefix(path, generator.TenantsOutputDir+"/")
+	if !ok {
+		return false
+	}
+	// Expected structure: <tenant_id>/<provider>-<account_id>/...
+	pathParts := strings.Split(relPath, "/")
+	if len(pathParts) < 3 {
+		return false
+	}
+	cloudProvider, accountID, _ := strings.Cut(pathParts[1], "-")
+	return f.matches(pathParts[0], cloudProvider, accountID)
+}
+
+// MatchesObject returns whether the object passes the filter. The shared objects only match
+// an empty filter, like the files out of the tenants output directory.
+func (f *Filter) MatchesObject(obj *inventory.Object) bool {
+	if obj.AccountID == "" {
+		return f.empty()
+	}
+	return f.matches(obj.TenantID, obj.CloudProvider, obj.AccountID)
+}
+
+// FilterChanges returns the changes of the files that pass the filter.
+func FilterChanges(changes []*FileChange, filter *Filter) []*FileChange {
+	var filtered []*FileChange
+	for _, c := range changes {
+		if filter.MatchesPath(c.Path) {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
+// PrintUnified writes the changes as a unified diff.
+func PrintUnified(w io.Writer, changes []*FileChange) error {
+	for _, c := range changes {
+		fromFile, toFile := "a/"+c.Path, "b/"+c.Path
+		switch c.Action {
+		case Create:
+			fromFile = "/dev/null"
+		case Delete:
+			toFile = "/dev/null"
+		}
+		if err := difflib.WriteUnifiedDiff(w, difflib.UnifiedDiff{
+			A:        splitLines(c.Before),
+			B:        splitLines(c.After),
+			FromFile: fromFile,
+			ToFile:   toFile,
+			Context:  3,
+		}); err != nil {
+			return fmt.Errorf("failed to diff %s: %w", c.Path, err)
+		}
+	}
+	return nil
+}
+
+// splitLines splits the content into lines that keep their line breaks.
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// ObjectChange is a change to an object of the output tree.
+type ObjectChange struct {
+	Action Action
+	Object *inventory.Object
+}
+
+// CompareObjects returns the changes from 'before' to 'after' that pass the filter,
+// sorted by object ID.
+func CompareObjects(before, after []*inventory.Object, filter *Filter) []*ObjectChange {
+	index := func(objects []*inventory.Object) map[string]*inventory.Object {
+		m := map[string]*inventory.Object{}
+		for _, obj := range objects {
+			if filter.MatchesObject(obj) {
+				m[obj.ID()] = obj
+			}
+		}
+		return m
+	}
+	beforeObjs, afterObjs := index(before), index(after)
+
+	var changes []*ObjectChange
+	for id, obj := range afterObjs {
+		old, ok := beforeObjs[id]
+		switch {
+		case !ok:
+			changes = append(changes, &ObjectChange{Action: Create, Object: obj})
+		case !bytes.Equal(old.Raw, obj.Raw):
+			changes = append(changes, &ObjectChange{Action: Update, Object: obj})
+		}
+	}
+	for id, obj := range beforeObjs {
+		if _, ok := afterObjs[id]; !ok {
+			changes = append(changes, &ObjectChange{Action: Delete, Object: obj})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Object.ID() < changes[j].Object.ID()
+	})
+	return changes
+}
+
+// PrintObjects writes the object changes, one object per line, followed by a summary.
+func PrintObjects(w io.Writer, changes []*ObjectChange) error {
+	counts := map[Action]int{}
+	for _, c := range changes {
+		counts[c.Action]++
+		obj := c.Object
+		if _, err := fmt.Fprintf(w, "%s %s/%s %s (%s)\n", actionSymbols[c.Action], obj.APIVersion, obj.Kind, obj.Name, obj.Path); err != nil {
+			return err
+		}
+	}
+	if len(changes) == 0 {
+		_, err := fmt.Fprintln(w, "No changes.")
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d objects to create, %d to update, %d to delete.\n", counts[Create], counts[Update], counts[Delete])
+	return err
+}
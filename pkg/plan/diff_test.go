@@ -0,0 +1,103 @@
+package plan
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/inventory"
+)
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		path   string
+		want   bool
+	}{
+		{name: "empty filter", path: "_output/gitops/kustomization.yaml", want: true},
+		{name: "non-tenant file", filter: Filter{TenantID: "foo"}, path: "_output/gitops/kustomization.yaml"},
+		{name: "tenant matches", filter: Filter{TenantID: "foo"}, path: "_output/tenants/foo/aws-1234/iam.yaml", want: true},
+		{name: "tenant mismatches", filter: Filter{TenantID: "bar"}, path: "_output/tenants/foo/aws-1234/iam.yaml"},
+		{name: "provider and account match", filter: Filter{CloudProvider: "gcp", AccountID: "senzu-bean"}, path: "_output/tenants/foo/gcp-senzu-bean/us-east-1/bucket-A.yaml", want: true},
+		{name: "account mismatches", filter: Filter{AccountID: "1234"}, path: "_output/tenants/foo/gcp-senzu-bean/us-east-1/bucket-A.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.MatchesPath(tt.path); got != tt.want {
+				t.Errorf("MatchesPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintUnified(t *testing.T) {
+	changes := []*FileChange{
+		{Path: "_output/a.yaml", Action: Update, Before: []byte("a: 1\nb: 2\n"), After: []byte("a: 1\nb: 3\n")},
+		{Path: "_output/c.yaml", Action: Create, After: []byte("c: 1\n")},
+	}
+	var out bytes.Buffer
+	if err := PrintUnified(&out, changes); err != nil {
+		t.Fatal(err)
+	}
+	want := `--- a/_output/a.yaml
++++ b/_output/a.yaml
+@@ -1,2 +1,2 @@
+ a: 1
+-b: 2
++b: 3
+--- /dev/null
++++ b/_output/c.yaml
+@@ -0,0 +1 @@
++c: 1
+`
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("PrintUnified() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCompareObjects(t *testing.T) {
+	bucket := func(tenantID, accountID, name, raw string) *inventory.Object {
+		return &inventory.Object{
+			Path:          tenantID + "/aws-" + accountID + "/us-east-1/bucket-" + name + ".yaml",
+			TenantID:      tenantID,
+			CloudProvider: "aws",
+			AccountID:     accountID,
+			Region:        "us-east-1",
+			APIVersion:    "s3.aws.upbound.io/v1beta1",
+			Kind:          "Bucket",
+			Name:          name,
+			Raw:           []byte(raw),
+		}
+	}
+	before := []*inventory.Object{
+		bucket("foo", "1234", "A", "a"),
+		bucket("foo", "1234", "B", "b"),
+		bucket("bar", "1234", "A", "a"),
+	}
+	after := []*inventory.Object{
+		bucket("foo", "1234", "A", "a"),
+		bucket("foo", "1234", "B", "B"),
+		bucket("foo", "1234", "C", "c"),
+	}
+
+	got := CompareObjects(before, after, &Filter{TenantID: "foo"})
+	var out bytes.Buffer
+	if err := PrintObjects(&out, got); err != nil {
+		t.Fatal(err)
+	}
+	want := `~ s3.aws.upbound.io/v1beta1/Bucket B (foo/aws-1234/us-east-1/bucket-B.yaml)
++ s3.aws.upbound.io/v1beta1/Bucket C (foo/aws-1234/us-east-1/bucket-C.yaml)
+
+1 objects to create, 1 to update, 0 to delete.
+`
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("PrintObjects() mismatch (-want +got):\n%s", diff)
+	}
+
+	got = CompareObjects(before, after, &Filter{TenantID: "bar"})
+	if len(got) != 1 || got[0].Action != Delete {
+		t.Errorf("CompareObjects() = %v, want a single deletion", got)
+	}
+}
@@ -0,0 +1,95 @@
+package plan
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// summaryKey is a row of the change summary.
+type summaryKey struct {
+	tenantID string
+	account  string
+	region   string
+}
+
+// filesTabNote replaces the per-file sections that don't fit in a PR body.
+const filesTabNote = "\n... and %d more file(s), see the Files tab of the PR.\n"
+
+// Markdown renders the object changes for a PR body: a table of the counts per tenant,
+// account and region, followed by the objects of each file in collapsible sections. The
+// sections that would take it over 'limit' bytes are left out.
+func Markdown(changes []*ObjectChange, limit int) string {
+	var sb strings.Builder
+	sb.WriteString("#### 📋 Change summary\n\n")
+	if len(changes) == 0 {
+		sb.WriteString("No resource changes.\n")
+		return sb.String()
+	}
+
+	counts := map[summaryKey]map[Action]int{}
+	files := map[string][]*ObjectChange{}
+	for _, c := range changes {
+		key := summaryKey{tenantID: c.Object.TenantID, account: c.Object.Account(), region: c.Object.Region}
+		if counts[key] == nil {
+			counts[key] = map[Action]int{}
+		}
+		counts[key][c.Action]++
+		files[c.Object.Path] = append(files[c.Object.Path], c)
+	}
+
+	keys := make([]summaryKey, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.tenantID != b.tenantID {
+			return a.tenantID < b.tenantID
+		}
+		if a.account != b.account {
+			return a.account < b.account
+		}
+		return a.region < b.region
+	})
+	sb.WriteString("| Tenant | Account | Region | Created | Updated | Deleted |\n")
+	sb.WriteString("|---|---|---|---|---|---|\n")
+	for _, key := range keys {
+		tenantID, account, region := key.tenantID, key.account, key.region
+		// The shared objects, e.g., the GitOps Applications, belong to no tenant.
+		if tenantID == "" {
+			tenantID, account = "(shared)", "-"
+		}
+		if region == "" {
+			region = "-"
+		}
+		c := counts[key]
+		fmt.Fprintf(&sb, "| %s | %s | %s | %d | %d | %d |\n", tenantID, account, region, c[Create], c[Update], c[Delete])
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for i, path := range paths {
+		var section strings.Builder
+		fmt.Fprintf(&section, "\n<details>\n<summary><code>%s</code></summary>\n\n", path)
+		for _, c := range files[path] {
+			fmt.Fprintf(&section, "- `%s` %s `%s`\n", actionSymbols[c.Action], c.Object.Kind, c.Object.Name)
+		}
+		section.WriteString("\n</details>\n")
+
+		// Keep room for the note of the files left out, unless this is the last one.
+		room := limit - sb.Len()
+		if i != len(paths)-1 {
+			room -= len(fmt.Sprintf(filesTabNote, len(paths)-i-1))
+		}
+		if section.Len() > room {
+			fmt.Fprintf(&sb, filesTabNote, len(paths)-i)
+			break
+		}
+		sb.WriteString(section.String())
+	}
+	return sb.String()
+}
@@ -0,0 +1,79 @@
+package plan
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/inventory"
+)
+
+func TestMarkdown(t *testing.T) {
+	object := func(path, region, kind, name string) *inventory.Object {
+		return &inventory.Object{
+			Path:          path,
+			TenantID:      "foo",
+			CloudProvider: "aws",
+			AccountID:     "1234",
+			Region:        region,
+			Kind:          kind,
+			Name:          name,
+		}
+	}
+	changes := []*ObjectChange{
+		{Action: Update, Object: object("foo/aws-1234/iam.yaml", "", "Role", "bucket-access")},
+		{Action: Create, Object: object("foo/aws-1234/us-east-1/bucket-A.yaml", "us-east-1", "Bucket", "A")},
+		{Action: Create, Object: object("foo/aws-1234/us-east-1/bucket-A.yaml", "us-east-1", "BucketVersioning", "A")},
+		{Action: Delete, Object: object("foo/aws-1234/us-east-1/bucket-B.yaml", "us-east-1", "Bucket", "B")},
+	}
+	want := "#### 📋 Change summary\n\n" +
+		"| Tenant | Account | Region | Created | Updated | Deleted |\n" +
+		"|---|---|---|---|---|---|\n" +
+		"| foo | aws-1234 | - | 0 | 1 | 0 |\n" +
+		"| foo | aws-1234 | us-east-1 | 2 | 0 | 1 |\n" +
+		"\n<details>\n<summary><code>foo/aws-1234/iam.yaml</code></summary>\n\n" +
+		"- `~` Role `bucket-access`\n" +
+		"\n</details>\n" +
+		"\n<details>\n<summary><code>foo/aws-1234/us-east-1/bucket-A.yaml</code></summary>\n\n" +
+		"- `+` Bucket `A`\n" +
+		"- `+` BucketVersioning `A`\n" +
+		"\n</details>\n" +
+		"\n<details>\n<summary><code>foo/aws-1234/us-east-1/bucket-B.yaml</code></summary>\n\n" +
+		"- `-` Bucket `B`\n" +
+		"\n</details>\n"
+	if diff := cmp.Diff(want, Markdown(changes, len(want))); diff != "" {
+		t.Errorf("Markdown() mismatch (-want +got):\n%s", diff)
+	}
+
+	want = "#### 📋 Change summary\n\n" +
+		"| Tenant | Account | Region | Created | Updated | Deleted |\n" +
+		"|---|---|---|---|---|---|\n" +
+		"| foo | aws-1234 | - | 0 | 1 | 0 |\n" +
+		"| foo | aws-1234 | us-east-1 | 2 | 0 | 1 |\n" +
+		"\n<details>\n<summary><code>foo/aws-1234/iam.yaml</code></summary>\n\n" +
+		"- `~` Role `bucket-access`\n" +
+		"\n</details>\n" +
+		"\n... and 2 more file(s), see the Files tab of the PR.\n"
+	if diff := cmp.Diff(want, Markdown(changes, len(want)+10)); diff != "" {
+		t.Errorf("Markdown() over the limit mismatch (-want +got):\n%s", diff)
+	}
+
+	// The shared objects are summed up apart from the tenants.
+	shared := append([]*ObjectChange{
+		{Action: Create, Object: &inventory.Object{Path: "_output/gitops/foo-aws-1234.yaml", Kind: "Application", Name: "foo-aws-1234"}},
+	}, changes[:1]...)
+	want = "#### 📋 Change summary\n\n" +
+		"| Tenant | Account | Region | Created | Updated | Deleted |\n" +
+		"|---|---|---|---|---|---|\n" +
+		"| (shared) | - | - | 1 | 0 | 0 |\n" +
+		"| foo | aws-1234 | - | 0 | 1 | 0 |\n" +
+		"\n<details>\n<summary><code>_output/gitops/foo-aws-1234.yaml</code></summary>\n\n" +
+		"- `+` Application `foo-aws-1234`\n" +
+		"\n</details>\n" +
+		"\n<details>\n<summary><code>foo/aws-1234/iam.yaml</code></summary>\n\n" +
+		"- `~` Role `bucket-access`\n" +
+		"\n</details>\n"
+	if diff := cmp.Diff(want, Markdown(shared, len(want))); diff != "" {
+		t.Errorf("Markdown() of the shared objects mismatch (-want +got):\n%s", diff)
+	}
+}
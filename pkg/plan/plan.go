@@ -0,0 +1,130 @@
+package plan
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/afero"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/generator"
+)
+
+// Action is what happens to a file of the output tree.
+type Action string
+
+const (
+	Create Action = "create"
+	Update Action = "update"
+	Delete Action = "delete"
+)
+
+// Files are the contents of the output tree, keyed by the slash-separated path
+// relative to the repo root.
+type Files map[string][]byte
+
+// FileChange is a change to a file of the output tree.
+type FileChange struct {
+	Path   string
+	Action Action
+	Before []byte
+	After  []byte
+}
+
+// Snapshot reads the output tree of the repo at 'dir' into memory.
+func Snapshot(fs afero.Fs, dir string) (Files, error) {
+	files := Files{}
+	outputDir := filepath.Join(dir, generator.OutputDir)
+	exists, err := afero.DirExists(fs, outputDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if directory exists %s: %w", outputDir, err)
+	}
+	if !exists {
+		return files, nil
+	}
+	err = afero.Walk(fs, outputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		data, err := afero.ReadFile(fs, path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path: %w", err)
+		}
+		files[filepath.ToSlash(relPath)] = data
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk directory tree: %w", err)
+	}
+	return files, nil
+}
+
+// Restore writes the files into the repo at 'dir'.
+func Restore(fs afero.Fs, dir string, files Files) error {
+	for path, data := range files {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		if err := fs.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", filepath.Dir(path), err)
+		}
+		if err := afero.WriteFile(fs, path, data, 0755); err != nil {
+			return fmt.Errorf("failed to write file %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// Compare returns the changes from 'before' to 'after', sorted by path.
+func Compare(before, after Files) []*FileChange {
+	var changes []*FileChange
+	for path, data := range after {
+		old, ok := before[path]
+		switch {
+		case !ok:
+			changes = append(changes, &FileChange{Path: path, Action: Create, After: data})
+		case !bytes.Equal(old, data):
+			changes = append(changes, &FileChange{Path: path, Action: Update, Before: old, After: data})
+		}
+	}
+	for path, data := range before {
+		if _, ok := after[path]; !ok {
+			changes = append(changes, &FileChange{Path: path, Action: Delete, Before: data})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+var actionSymbols = map[Action]string{
+	Create: "+",
+	Update: "~",
+	Delete: "-",
+}
+
+// Print writes the changes as a plan, one file per line, followed by a summary.
+func Print(w io.Writer, changes []*FileChange) error {
+	counts := map[Action]int{}
+	for _, c := range changes {
+		counts[c.Action]++
+		if _, err := fmt.Fprintf(w, "%s %s\n", actionSymbols[c.Action], c.Path); err != nil {
+			return err
+		}
+	}
+	if len(changes) == 0 {
+		_, err := fmt.Fprintln(w, "No changes.")
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\nPlan: %d to create, %d to update, %d to delete.\n", counts[Create], counts[Update], counts[Delete])
+	return err
+}
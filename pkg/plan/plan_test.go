@@ -0,0 +1,100 @@
+package plan
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/afero"
+)
+
+func TestSnapshotAndRestore(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	files := Files{
+		"_output/tenants/tenant-X/aws-1234/iam.yaml":  []byte("kind: Role\n"),
+		"_output/gitops/kustomization.yaml":           []byte("resources: []\n"),
+		"_output/tenants/tenant-X/aws-1234/notes.txt": []byte("hello\n"),
+	}
+	if err := Restore(fs, "/repo", files); err != nil {
+		t.Fatal(err)
+	}
+	// Files outside of the output tree are ignored.
+	if err := afero.WriteFile(fs, "/repo/README.md", []byte("# repo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Snapshot(fs, "/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(files, got); diff != "" {
+		t.Errorf("Snapshot() mismatch (-want +got):\n%s", diff)
+	}
+
+	got, err = Snapshot(fs, "/empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(Files{}, got); diff != "" {
+		t.Errorf("Snapshot() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCompareAndPrint(t *testing.T) {
+	before := Files{
+		"_output/a.yaml": []byte("a\n"),
+		"_output/b.yaml": []byte("b\n"),
+		"_output/c.yaml": []byte("c\n"),
+	}
+	after := Files{
+		"_output/a.yaml": []byte("a\n"),
+		"_output/b.yaml": []byte("B\n"),
+		"_output/d.yaml": []byte("d\n"),
+	}
+
+	tests := []struct {
+		name    string
+		before  Files
+		after   Files
+		want    []*FileChange
+		wantOut string
+	}{
+		{
+			name:    "no changes",
+			before:  before,
+			after:   before,
+			wantOut: "No changes.\n",
+		},
+		{
+			name:   "create, update and delete",
+			before: before,
+			after:  after,
+			want: []*FileChange{
+				{Path: "_output/b.yaml", Action: Update, Before: []byte("b\n"), After: []byte("B\n")},
+				{Path: "_output/c.yaml", Action: Delete, Before: []byte("c\n")},
+				{Path: "_output/d.yaml", Action: Create, After: []byte("d\n")},
+			},
+			wantOut: `~ _output/b.yaml
+- _output/c.yaml
++ _output/d.yaml
+
+Plan: 1 to create, 1 to update, 1 to delete.
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Compare(tt.before, tt.after)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Compare() mismatch (-want +got):\n%s", diff)
+			}
+			var out bytes.Buffer
+			if err := Print(&out, got); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.wantOut, out.String()); diff != "" {
+				t.Errorf("Print() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/v1/rego"
+	"github.com/spf13/afero"
+	"sigs.k8s.io/yaml"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/inventory"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/infra/account"
+)
+
+const (
+	// DenyQuery and WarnQuery are the rules evaluated against each rendered object.
+	// Both are expected to be sets of messages, e.g.:
+	//
+	//	package codegen
+	//
+	//	deny contains msg if {
+	//		input.object.kind == "Bucket"
+	//		not input.object.spec.forProvider.tags.owner
+	//		msg := "buckets must be tagged with an owner"
+	//	}
+	DenyQuery = "data.codegen.deny"
+	WarnQuery = "data.codegen.warn"
+)
+
+// Policies are the compiled Rego modules of the upstream `policy/` directory.
+type Policies struct {
+	deny rego.PreparedEvalQuery
+	warn rego.PreparedEvalQuery
+}
+
+// Load compiles the .rego files under 'dir', excluding the tests. It returns nil if
+// there is no policy.
+func Load(ctx context.Context, fs afero.Fs, dir string) (*Policies, error) {
+	exists, err := afero.DirExists(fs, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if directory exists %s: %w", dir, err)
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	var modules []func(*rego.Rego)
+	err = afero.Walk(fs, dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".rego" || strings.HasSuffix(path, "_test.rego") {
+			return nil
+		}
+		data, err := afero.ReadFile(fs, path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		modules = append(modules, rego.Module(path, string(data)))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk directory tree: %w", err)
+	}
+	if len(modules) == 0 {
+		return nil, nil
+	}
+
+	prepare := func(query string) (rego.PreparedEvalQuery, error) {
+		pq, err := rego.New(append(modules, rego.Query(query))...).PrepareForEval(ctx)
+		if err != nil {
+			return pq, fmt.Errorf("failed to compile policies in %s: %w", dir, err)
+		}
+		return pq, nil
+	}
+	p := &Policies{}
+	if p.deny, err = prepare(DenyQuery); err != nil {
+		return nil, err
+	}
+	if p.warn, err = prepare(WarnQuery); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Finding is a message a policy reports on an object.
+type Finding struct {
+	Object  *inventory.Object
+	Message string
+}
+
+// Result collects the findings of all the objects.
+type Result struct {
+	Denies []*Finding
+	Warns  []*Finding
+}
+
+// Evaluate evaluates the policies against each object. The input of the policies is:
+//
+//	object:  the rendered object, see inventory.Object.Raw for the resources of the Terraform output
+//	tenant:  {id}
+//	account: {id, cloudProvider, region, tags}
+//	path:    the path of the file, see inventory.Object.Path
+//
+// The shared objects out of the tenants output directory, e.g., the GitOps Applications and the
+// XRDs, are evaluated too, with an empty tenant and account.
+func (p *Policies) Evaluate(ctx context.Context, accounts []*account.Account, objects []*inventory.Object) (*Result, error) {
+	result := &Result{}
+	if p == nil {
+		return result, nil
+	}
+
+	tags := map[string]map[string]string{}
+	for _, act := range accounts {
+		actTags := map[string]string{}
+		for k, v := range act.Tags {
+			actTags[string(k)] = v
+		}
+		tags[act.AccountID] = actTags
+	}
+
+	for _, obj := range objects {
+		var content map[string]any
+		if err := yaml.Unmarshal(obj.Raw, &content); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", obj.ID(), err)
+		}
+		input := map[string]any{
+			"object": content,
+			"tenant": map[string]any{"id": obj.TenantID},
+			"account": map[string]any{
+				"id":            obj.AccountID,
+				"cloudProvider": obj.CloudProvider,
+				"region":        obj.Region,
+				"tags":          tags[obj.AccountID],
+			},
+			"path": obj.Path,
+		}
+
+		denies, err := messages(ctx, p.deny, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate %s on %s: %w", DenyQuery, obj.ID(), err)
+		}
+		for _, msg := range denies {
+			result.Denies = append(result.Denies, &Finding{Object: obj, Message: msg})
+		}
+		warns, err := messages(ctx, p.warn, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate %s on %s: %w", WarnQuery, obj.ID(), err)
+		}
+		for _, msg := range warns {
+			result.Warns = append(result.Warns, &Finding{Object: obj, Message: msg})
+		}
+	}
+	return result, nil
+}
+
+// messages returns the sorted messages of a set rule. An undefined rule yields no message.
+func messages(ctx context.Context, query rego.PreparedEvalQuery, input any) ([]string, error) {
+	rs, err := query.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return nil, err
+	}
+	var msgs []string
+	for _, r := range rs {
+		for _, expr := range r.Expressions {
+			values, ok := expr.Value.([]any)
+			if !ok {
+				return nil, fmt.Errorf("expected a set of messages, got %T", expr.Value)
+			}
+			for _, v := range values {
+				msgs = append(msgs, fmt.Sprint(v))
+			}
+		}
+	}
+	sort.Strings(msgs)
+	return msgs, nil
+}
+
+// DenyMarkdown renders the deny findings as a comment on the upstream PR.
+func (r *Result) DenyMarkdown(policyDir string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🚫 Codegen is blocked by the policies in `%s`:\n\n", policyDir)
+	writeFindings(&sb, r.Denies)
+	sb.WriteString("\nPlease update the resources, or ask the platform team to review the policies.")
+	return sb.String()
+}
+
+// WarnMarkdown renders the warn findings for the downstream PR body.
+func (r *Result) WarnMarkdown() string {
+	var sb strings.Builder
+	sb.WriteString("#### ⚠️ Policy warnings\n\n")
+	writeFindings(&sb, r.Warns)
+	return sb.String()
+}
+
+func writeFindings(sb *strings.Builder, findings []*Finding) {
+	sb.WriteString("| Object | File | Message |\n")
+	sb.WriteString("|---|---|---|\n")
+	for _, f := range findings {
+		fmt.Fprintf(sb, "| %s `%s` | `%s` | %s |\n", f.Object.Kind, f.Object.Name, f.Object.Path, f.Message)
+	}
+}
@@ -0,0 +1,287 @@
+package policy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/afero"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/generator"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/internal"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/inventory"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/common/selector/key"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/infra/account"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/tenant/resource"
+)
+
+const bucketPolicy = `package codegen
+
+deny contains msg if {
+	input.object.kind == "Bucket"
+	input.account.tags.env == "prod"
+	not input.object.spec.forProvider.tags.owner
+	msg := sprintf("bucket %s in prod must be tagged with an owner", [input.object.metadata.name])
+}
+
+warn contains msg if {
+	input.account.region == "us-west-1"
+	msg := "us-west-1 is being phased out"
+}
+`
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantNil bool
+		wantErr bool
+	}{
+		{
+			name:    "no policy directory",
+			wantNil: true,
+		},
+		{
+			name: "only tests",
+			files: map[string]string{
+				"/policy/bucket_test.rego": "package codegen\n",
+			},
+			wantNil: true,
+		},
+		{
+			name: "valid policies",
+			files: map[string]string{
+				"/policy/bucket.rego": bucketPolicy,
+			},
+		},
+		{
+			name: "invalid policies",
+			files: map[string]string{
+				"/policy/bucket.rego": "package codegen\n\ndeny contains msg if {\n",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			for path, content := range tt.files {
+				if err := afero.WriteFile(fs, path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := Load(context.Background(), fs, "/policy")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (got == nil) != tt.wantNil {
+				t.Errorf("Load() = %v, wantNil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, "/policy/bucket.rego", []byte(bucketPolicy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	policies, err := Load(context.Background(), fs, "/policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accounts := []*account.Account{
+		{AccountID: "1234", CloudProvider: "aws", Tags: map[key.Key]string{key.Env: "prod"}},
+		{AccountID: "5678", CloudProvider: "aws", Tags: map[key.Key]string{key.Env: "dev"}},
+	}
+	bucket := func(accountID, region, name, tags string) *inventory.Object {
+		return &inventory.Object{
+			Path:          "tenant-X/aws-" + accountID + "/" + region + "/bucket-" + name + ".yaml",
+			TenantID:      "tenant-X",
+			CloudProvider: "aws",
+			AccountID:     accountID,
+			Region:        region,
+			Kind:          "Bucket",
+			Name:          name,
+			Raw: []byte(`apiVersion: s3.aws.upbound.io/v1beta1
+kind: Bucket
+metadata:
+  name: ` + name + `
+spec:
+  forProvider:
+    region: ` + region + `
+` + tags),
+		}
+	}
+
+	type finding struct {
+		Object  string
+		Message string
+	}
+	tests := []struct {
+		name     string
+		objects  []*inventory.Object
+		wantDeny []finding
+		wantWarn []finding
+	}{
+		{
+			name: "compliant objects",
+			objects: []*inventory.Object{
+				bucket("1234", "us-east-1", "A", "    tags:\n      owner: team-a\n"),
+				bucket("5678", "us-east-1", "B", ""),
+			},
+		},
+		{
+			name: "deny and warn",
+			objects: []*inventory.Object{
+				bucket("1234", "us-east-1", "A", ""),
+				bucket("5678", "us-west-1", "B", ""),
+			},
+			wantDeny: []finding{
+				{Object: "tenant-X/aws-1234/us-east-1/bucket-A.yaml/Bucket//A", Message: "bucket A in prod must be tagged with an owner"},
+			},
+			wantWarn: []finding{
+				{Object: "tenant-X/aws-5678/us-west-1/bucket-B.yaml/Bucket//B", Message: "us-west-1 is being phased out"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := policies.Evaluate(context.Background(), accounts, tt.objects)
+			if err != nil {
+				t.Fatal(err)
+			}
+			toFindings := func(fs []*Finding) []finding {
+				var out []finding
+				for _, f := range fs {
+					out = append(out, finding{Object: f.Object.ID(), Message: f.Message})
+				}
+				return out
+			}
+			if diff := cmp.Diff(tt.wantDeny, toFindings(result.Denies)); diff != "" {
+				t.Errorf("Evaluate() denies mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantWarn, toFindings(result.Warns)); diff != "" {
+				t.Errorf("Evaluate() warns mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEvaluate_terraform(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	policy := `package codegen
+
+deny contains msg if {
+	input.object.kind in {"Bucket", "aws_s3_bucket"}
+	input.account.tags.env == "prod"
+	msg := sprintf("bucket %s must not be created in prod", [input.object.metadata.name])
+}
+`
+	if err := afero.WriteFile(fs, "/policy/bucket.rego", []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	policies, err := Load(context.Background(), fs, "/policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The bucket is generated on the Terraform backend, then read back like the PR pipeline does.
+	accounts := []*account.Account{
+		{AccountID: "1234", CloudProvider: "aws", Tags: map[key.Key]string{key.Env: "prod"}},
+	}
+	tuples := []*internal.TenantTuple{
+		{
+			TenantID:       "tenant-X",
+			Env:            "prod",
+			ResourceConfig: &resource.ResourceConfig{Buckets: []*resource.Bucket{{Name: "A", Region: "us-east-1"}}},
+		},
+	}
+	codegen := generator.NewCodegen(
+		generator.WithFs(fs),
+		generator.WithProviderSettings(map[string]*generator.ProviderSettings{"aws": {Backend: generator.BackendTerraform}}),
+	)
+	if err := codegen.FanOutArtifacts(context.Background(), "/downstream", accounts, tuples); err != nil {
+		t.Fatalf("FanOutArtifacts() error = %v", err)
+	}
+	objects, err := inventory.Scan(fs, "/downstream")
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	result, err := policies.Evaluate(context.Background(), accounts, objects)
+	if err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+	var denies []string
+	for _, f := range result.Denies {
+		denies = append(denies, f.Object.Path+": "+f.Message)
+	}
+	want := []string{"tenant-X/aws-1234/us-east-1/bucket-A.tf.json: bucket A must not be created in prod"}
+	if diff := cmp.Diff(want, denies); diff != "" {
+		t.Errorf("Evaluate() denies mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEvaluate_shared(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	policy := `package codegen
+
+deny contains msg if {
+	input.object.kind == "Application"
+	input.object.spec.project == "default"
+	msg := sprintf("application %s must not use the default project", [input.object.metadata.name])
+}
+`
+	if err := afero.WriteFile(fs, "/policy/gitops.rego", []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	policies, err := Load(context.Background(), fs, "/policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The Argo CD Applications live outside the tenants dir, and are scanned all the same.
+	accounts := []*account.Account{
+		{AccountID: "1234", CloudProvider: "aws", Tags: map[key.Key]string{key.Env: "prod"}},
+	}
+	tuples := []*internal.TenantTuple{
+		{
+			TenantID:       "tenant-X",
+			Env:            "prod",
+			ResourceConfig: &resource.ResourceConfig{Buckets: []*resource.Bucket{{Name: "A", Region: "us-east-1"}}},
+		},
+	}
+	codegen := generator.NewCodegen(
+		generator.WithFs(fs),
+		generator.WithGitOps(&generator.GitOpsConfig{
+			Flavor:      generator.GitOpsFlavorArgoCD,
+			Granularity: generator.GitOpsGranularityLeaf,
+			Namespace:   "argocd",
+			RepoURL:     "https://github.com/org/downstream",
+			Revision:    "HEAD",
+			Project:     "default",
+		}),
+	)
+	if err := codegen.FanOutArtifacts(context.Background(), "/downstream", accounts, tuples); err != nil {
+		t.Fatalf("FanOutArtifacts() error = %v", err)
+	}
+	objects, err := inventory.Scan(fs, "/downstream")
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	result, err := policies.Evaluate(context.Background(), accounts, objects)
+	if err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+	var denies []string
+	for _, f := range result.Denies {
+		denies = append(denies, f.Object.Path+": "+f.Message)
+	}
+	want := []string{"_output/gitops/tenant-X-aws-1234-us-east-1.yaml: application tenant-X-aws-1234-us-east-1 must not use the default project"}
+	if diff := cmp.Diff(want, denies); diff != "" {
+		t.Errorf("Evaluate() denies mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,62 @@
+package prow
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/prow/pkg/github"
+)
+
+// checkSuiteEvent is the part of a check_suite event that the plugin reads.
+type checkSuiteEvent struct {
+	Action     string            `json:"action"`
+	CheckSuite github.CheckSuite `json:"check_suite"`
+	Repo       github.Repo       `json:"repository"`
+}
+
+// handleChecks merges the downstream PRs at 'sha' that wait for their checks to be auto-merged,
+// once a status or a check suite of the commit succeeded.
+func (p *Plugin) handleChecks(l logr.Logger, org, repo, sha string) error {
+	prs, err := p.gitWorker.AutoMergePullRequests(org, repo, sha)
+	if err != nil {
+		return fmt.Errorf("failed to list the PRs to auto-merge: %w", err)
+	}
+
+	var errs []error
+	for _, pr := range prs {
+		method := p.autoMergeMethodOf(pr)
+		if method == "" {
+			l.Info("ignoring PR, its target doesn't auto-merge anymore", "pr", pr.Number)
+			continue
+		}
+		merged, err := p.gitWorker.MergeIfChecksPassed(org, repo, pr, method)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to auto-merge #%d: %w", pr.Number, err))
+			continue
+		}
+		if merged {
+			l.Info("🤖 Auto-merged the downstream PR.", "pr", pr.Number, "sha", sha)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// autoMergeMethodOf returns the merge method of the target of the downstream 'pr' in the current
+// config, or "" if the target doesn't auto-merge.
+func (p *Plugin) autoMergeMethodOf(pr *github.PullRequest) string {
+	upstreamRepo := p.gitWorker.UpstreamOf(pr)
+	if upstreamRepo == nil {
+		return ""
+	}
+	mapping := p.mappingFor(upstreamRepo.Org, upstreamRepo.Name)
+	if mapping == nil {
+		return ""
+	}
+	for _, target := range mapping.Targets() {
+		if target.Downstream == pr.Base.Repo.FullName && target.TargetBranch == pr.Base.Ref && target.AutoMerge != nil {
+			return target.AutoMerge.Method
+		}
+	}
+	return ""
+}
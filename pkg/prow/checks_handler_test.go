@@ -0,0 +1,44 @@
+package prow
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/prow/pkg/github"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/config"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/git"
+)
+
+func TestPlugin_handleChecks(t *testing.T) {
+	pr := func(number int, base string) *github.PullRequest {
+		pr := &github.PullRequest{Number: number}
+		pr.Base.Repo.FullName = "foo/gitops"
+		pr.Base.Ref = base
+		return pr
+	}
+	worker := &fakeWorker{
+		upstreams: map[int]*git.GHRepo{
+			1: {Org: "foo", Name: "infra", PullRequestNumber: 42},
+			2: {Org: "foo", Name: "infra", PullRequestNumber: 43},
+			3: {Org: "foo", Name: "legacy", PullRequestNumber: 7},
+		},
+		autoMergePRs: []*github.PullRequest{pr(1, "nonprod"), pr(2, "release"), pr(3, "nonprod")},
+	}
+	cfg := &config.Config{Repos: map[string]*config.Mapping{
+		"foo/infra": {
+			Downstream:   "foo/gitops",
+			TargetBranch: "nonprod",
+			AutoMerge:    &config.AutoMerge{LowRiskEnvs: []string{"dev"}, Method: "rebase"},
+		},
+	}}
+	p := &Plugin{gitWorker: worker, configAgent: config.NewStaticAgent(cfg), logger: logr.Discard()}
+	if err := p.handleChecks(logr.Discard(), "foo", "gitops", "abc"); err != nil {
+		t.Fatalf("handleChecks() error = %v", err)
+	}
+	// Only the PR of a target that still auto-merges is merged, with the method of the target.
+	if diff := cmp.Diff([]string{"#1:rebase"}, worker.merges); diff != "" {
+		t.Errorf("handleChecks() merges mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -25,6 +25,16 @@ func (p *Plugin) handleIssueComment(l logr.Logger, ic github.IssueCommentEvent)
 		github.PrLogField, num,
 	)
 
+	mapping := p.mappingFor(org, repo)
+	if mapping == nil {
+		l.Info("ignoring comment, no downstream repo is configured")
+		return nil
+	}
+
+	if match := codegenAtRe.FindStringSubmatch(ic.Comment.Body); match != nil {
+		return p.handleCodegenAt(l, ic, mapping, match[1])
+	}
+
 	// If the command is /codegen-dryrun, create a downstream PR and close it immediately.
 	if codegenDryrunRe.MatchString(ic.Comment.Body) {
 		pr, err := p.gitWorker.GetPullRequest(org, repo, num)
@@ -39,9 +49,11 @@ func (p *Plugin) handleIssueComment(l logr.Logger, ic github.IssueCommentEvent)
 			Name:              repo,
 			PullRequestNumber: num,
 			MergeSHA:          *pr.MergeSHA,
+			Author:            pr.User.Login,
+			AuthorEmail:       noReplyEmail(pr.User),
 		}
 		// Create a dry-run PR.
-		return p.createPullRequest(upstreamRepo, git.NewDryrunPRModifier())
+		return p.createPullRequest(upstreamRepo, mapping, git.NewDryrunPRModifier())
 	}
 
 	if !codegenRe.MatchString(ic.Comment.Body) {
@@ -50,8 +62,8 @@ func (p *Plugin) handleIssueComment(l logr.Logger, ic github.IssueCommentEvent)
 	l.Info("🚀 Requested a downstream codegen.")
 
 	// Add the label and let PR handler process the codegen request.
-	if err := p.gitWorker.AddLabel(org, repo, num, CodegenLabel); err != nil {
-		return fmt.Errorf("failed to add label %q: %w", CodegenLabel, err)
+	if err := p.gitWorker.AddLabel(org, repo, num, mapping.Label); err != nil {
+		return fmt.Errorf("failed to add label %q: %w", mapping.Label, err)
 	}
 	return nil
 }
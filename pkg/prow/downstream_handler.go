@@ -0,0 +1,148 @@
+package prow
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/prow/pkg/github"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/git"
+)
+
+// The labels of an upstream PR reflecting the state of its downstream PR.
+const (
+	LabelOpen   = "codegen/open"
+	LabelMerged = "codegen/merged"
+	LabelClosed = "codegen/closed"
+)
+
+var lifecycleLabels = []string{LabelOpen, LabelMerged, LabelClosed}
+
+// handleDownstreamPullRequest mirrors the state of a downstream PR generated by the bot to its
+// upstream PR, with a status comment per downstream PR, and a label for the state of all its
+// downstream PRs.
+func (p *Plugin) handleDownstreamPullRequest(l logr.Logger, pre github.PullRequestEvent, upstreamRepo *git.GHRepo) error {
+	pr := pre.PullRequest
+	// Dry-run PRs are closed right after they are created.
+	if strings.HasSuffix(pr.Head.Ref, git.NewDryrunPRModifier().BranchPostFix()) {
+		return nil
+	}
+
+	// Most actions, e.g., edited or synchronize, leave the state of the downstream PR alone.
+	if downstreamLabel(pre.Action, &pr) == "" {
+		return nil
+	}
+	upstreamPR, err := p.gitWorker.GetPullRequest(upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber)
+	if err != nil {
+		return fmt.Errorf("failed to get the upstream PR: %w", err)
+	}
+	prs, err := p.gitWorker.DownstreamPullRequests(upstreamRepo, p.downstreamsOf(upstreamRepo, pr.Base.Repo.FullName))
+	if err != nil {
+		return fmt.Errorf("failed to list the downstream PRs: %w", err)
+	}
+	label := lifecycleLabel(&pr, prs)
+	l.Info("mirroring the downstream PR", "action", pre.Action, "upstream", fmt.Sprintf("%s/%s#%d", upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber))
+
+	var errs []error
+	for _, existing := range upstreamPR.Labels {
+		if existing.Name != label && isLifecycleLabel(existing.Name) {
+			if err := p.gitWorker.RemoveLabel(upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber, existing.Name); err != nil {
+				errs = append(errs, fmt.Errorf("failed to remove label %q: %w", existing.Name, err))
+			}
+		}
+	}
+	if err := p.gitWorker.AddLabel(upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber, label); err != nil {
+		errs = append(errs, fmt.Errorf("failed to add label %q: %w", label, err))
+	}
+	if status := downstreamStatus(pre.Action, &pr, upstreamPR.User.Login); status != "" {
+		marker := fmt.Sprintf("<!-- %s status of %s -->", PluginName, pr.HTMLURL)
+		if err := p.gitWorker.UpsertComment(upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber, marker, marker+"\n"+status); err != nil {
+			errs = append(errs, fmt.Errorf("failed to comment: %w", err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// downstreamLabel returns the label of the downstream PR alone after the 'action' on it, or
+// "" if the action doesn't change its state.
+func downstreamLabel(action github.PullRequestEventAction, pr *github.PullRequest) string {
+	switch action {
+	case github.PullRequestActionOpened, github.PullRequestActionReopened:
+		return LabelOpen
+	case github.PullRequestActionClosed:
+		if pr.Merged {
+			return LabelMerged
+		}
+		return LabelClosed
+	}
+	return ""
+}
+
+// downstreamStatus returns the status comment of the upstream PR after the 'action' on the
+// downstream PR, or "" if there is nothing to tell.
+func downstreamStatus(action github.PullRequestEventAction, pr *github.PullRequest, upstreamAuthor string) string {
+	switch action {
+	case github.PullRequestActionReopened:
+		return fmt.Sprintf("🔄 The downstream PR %s was reopened.", pr.HTMLURL)
+	case github.PullRequestActionClosed:
+		if pr.Merged {
+			return fmt.Sprintf("✅ The downstream PR %s was merged.", pr.HTMLURL)
+		}
+		return fmt.Sprintf("⚠️ @%s The downstream PR %s was closed without being merged, so the changes of this PR are not applied downstream.",
+			upstreamAuthor, pr.HTMLURL)
+	}
+	// The upstream PR is already told about a new PR.
+	return ""
+}
+
+// downstreamsOf returns the downstream repos of the upstream PR: the ones of its mapping, and
+// 'downstream' which might have been dropped from the config since.
+func (p *Plugin) downstreamsOf(upstreamRepo *git.GHRepo, downstream string) []string {
+	downstreams := sets.New(downstream)
+	if mapping := p.mappingFor(upstreamRepo.Org, upstreamRepo.Name); mapping != nil {
+		for _, target := range mapping.Targets() {
+			downstreams.Insert(target.Downstream)
+		}
+	}
+	return sets.List(downstreams)
+}
+
+// lifecycleLabel returns the label of an upstream PR from the state of its downstream PRs:
+// merged once all of them are merged, closed if any was closed without being merged, and
+// open otherwise. 'pr' is the PR of the event, which the search might not return yet, or
+// in its previous state.
+func lifecycleLabel(pr *github.PullRequest, prs []*github.PullRequest) string {
+	all := []*github.PullRequest{pr}
+	for _, other := range prs {
+		if other.Base.Repo.FullName != pr.Base.Repo.FullName || other.Number != pr.Number {
+			all = append(all, other)
+		}
+	}
+
+	label := LabelMerged
+	for _, other := range all {
+		// Dry-run PRs are closed right after they are created.
+		if strings.HasSuffix(other.Head.Ref, git.NewDryrunPRModifier().BranchPostFix()) {
+			continue
+		}
+		switch {
+		case other.State == github.PullRequestStateClosed && !other.Merged:
+			return LabelClosed
+		case !other.Merged:
+			label = LabelOpen
+		}
+	}
+	return label
+}
+
+func isLifecycleLabel(label string) bool {
+	for _, l := range lifecycleLabels {
+		if label == l {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package prow
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/prow/pkg/github"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/config"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/git"
+)
+
+func Test_downstreamStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		action     github.PullRequestEventAction
+		merged     bool
+		wantLabel  string
+		wantStatus string
+	}{
+		{
+			name:      "opened",
+			action:    github.PullRequestActionOpened,
+			wantLabel: LabelOpen,
+		},
+		{
+			name:       "reopened",
+			action:     github.PullRequestActionReopened,
+			wantLabel:  LabelOpen,
+			wantStatus: "🔄 The downstream PR https://github.com/foo/gitops/pull/1 was reopened.",
+		},
+		{
+			name:       "merged",
+			action:     github.PullRequestActionClosed,
+			merged:     true,
+			wantLabel:  LabelMerged,
+			wantStatus: "✅ The downstream PR https://github.com/foo/gitops/pull/1 was merged.",
+		},
+		{
+			name:      "closed without being merged",
+			action:    github.PullRequestActionClosed,
+			wantLabel: LabelClosed,
+			wantStatus: "⚠️ @alice The downstream PR https://github.com/foo/gitops/pull/1 was closed without being merged, " +
+				"so the changes of this PR are not applied downstream.",
+		},
+		{
+			name:   "edited",
+			action: github.PullRequestActionEdited,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr := &github.PullRequest{HTMLURL: "https://github.com/foo/gitops/pull/1", Merged: tt.merged}
+			if label := downstreamLabel(tt.action, pr); label != tt.wantLabel {
+				t.Errorf("downstreamLabel() = %q, want %q", label, tt.wantLabel)
+			}
+			if diff := cmp.Diff(tt.wantStatus, downstreamStatus(tt.action, pr, "alice")); diff != "" {
+				t.Errorf("downstreamStatus() status mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_lifecycleLabel(t *testing.T) {
+	pr := func(repo string, number int, state string, merged bool, branch string) *github.PullRequest {
+		pr := &github.PullRequest{Number: number, State: state, Merged: merged}
+		pr.Base.Repo.FullName = repo
+		pr.Head.Ref = branch
+		return pr
+	}
+	tests := []struct {
+		name string
+		pr   *github.PullRequest
+		prs  []*github.PullRequest
+		want string
+	}{
+		{
+			name: "the only downstream PR is merged",
+			pr:   pr("foo/gitops", 1, github.PullRequestStateClosed, true, "infra-42"),
+			want: LabelMerged,
+		},
+		{
+			name: "merged while another downstream PR is open",
+			pr:   pr("foo/gitops", 1, github.PullRequestStateClosed, true, "infra-42"),
+			prs: []*github.PullRequest{
+				pr("foo/gitops", 1, github.PullRequestStateClosed, true, "infra-42"),
+				pr("bar/gitops", 7, github.PullRequestStateOpen, false, "infra-42"),
+			},
+			want: LabelOpen,
+		},
+		{
+			name: "the last downstream PR is merged",
+			pr:   pr("bar/gitops", 7, github.PullRequestStateClosed, true, "infra-42"),
+			prs: []*github.PullRequest{
+				pr("foo/gitops", 1, github.PullRequestStateClosed, true, "infra-42"),
+			},
+			want: LabelMerged,
+		},
+		{
+			name: "merged after another downstream PR was closed",
+			pr:   pr("bar/gitops", 7, github.PullRequestStateClosed, true, "infra-42"),
+			prs: []*github.PullRequest{
+				pr("foo/gitops", 1, github.PullRequestStateClosed, false, "infra-42"),
+				pr("bar/gitops", 7, github.PullRequestStateOpen, false, "infra-42"),
+			},
+			want: LabelClosed,
+		},
+		{
+			name: "the search returns the previous state of the PR",
+			pr:   pr("foo/gitops", 1, github.PullRequestStateOpen, false, "infra-42"),
+			prs: []*github.PullRequest{
+				pr("foo/gitops", 1, github.PullRequestStateClosed, false, "infra-42"),
+			},
+			want: LabelOpen,
+		},
+		{
+			name: "closed dry-run PRs are ignored",
+			pr:   pr("foo/gitops", 1, github.PullRequestStateClosed, true, "infra-42"),
+			prs: []*github.PullRequest{
+				pr("foo/gitops", 2, github.PullRequestStateClosed, false, "infra-42-dryrun"),
+			},
+			want: LabelMerged,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lifecycleLabel(tt.pr, tt.prs); got != tt.want {
+				t.Errorf("lifecycleLabel() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlugin_handleDownstreamPullRequest_ignoredAction(t *testing.T) {
+	worker := &fakeWorker{}
+	p := &Plugin{gitWorker: worker, configAgent: config.NewStaticAgent(&config.Config{}), logger: logr.Discard()}
+	pre := github.PullRequestEvent{Action: github.PullRequestActionSynchronize}
+	pre.PullRequest.Head.Ref = "infra-42"
+	upstreamRepo := &git.GHRepo{Org: "foo", Name: "infra", PullRequestNumber: 42}
+	if err := p.handleDownstreamPullRequest(logr.Discard(), pre, upstreamRepo); err != nil {
+		t.Fatalf("handleDownstreamPullRequest() error = %v", err)
+	}
+	// The upstream PR isn't even read for an action that leaves the downstream PR alone.
+	if len(worker.fetched) != 0 || len(worker.comments) != 0 {
+		t.Errorf("handleDownstreamPullRequest() fetched %v and commented %v, want nothing", worker.fetched, worker.comments)
+	}
+}
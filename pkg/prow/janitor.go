@@ -0,0 +1,13 @@
+package prow
+
+import "time"
+
+// CleanUpBranches deletes the stale branches of the generated PRs in all the downstream
+// repos. It's meant to be called periodically.
+func (p *Plugin) CleanUpBranches(maxAge time.Duration) {
+	for _, downstream := range p.configAgent.Config().Downstreams() {
+		if err := p.gitWorker.CleanUpBranches(downstream, maxAge); err != nil {
+			p.logger.Error(err, "failed to clean up the stale branches", "downstream", downstream.Downstream)
+		}
+	}
+}
@@ -8,10 +8,12 @@ import (
 	"sync"
 
 	"github.com/go-logr/logr"
-	"sigs.k8s.io/prow/pkg/config"
+	prowconfig "sigs.k8s.io/prow/pkg/config"
 	"sigs.k8s.io/prow/pkg/github"
 	"sigs.k8s.io/prow/pkg/pluginhelp"
 
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/config"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/generator"
 	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/git"
 )
 
@@ -22,6 +24,9 @@ const (
 var (
 	codegenRe       = regexp.MustCompile(`(?mi)^/codegen\s*$`)
 	codegenDryrunRe = regexp.MustCompile(`(?mi)^/codegen-dryrun\s*$`)
+	// codegenAtRe captures the argument of /codegen-at, which is validated by shaRe.
+	codegenAtRe = regexp.MustCompile(`(?mi)^/codegen-at(?:[ \t]+(\S+))?[ \t]*$`)
+	shaRe       = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
 )
 
 var _ http.Handler = &Plugin{}
@@ -33,6 +38,9 @@ type Plugin struct {
 
 	tokenGenerator func() []byte
 	gitWorker      git.Worker
+	configAgent    *config.Agent
+	// codegenOpts are shared by all the targets, which set their own output root and filter.
+	codegenOpts []generator.CodegenOption
 
 	logger logr.Logger
 }
@@ -40,14 +48,34 @@ type Plugin struct {
 func NewPlugin(
 	tokenGenerator func() []byte,
 	gitWorker git.Worker,
+	configAgent *config.Agent,
+	codegenOpts []generator.CodegenOption,
 ) *Plugin {
 	return &Plugin{
 		tokenGenerator: tokenGenerator,
 		gitWorker:      gitWorker,
+		configAgent:    configAgent,
+		codegenOpts:    codegenOpts,
 		logger:         gitWorker.Logger(),
 	}
 }
 
+// mappingFor returns the mapping of the upstream repo in the current config, or nil
+// if the repo is not configured.
+func (p *Plugin) mappingFor(org, repo string) *config.Mapping {
+	return p.configAgent.Config().MappingFor(org, repo)
+}
+
+// codegenFor returns the codegen of the given target, which generates its slice of the output.
+func (p *Plugin) codegenFor(target *config.Target) *generator.Codegen {
+	opts := append([]generator.CodegenOption{}, p.codegenOpts...)
+	opts = append(opts, generator.WithOutputRoot(target.OutputRoot))
+	if target.Filter != nil {
+		opts = append(opts, generator.WithFilter(target.Filter))
+	}
+	return generator.NewCodegen(opts...)
+}
+
 // ServeHTTP validates an incoming webhook and puts it into the event channel.
 func (p *Plugin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	eventType, eventGUID, payload, ok, _ := github.ValidateWebhook(w, r, p.tokenGenerator)
@@ -89,6 +117,32 @@ func (p *Plugin) handleEvent(eventType, eventGUID string, payload []byte) error
 				logger.Error(err, fmt.Sprintf("%v failed.", PluginName))
 			}
 		}()
+	case "status":
+		var se github.StatusEvent
+		if err := json.Unmarshal(payload, &se); err != nil {
+			return err
+		}
+		if se.State != github.StatusSuccess {
+			return nil
+		}
+		go func() {
+			if err := p.handleChecks(logger, se.Repo.Owner.Login, se.Repo.Name, se.SHA); err != nil {
+				logger.Error(err, fmt.Sprintf("%v failed.", PluginName))
+			}
+		}()
+	case "check_suite":
+		var cs checkSuiteEvent
+		if err := json.Unmarshal(payload, &cs); err != nil {
+			return err
+		}
+		if cs.Action != "completed" || cs.CheckSuite.Conclusion != "success" {
+			return nil
+		}
+		go func() {
+			if err := p.handleChecks(logger, cs.Repo.Owner.Login, cs.Repo.Name, cs.CheckSuite.HeadSHA); err != nil {
+				logger.Error(err, fmt.Sprintf("%v failed.", PluginName))
+			}
+		}()
 	default:
 		logger.Info("skipping event")
 	}
@@ -96,7 +150,7 @@ func (p *Plugin) handleEvent(eventType, eventGUID string, payload []byte) error
 }
 
 // HelpProvider construct the pluginhelp.PluginHelp for this plugin.
-func HelpProvider(_ []config.OrgRepo) (*pluginhelp.PluginHelp, error) {
+func HelpProvider(_ []prowconfig.OrgRepo) (*pluginhelp.PluginHelp, error) {
 	pluginHelp := &pluginhelp.PluginHelp{
 		Description: fmt.Sprintf("The %s plugin is used to automatically create downstream PRs.", PluginName),
 	}
@@ -107,5 +161,11 @@ func HelpProvider(_ []config.OrgRepo) (*pluginhelp.PluginHelp, error) {
 		WhoCanUse:   "Anyone",
 		Examples:    []string{"/deploy"},
 	})
+	pluginHelp.AddCommand(pluginhelp.Command{
+		Usage:       "/codegen-at <sha>",
+		Description: "Create downstream PRs rolling back to the artifacts generated from an upstream commit",
+		WhoCanUse:   "Maintainers of the upstream repo",
+		Examples:    []string{"/codegen-at 1a2b3c4"},
+	})
 	return pluginHelp, nil
 }
@@ -3,20 +3,23 @@ package prow
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/go-logr/logr"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"sigs.k8s.io/prow/pkg/github"
 
-	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/generator"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/config"
 	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/git"
-)
-
-const (
-	CodegenLabel           = "post-merge/codegen"
-	KubeConCodegenRepoName = "Huang-Wei/25-kubecon-jp-codegen"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/quota"
 )
 
 func (p *Plugin) handlePullRequest(l logr.Logger, pre github.PullRequestEvent) error {
+	// The downstream PRs generated by the bot are mirrored to their upstream PR.
+	if upstreamRepo := p.gitWorker.UpstreamOf(&pre.PullRequest); upstreamRepo != nil {
+		return p.handleDownstreamPullRequest(l, pre, upstreamRepo)
+	}
+
 	// Only consider newly merged PRs
 	if pre.Action != github.PullRequestActionClosed && pre.Action != github.PullRequestActionLabeled {
 		l.Info("ignoring event, not one of (closed, labeled)")
@@ -43,19 +46,25 @@ func (p *Plugin) handlePullRequest(l logr.Logger, pre github.PullRequestEvent) e
 		github.PrLogField, num,
 	)
 
+	mapping := p.mappingFor(org, repo)
+	if mapping == nil {
+		l.Info("ignoring event, no downstream repo is configured")
+		return nil
+	}
+
 	hasLabel := false
 	for _, label := range pr.Labels {
-		if label.Name == CodegenLabel {
+		if label.Name == mapping.Label {
 			hasLabel = true
 			break
 		}
 	}
 
 	if !hasLabel {
-		l.Info(fmt.Sprintf("PR was merged or labels were changed, but label %q is not present", CodegenLabel))
+		l.Info(fmt.Sprintf("PR was merged or labels were changed, but label %q is not present", mapping.Label))
 		return nil
 	}
-	l.Info(fmt.Sprintf("PR is labeled with %q, proceeding with codegen", CodegenLabel))
+	l.Info(fmt.Sprintf("PR is labeled with %q, proceeding with codegen", mapping.Label))
 
 	p.Lock()
 	defer p.Unlock()
@@ -65,30 +74,93 @@ func (p *Plugin) handlePullRequest(l logr.Logger, pre github.PullRequestEvent) e
 		Name:              repo,
 		PullRequestNumber: num,
 		MergeSHA:          mergeSHA,
+		Author:            pr.User.Login,
+		AuthorEmail:       noReplyEmail(pr.User),
 	}
 
-	return p.createPullRequest(upstreamRepo, git.NewDeployPRModifier())
+	return p.createPullRequest(upstreamRepo, mapping, git.NewDeployPRModifier())
 }
 
-func (p *Plugin) createPullRequest(upstreamRepo *git.GHRepo, prModifier git.PullRequestModifier) error {
+func (p *Plugin) createPullRequest(upstreamRepo *git.GHRepo, mapping *config.Mapping, prModifier git.PullRequestModifier) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	// Pre-process the user input in the upstream repo.
-	accounts, tenantTuples, err := p.gitWorker.FetchUpstreamConfigs(ctx, upstreamRepo)
+	upstreamConfig, err := p.gitWorker.FetchUpstreamConfigs(ctx, upstreamRepo)
 	if err != nil {
 		return err
 	}
 
-	// Create a downstream codegen PR.
-	cg := generator.NewCodegen()
-	return p.gitWorker.CreatePullRequest(
-		ctx,
-		upstreamRepo,
-		prModifier,
-		KubeConCodegenRepoName,
-		accounts,
-		tenantTuples,
-		cg.FanOutArtifacts,
-	)
+	// Report the quota violations to the upstream PR instead of generating the artifacts.
+	if violations := quota.Evaluate(upstreamConfig.Quota, upstreamConfig.Accounts, upstreamConfig.TenantTuples); len(violations) != 0 {
+		p.logger.Info("quota exceeded, skipping codegen", "violations", len(violations))
+		return p.gitWorker.CreateComment(upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber, quota.Markdown(violations, git.QuotaPath))
+	}
+
+	// Create a downstream codegen PR per target, and report them in a single comment.
+	targets := mapping.Targets()
+	reports := make([]*targetReport, 0, len(targets))
+	var errs []error
+	for _, target := range targets {
+		result, err := p.gitWorker.CreatePullRequest(
+			ctx,
+			upstreamRepo,
+			prModifier,
+			target.Mapping,
+			upstreamConfig,
+			p.codegenFor(target).FanOutArtifacts,
+		)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to create a PR in %s: %w", target.Downstream, err))
+		}
+		reports = append(reports, &targetReport{target: target, result: result, err: err})
+	}
+	if err := p.gitWorker.CreateComment(upstreamRepo.Org, upstreamRepo.Name, upstreamRepo.PullRequestNumber, statusComment(reports)); err != nil {
+		// The next run reports the recorded results again.
+		errs = append(errs, fmt.Errorf("failed to create comment: %w", err))
+		return utilerrors.NewAggregate(errs)
+	}
+	for _, report := range reports {
+		if report.err != nil {
+			continue
+		}
+		if err := p.gitWorker.ClearPipelineState(upstreamRepo, prModifier, report.target.Mapping); err != nil {
+			errs = append(errs, fmt.Errorf("failed to clear the pipeline state of %s: %w", report.target.Downstream, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// noReplyEmail returns the email that GitHub attributes to the user without disclosing
+// their email address.
+func noReplyEmail(user github.User) string {
+	return fmt.Sprintf("%d+%s@users.noreply.github.com", user.ID, user.Login)
+}
+
+// targetReport is the outcome of the codegen of a target.
+type targetReport struct {
+	target *config.Target
+	result *git.Result
+	err    error
+}
+
+// statusComment renders the outcome of all the targets as the comment of the upstream PR.
+// A single target is reported as is.
+func statusComment(reports []*targetReport) string {
+	message := func(report *targetReport) string {
+		if report.err != nil {
+			return fmt.Sprintf("❌ Failed to generate a PR in %s:\n```\n%v\n```", report.target.Downstream, report.err)
+		}
+		return report.result.Comment
+	}
+	if len(reports) == 1 {
+		return message(reports[0])
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Codegen results of %d downstream repos:", len(reports))
+	for _, report := range reports {
+		fmt.Fprintf(&sb, "\n\n#### %s (`%s`)\n\n%s", report.target.Downstream, report.target.TargetBranch, message(report))
+	}
+	return sb.String()
 }
@@ -0,0 +1,56 @@
+package prow
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/config"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/git"
+)
+
+func Test_statusComment(t *testing.T) {
+	target := func(downstream, branch string) *config.Target {
+		return &config.Target{Mapping: &config.Mapping{Downstream: downstream, TargetBranch: branch}}
+	}
+	tests := []struct {
+		name    string
+		reports []*targetReport
+		want    string
+	}{
+		{
+			name: "a single target is reported as is",
+			reports: []*targetReport{
+				{target: target("foo/gitops", "main"), result: &git.Result{Comment: "PR created: https://github.com/foo/gitops/pull/1"}},
+			},
+			want: "PR created: https://github.com/foo/gitops/pull/1",
+		},
+		{
+			name: "a single failed target",
+			reports: []*targetReport{
+				{target: target("foo/gitops", "main"), err: errors.New("push rejected")},
+			},
+			want: "❌ Failed to generate a PR in foo/gitops:\n```\npush rejected\n```",
+		},
+		{
+			name: "a section per target",
+			reports: []*targetReport{
+				{target: target("foo/gitops", "main"), result: &git.Result{Comment: "PR created: https://github.com/foo/gitops/pull/1"}},
+				{target: target("foo/gitops", "prod"), err: errors.New("push rejected")},
+				{target: target("bar/gitops", "main"), result: &git.Result{Comment: "No changes."}},
+			},
+			want: "Codegen results of 3 downstream repos:" +
+				"\n\n#### foo/gitops (`main`)\n\nPR created: https://github.com/foo/gitops/pull/1" +
+				"\n\n#### foo/gitops (`prod`)\n\n❌ Failed to generate a PR in foo/gitops:\n```\npush rejected\n```" +
+				"\n\n#### bar/gitops (`main`)\n\nNo changes.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, statusComment(tt.reports)); diff != "" {
+				t.Errorf("statusComment() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
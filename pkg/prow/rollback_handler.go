@@ -0,0 +1,51 @@
+package prow
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/prow/pkg/github"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/config"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/git"
+)
+
+// handleCodegenAt regenerates the downstream from the upstream commit 'ref' of a `/codegen-at`
+// command, and opens rollback PRs showing the diff against the current downstream.
+func (p *Plugin) handleCodegenAt(l logr.Logger, ic github.IssueCommentEvent, mapping *config.Mapping, ref string) error {
+	org := ic.Repo.Owner.Login
+	repo := ic.Repo.Name
+	num := ic.Issue.Number
+	user := ic.Comment.User
+
+	maintainer, err := p.gitWorker.IsMaintainer(org, repo, user.Login)
+	if err != nil {
+		return fmt.Errorf("failed to get the permission of %s: %w", user.Login, err)
+	}
+	if !maintainer {
+		l.Info("ignoring /codegen-at, not requested by a maintainer", "user", user.Login)
+		return p.gitWorker.CreateComment(org, repo, num, fmt.Sprintf("@%s Only the maintainers of %s/%s can run `/codegen-at`.", user.Login, org, repo))
+	}
+	if !shaRe.MatchString(ref) {
+		return p.gitWorker.CreateComment(org, repo, num, fmt.Sprintf("@%s Usage: `/codegen-at <sha>`, where `<sha>` is a commit of %s/%s.", user.Login, org, repo))
+	}
+	sha, err := p.gitWorker.ResolveCommit(org, repo, ref)
+	if err != nil {
+		l.Error(err, "failed to resolve the commit", "ref", ref)
+		return p.gitWorker.CreateComment(org, repo, num, fmt.Sprintf("@%s Cannot find the commit `%s` in %s/%s.", user.Login, ref, org, repo))
+	}
+	l.Info("⏪ Requested a downstream rollback.", "sha", sha)
+
+	p.Lock()
+	defer p.Unlock()
+
+	upstreamRepo := &git.GHRepo{
+		Org:               org,
+		Name:              repo,
+		PullRequestNumber: num,
+		MergeSHA:          sha,
+		Author:            user.Login,
+		AuthorEmail:       noReplyEmail(user),
+	}
+	return p.createPullRequest(upstreamRepo, mapping, git.NewRollbackPRModifier(sha))
+}
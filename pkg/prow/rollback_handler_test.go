@@ -0,0 +1,141 @@
+package prow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/prow/pkg/github"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/config"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/git"
+)
+
+// fakeWorker records the comments and the PRs of the plugin.
+type fakeWorker struct {
+	git.Worker
+	maintainers sets.Set[string]
+	commits     map[string]string
+	comments    []string
+	branches    []string
+	// upstreams maps the downstream PRs to their upstream PR.
+	upstreams    map[int]*git.GHRepo
+	autoMergePRs []*github.PullRequest
+	merges       []string
+	// fetched records the PRs read by GetPullRequest.
+	fetched []string
+}
+
+func (f *fakeWorker) IsMaintainer(org, repo, user string) (bool, error) {
+	return f.maintainers.Has(user), nil
+}
+
+func (f *fakeWorker) ResolveCommit(org, repo, ref string) (string, error) {
+	if sha, ok := f.commits[ref]; ok {
+		return sha, nil
+	}
+	return "", errors.New("422 No commit found for SHA")
+}
+
+func (f *fakeWorker) CreateComment(org, repo string, number int, comment string) error {
+	f.comments = append(f.comments, comment)
+	return nil
+}
+
+func (f *fakeWorker) FetchUpstreamConfigs(ctx context.Context, repo *git.GHRepo) (*git.UpstreamConfig, error) {
+	return &git.UpstreamConfig{}, nil
+}
+
+func (f *fakeWorker) CreatePullRequest(ctx context.Context, upstreamRepo *git.GHRepo, prModifier git.PullRequestModifier, mapping *config.Mapping, upstreamConfig *git.UpstreamConfig, codegenFunc git.CodegenFunc) (*git.Result, error) {
+	f.branches = append(f.branches, mapping.Downstream+":"+prModifier.BranchPostFix())
+	return &git.Result{Comment: "PR created"}, nil
+}
+
+func (f *fakeWorker) GetPullRequest(org, repo string, number int) (*github.PullRequest, error) {
+	f.fetched = append(f.fetched, fmt.Sprintf("%s/%s#%d", org, repo, number))
+	return &github.PullRequest{Number: number}, nil
+}
+
+func (f *fakeWorker) UpstreamOf(pr *github.PullRequest) *git.GHRepo {
+	return f.upstreams[pr.Number]
+}
+
+func (f *fakeWorker) AutoMergePullRequests(org, repo, sha string) ([]*github.PullRequest, error) {
+	return f.autoMergePRs, nil
+}
+
+func (f *fakeWorker) MergeIfChecksPassed(org, repo string, pr *github.PullRequest, method string) (bool, error) {
+	f.merges = append(f.merges, fmt.Sprintf("#%d:%s", pr.Number, method))
+	return true, nil
+}
+
+func (f *fakeWorker) ClearPipelineState(*git.GHRepo, git.PullRequestModifier, *config.Mapping) error {
+	return nil
+}
+
+func TestPlugin_handleCodegenAt(t *testing.T) {
+	const sha = "0123456789abcdef0123456789abcdef01234567"
+	tests := []struct {
+		name         string
+		user         string
+		ref          string
+		wantComments []string
+		wantBranches []string
+	}{
+		{
+			name:         "a maintainer rolls back to a commit",
+			user:         "alice",
+			ref:          "0123456",
+			wantComments: []string{"PR created"},
+			wantBranches: []string{"foo/gitops:-rollback-0123456"},
+		},
+		{
+			name:         "not a maintainer",
+			user:         "mallory",
+			ref:          "0123456",
+			wantComments: []string{"@mallory Only the maintainers of foo/infra can run `/codegen-at`."},
+		},
+		{
+			name:         "no commit",
+			user:         "alice",
+			wantComments: []string{"@alice Usage: `/codegen-at <sha>`, where `<sha>` is a commit of foo/infra."},
+		},
+		{
+			name:         "a branch instead of a commit",
+			user:         "alice",
+			ref:          "main",
+			wantComments: []string{"@alice Usage: `/codegen-at <sha>`, where `<sha>` is a commit of foo/infra."},
+		},
+		{
+			name:         "unknown commit",
+			user:         "alice",
+			ref:          "fedcba9",
+			wantComments: []string{"@alice Cannot find the commit `fedcba9` in foo/infra."},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			worker := &fakeWorker{maintainers: sets.New("alice"), commits: map[string]string{"0123456": sha}}
+			p := &Plugin{gitWorker: worker, logger: logr.Discard()}
+			var ic github.IssueCommentEvent
+			ic.Repo.Owner.Login = "foo"
+			ic.Repo.Name = "infra"
+			ic.Issue.Number = 42
+			ic.Comment.User.Login = tt.user
+
+			if err := p.handleCodegenAt(logr.Discard(), ic, &config.Mapping{Downstream: "foo/gitops", TargetBranch: "main"}, tt.ref); err != nil {
+				t.Fatalf("handleCodegenAt() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.wantComments, worker.comments); diff != "" {
+				t.Errorf("handleCodegenAt() comments mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantBranches, worker.branches); diff != "" {
+				t.Errorf("handleCodegenAt() PRs mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package quota
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/yaml"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/generator"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/internal"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/infra/account"
+)
+
+// Limits caps the resources of a scope. A nil field means unlimited.
+type Limits struct {
+	// MaxBuckets caps the number of buckets.
+	MaxBuckets *int `json:"maxBuckets,omitempty"`
+	// MaxQueues caps the number of queues.
+	MaxQueues *int `json:"maxQueues,omitempty"`
+	// MaxPlacements caps the number of (resource, account) pairs the resources fan out to.
+	MaxPlacements *int `json:"maxPlacements,omitempty"`
+	// MaxAccountsPerResource caps the number of accounts a single resource fans out to.
+	// It's ignored for accounts.
+	MaxAccountsPerResource *int `json:"maxAccountsPerResource,omitempty"`
+}
+
+// Config is the content of `infra/quota.yaml` in the upstream repo.
+type Config struct {
+	// Default applies to each tenant that's not listed in Tenants.
+	Default *Limits `json:"default,omitempty"`
+	// Tenants applies to all the resources of a tenant, across its envs.
+	Tenants map[string]*Limits `json:"tenants,omitempty"`
+	// Envs applies to the resources of each tenant in the env.
+	Envs map[string]*Limits `json:"envs,omitempty"`
+	// Accounts applies to all the resources placed in an account, across tenants.
+	Accounts map[string]*Limits `json:"accounts,omitempty"`
+}
+
+// Load loads the quota config at the given path. It returns nil if the file doesn't exist.
+func Load(fs afero.Fs, path string) (*Config, error) {
+	exists, err := afero.Exists(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if file exists %s: %w", path, err)
+	}
+	if !exists {
+		return nil, nil
+	}
+	data, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse '%s': %w", path, err)
+	}
+	return &config, nil
+}
+
+// Violation is an exceeded limit.
+type Violation struct {
+	// Scope is what the limit applies to, e.g. "tenant `foo`".
+	Scope string
+	// What is the limited quantity, e.g. "buckets".
+	What  string
+	Count int
+	Limit int
+}
+
+func (v *Violation) String() string {
+	return fmt.Sprintf("%s: %d %s exceed the limit of %d", v.Scope, v.Count, v.What, v.Limit)
+}
+
+// usage counts the resources of a scope.
+type usage struct {
+	buckets    int
+	queues     int
+	placements int
+	// accountsPerResource is keyed by "<kind> `<name>`".
+	accountsPerResource map[string]int
+}
+
+func newUsage() *usage {
+	return &usage{accountsPerResource: map[string]int{}}
+}
+
+// Evaluate checks the tenants' resources against the quota config. The violations are
+// sorted for a stable output.
+func Evaluate(config *Config, accounts []*account.Account, tenantTuples []*internal.TenantTuple) []*Violation {
+	if config == nil {
+		return nil
+	}
+
+	tenantUsages := map[string]*usage{}
+	accountUsages := map[string]*usage{}
+	var violations []*Violation
+
+	for _, tuple := range tenantTuples {
+		tenantUsage, ok := tenantUsages[tuple.TenantID]
+		if !ok {
+			tenantUsage = newUsage()
+			tenantUsages[tuple.TenantID] = tenantUsage
+		}
+		envUsage := newUsage()
+
+		place := func(kind, name string, matched []*account.Account) {
+			resource := fmt.Sprintf("%s `%s`", kind, name)
+			for _, u := range []*usage{tenantUsage, envUsage} {
+				u.placements += len(matched)
+				u.accountsPerResource[fmt.Sprintf("%s (env `%s`)", resource, tuple.Env)] = len(matched)
+			}
+			for _, act := range matched {
+				accountUsage, ok := accountUsages[act.AccountID]
+				if !ok {
+					accountUsage = newUsage()
+					accountUsages[act.AccountID] = accountUsage
+				}
+				accountUsage.placements++
+				if kind == "bucket" {
+					accountUsage.buckets++
+				} else {
+					accountUsage.queues++
+				}
+			}
+		}
+
+		if tuple.ResourceConfig != nil {
+			for _, bucket := range tuple.ResourceConfig.Buckets {
+				tenantUsage.buckets++
+				envUsage.buckets++
+				place("bucket", bucket.Name, generator.MatchedAccounts(accounts, tuple, bucket.Selector))
+			}
+		}
+		if tuple.Extension != nil {
+			for _, queue := range tuple.Extension.Queues {
+				tenantUsage.queues++
+				envUsage.queues++
+				place("queue", queue.Name, generator.MatchedAccounts(accounts, tuple, queue.Selector))
+			}
+		}
+
+		if limits := config.Envs[tuple.Env]; limits != nil {
+			violations = append(violations, check(fmt.Sprintf("tenant `%s` in env `%s`", tuple.TenantID, tuple.Env), limits, envUsage, true)...)
+		}
+	}
+
+	for tenantID, u := range tenantUsages {
+		limits, ok := config.Tenants[tenantID]
+		if !ok {
+			limits = config.Default
+		}
+		violations = append(violations, check(fmt.Sprintf("tenant `%s`", tenantID), limits, u, true)...)
+	}
+	for accountID, u := range accountUsages {
+		violations = append(violations, check(fmt.Sprintf("account `%s`", accountID), config.Accounts[accountID], u, false)...)
+	}
+
+	sort.Slice(violations, func(i, j int) bool {
+		return violations[i].String() < violations[j].String()
+	})
+	return violations
+}
+
+func check(scope string, limits *Limits, u *usage, perResource bool) []*Violation {
+	if limits == nil {
+		return nil
+	}
+	var violations []*Violation
+	exceeds := func(what string, count int, limit *int) {
+		if limit != nil && count > *limit {
+			violations = append(violations, &Violation{Scope: scope, What: what, Count: count, Limit: *limit})
+		}
+	}
+	exceeds("buckets", u.buckets, limits.MaxBuckets)
+	exceeds("queues", u.queues, limits.MaxQueues)
+	exceeds("placements", u.placements, limits.MaxPlacements)
+	if perResource {
+		for _, resource := range sets.List(sets.KeySet(u.accountsPerResource)) {
+			exceeds(fmt.Sprintf("accounts of %s", resource), u.accountsPerResource[resource], limits.MaxAccountsPerResource)
+		}
+	}
+	return violations
+}
+
+// Markdown renders the violations as a comment on the upstream PR.
+func Markdown(violations []*Violation, quotaPath string) string {
+	var sb strings.Builder
+	sb.WriteString("🚫 Codegen is blocked as the requested resources exceed the quota:\n\n")
+	for _, v := range violations {
+		fmt.Fprintf(&sb, "- %s\n", v)
+	}
+	fmt.Fprintf(&sb, "\nPlease reduce the resources, or ask the platform team to raise the limits in `%s`.", quotaPath)
+	return sb.String()
+}
@@ -0,0 +1,177 @@
+package quota
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/afero"
+	"k8s.io/utils/ptr"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/internal"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/common/selector"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/common/selector/key"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/common/selector/operator"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/infra/account"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/tenant/resource"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *Config
+		wantErr bool
+	}{
+		{
+			name: "no quota.yaml",
+		},
+		{
+			name: "valid quota.yaml",
+			content: `default:
+  maxBuckets: 10
+tenants:
+  tenant-X:
+    maxBuckets: 20
+envs:
+  prod:
+    maxAccountsPerResource: 2
+accounts:
+  "1234":
+    maxPlacements: 100
+`,
+			want: &Config{
+				Default:  &Limits{MaxBuckets: ptr.To(10)},
+				Tenants:  map[string]*Limits{"tenant-X": {MaxBuckets: ptr.To(20)}},
+				Envs:     map[string]*Limits{"prod": {MaxAccountsPerResource: ptr.To(2)}},
+				Accounts: map[string]*Limits{"1234": {MaxPlacements: ptr.To(100)}},
+			},
+		},
+		{
+			name:    "unknown field",
+			content: "default:\n  maxBucket: 10\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			if tt.content != "" {
+				if err := afero.WriteFile(fs, "/infra/quota.yaml", []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := Load(fs, "/infra/quota.yaml")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Load() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	accounts := []*account.Account{
+		{AccountID: "1234", CloudProvider: "aws", Tags: map[key.Key]string{key.Env: "prod"}},
+		{AccountID: "5678", CloudProvider: "aws", Tags: map[key.Key]string{key.Env: "prod"}},
+		{AccountID: "abcd", CloudProvider: "gcp", Tags: map[key.Key]string{key.Env: "dev"}},
+	}
+	tuple := func(tenantID, env string, buckets ...string) *internal.TenantTuple {
+		t := &internal.TenantTuple{
+			TenantID:       tenantID,
+			Env:            env,
+			ResourceConfig: &resource.ResourceConfig{},
+		}
+		for _, name := range buckets {
+			t.ResourceConfig.Buckets = append(t.ResourceConfig.Buckets, &resource.Bucket{Name: name, Region: "us-east-1"})
+		}
+		return t
+	}
+
+	tests := []struct {
+		name         string
+		config       *Config
+		tenantTuples []*internal.TenantTuple
+		want         []string
+	}{
+		{
+			name:         "no quota config",
+			tenantTuples: []*internal.TenantTuple{tuple("tenant-X", "prod", "A", "B")},
+		},
+		{
+			name: "within limits",
+			config: &Config{
+				Default: &Limits{MaxBuckets: ptr.To(2), MaxPlacements: ptr.To(4)},
+			},
+			tenantTuples: []*internal.TenantTuple{tuple("tenant-X", "prod", "A", "B")},
+		},
+		{
+			name: "per-tenant limits override the default",
+			config: &Config{
+				Default: &Limits{MaxBuckets: ptr.To(1)},
+				Tenants: map[string]*Limits{"tenant-X": {MaxBuckets: ptr.To(2)}},
+			},
+			tenantTuples: []*internal.TenantTuple{
+				tuple("tenant-X", "prod", "A", "B"),
+				tuple("tenant-X", "dev", "C"),
+				tuple("tenant-Y", "prod", "A", "B"),
+			},
+			want: []string{
+				"tenant `tenant-X`: 3 buckets exceed the limit of 2",
+				"tenant `tenant-Y`: 2 buckets exceed the limit of 1",
+			},
+		},
+		{
+			name: "per-env limits",
+			config: &Config{
+				Envs: map[string]*Limits{"prod": {MaxAccountsPerResource: ptr.To(1)}},
+			},
+			tenantTuples: []*internal.TenantTuple{
+				tuple("tenant-X", "prod", "A"),
+				tuple("tenant-X", "dev", "A"),
+			},
+			want: []string{
+				"tenant `tenant-X` in env `prod`: 2 accounts of bucket `A` (env `prod`) exceed the limit of 1",
+			},
+		},
+		{
+			name: "per-account limits across tenants",
+			config: &Config{
+				Accounts: map[string]*Limits{"1234": {MaxPlacements: ptr.To(2)}},
+			},
+			tenantTuples: []*internal.TenantTuple{
+				tuple("tenant-X", "prod", "A", "B"),
+				{
+					TenantID: "tenant-Y",
+					Env:      "prod",
+					Extension: &internal.Extension{
+						Queues: []*internal.Queue{
+							{
+								Name:   "Q",
+								Region: "us-east-1",
+								Selector: []*selector.Requirment{
+									{Key: key.Geo, Operator: operator.DoesNotExist},
+								},
+							},
+						},
+					},
+				},
+			},
+			want: []string{
+				"account `1234`: 3 placements exceed the limit of 2",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, v := range Evaluate(tt.config, accounts, tt.tenantTuples) {
+				got = append(got, v.String())
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Evaluate() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
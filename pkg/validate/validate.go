@@ -0,0 +1,143 @@
+package validate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/generator"
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/internal"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/common/selector"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/infra/account"
+)
+
+// AccountsFile is the path of the accounts, relative to the upstream repo.
+const AccountsFile = "infra/account.pkl"
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Finding is a problem of the upstream user input.
+type Finding struct {
+	Severity Severity `json:"severity"`
+	// File is relative to the upstream repo.
+	File    string `json:"file,omitempty"`
+	Message string `json:"message"`
+}
+
+// supportedProviders are the cloud providers that the generator renders artifacts for.
+var supportedProviders = sets.New("aws", "gcp")
+
+// regionFormat matches the AWS-style region names, e.g., "us-east-1" or "us-gov-west-1".
+var regionFormat = regexp.MustCompile(`^[a-z]{2}(-gov)?-[a-z]+-[0-9]+$`)
+
+// Validate runs the semantic checks over the accounts and tenants.
+func Validate(accounts []*account.Account, tenantTuples []*internal.TenantTuple) []*Finding {
+	var findings []*Finding
+	report := func(severity Severity, file, format string, args ...any) {
+		findings = append(findings, &Finding{Severity: severity, File: file, Message: fmt.Sprintf(format, args...)})
+	}
+
+	seen := sets.New[string]()
+	for _, act := range accounts {
+		if seen.Has(act.AccountID) {
+			report(SeverityError, AccountsFile, "duplicate account ID %q", act.AccountID)
+		}
+		seen.Insert(act.AccountID)
+		if !supportedProviders.Has(act.CloudProvider) {
+			report(SeverityError, AccountsFile, "account %q has unknown cloud provider %q, supported: %s",
+				act.AccountID, act.CloudProvider, strings.Join(sets.List(supportedProviders), ", "))
+		}
+	}
+
+	for _, tuple := range tenantTuples {
+		dir := path.Join("tenants", tuple.TenantID, tuple.Env)
+		file := path.Join(dir, "resource.pkl")
+		for _, msg := range validation.IsDNS1123Label(tuple.TenantID) {
+			report(SeverityError, file, "tenant name %q is not a DNS-1123 label: %s", tuple.TenantID, msg)
+		}
+		for _, msg := range validation.IsDNS1123Label(tuple.Env) {
+			report(SeverityError, file, "env name %q is not a DNS-1123 label: %s", tuple.Env, msg)
+		}
+
+		// The buckets come from resource.pkl, and the queues from extension.yaml.
+		checkPlacement := func(file, kind, name, region string, sel []*selector.Requirment) {
+			switch {
+			case !regionFormat.MatchString(region):
+				report(SeverityError, file, "%s %q has invalid region %q", kind, name, region)
+			case !generator.IsKnownRegion(region):
+				report(SeverityWarning, file, "%s %q has region %q which is not known to map to GCP", kind, name, region)
+			}
+			if len(generator.MatchedAccounts(accounts, tuple, sel)) == 0 {
+				report(SeverityError, file, "%s %q is not placed in any account of env %q", kind, name, tuple.Env)
+			}
+		}
+		if tuple.ResourceConfig != nil {
+			for _, bucket := range tuple.ResourceConfig.Buckets {
+				checkPlacement(file, "bucket", bucket.Name, bucket.Region, bucket.Selector)
+			}
+		}
+		if tuple.Extension != nil {
+			for _, queue := range tuple.Extension.Queues {
+				checkPlacement(path.Join(dir, "extension.yaml"), "queue", queue.Name, queue.Region, queue.Selector)
+			}
+		}
+	}
+
+	return findings
+}
+
+// HasErrors returns whether any of the findings is an error.
+func HasErrors(findings []*Finding) bool {
+	for _, f := range findings {
+		if f.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteJSON writes the findings as a JSON array.
+func WriteJSON(w io.Writer, findings []*Finding) error {
+	if findings == nil {
+		findings = []*Finding{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(findings)
+}
+
+// WriteGitHub writes the findings as GitHub Actions workflow commands, which show up
+// as annotations on the PR.
+func WriteGitHub(w io.Writer, findings []*Finding) error {
+	for _, f := range findings {
+		var err error
+		if f.File != "" {
+			_, err = fmt.Fprintf(w, "::%s file=%s::%s\n", f.Severity, escapeProperty(f.File), escapeData(f.Message))
+		} else {
+			_, err = fmt.Fprintf(w, "::%s::%s\n", f.Severity, escapeData(f.Message))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
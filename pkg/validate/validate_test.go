@@ -0,0 +1,151 @@
+package validate
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/Huang-Wei/25-kubecon-jp-codegen/pkg/internal"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/common/selector"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/common/selector/key"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/common/selector/operator"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/infra/account"
+	"github.com/Huang-Wei/25-kubecon-jp/go/generated/tenant/resource"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		accounts     []*account.Account
+		tenantTuples []*internal.TenantTuple
+		want         []*Finding
+	}{
+		{
+			name: "valid input",
+			accounts: []*account.Account{
+				{AccountID: "1234", CloudProvider: "aws", Tags: map[key.Key]string{key.Env: "prod"}},
+			},
+			tenantTuples: []*internal.TenantTuple{
+				{
+					TenantID: "foo",
+					Env:      "prod",
+					ResourceConfig: &resource.ResourceConfig{
+						Buckets: []*resource.Bucket{{Name: "A", Region: "us-east-1"}},
+					},
+				},
+			},
+		},
+		{
+			name: "invalid accounts",
+			accounts: []*account.Account{
+				{AccountID: "1234", CloudProvider: "aws"},
+				{AccountID: "1234", CloudProvider: "azure"},
+			},
+			want: []*Finding{
+				{Severity: SeverityError, File: AccountsFile, Message: `duplicate account ID "1234"`},
+				{Severity: SeverityError, File: AccountsFile, Message: `account "1234" has unknown cloud provider "azure", supported: aws, gcp`},
+			},
+		},
+		{
+			name: "invalid tenants",
+			accounts: []*account.Account{
+				{AccountID: "1234", CloudProvider: "aws", Tags: map[key.Key]string{key.Env: "prod"}},
+			},
+			tenantTuples: []*internal.TenantTuple{
+				{
+					TenantID: "Foo",
+					Env:      "dev",
+					ResourceConfig: &resource.ResourceConfig{
+						Buckets: []*resource.Bucket{{Name: "A", Region: "us-east-1"}},
+					},
+				},
+				{
+					TenantID: "bar",
+					Env:      "prod",
+					ResourceConfig: &resource.ResourceConfig{
+						Buckets: []*resource.Bucket{
+							{Name: "A", Region: "useast1"},
+							{Name: "B", Region: "ap-southeast-9"},
+						},
+					},
+					Extension: &internal.Extension{
+						Queues: []*internal.Queue{
+							{
+								Name:   "Q",
+								Region: "us-east-1",
+								Selector: []*selector.Requirment{
+									{Key: key.CloudProvider, Operator: operator.Exists},
+								},
+							},
+							{Name: "R", Region: "useast1"},
+						},
+					},
+				},
+			},
+			want: []*Finding{
+				{Severity: SeverityError, File: "tenants/Foo/dev/resource.pkl", Message: `tenant name "Foo" is not a DNS-1123 label: a lowercase RFC 1123 label must consist of lower case alphanumeric characters or '-', and must start and end with an alphanumeric character (e.g. 'my-name',  or '123-abc', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?')`},
+				{Severity: SeverityError, File: "tenants/Foo/dev/resource.pkl", Message: `bucket "A" is not placed in any account of env "dev"`},
+				{Severity: SeverityError, File: "tenants/bar/prod/resource.pkl", Message: `bucket "A" has invalid region "useast1"`},
+				{Severity: SeverityWarning, File: "tenants/bar/prod/resource.pkl", Message: `bucket "B" has region "ap-southeast-9" which is not known to map to GCP`},
+				{Severity: SeverityError, File: "tenants/bar/prod/extension.yaml", Message: `queue "Q" is not placed in any account of env "prod"`},
+				{Severity: SeverityError, File: "tenants/bar/prod/extension.yaml", Message: `queue "R" has invalid region "useast1"`},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Validate(tt.accounts, tt.tenantTuples)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Validate() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	findings := []*Finding{
+		{Severity: SeverityError, File: "tenants/foo/prod/resource.pkl", Message: "bad\nregion: 100%"},
+		{Severity: SeverityWarning, Message: "heads-up"},
+	}
+
+	var gh bytes.Buffer
+	if err := WriteGitHub(&gh, findings); err != nil {
+		t.Fatal(err)
+	}
+	wantGH := "::error file=tenants/foo/prod/resource.pkl::bad%0Aregion: 100%25\n::warning::heads-up\n"
+	if diff := cmp.Diff(wantGH, gh.String()); diff != "" {
+		t.Errorf("WriteGitHub() mismatch (-want +got):\n%s", diff)
+	}
+
+	var js bytes.Buffer
+	if err := WriteJSON(&js, nil); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("[]\n", js.String()); diff != "" {
+		t.Errorf("WriteJSON() mismatch (-want +got):\n%s", diff)
+	}
+	js.Reset()
+	if err := WriteJSON(&js, findings[1:]); err != nil {
+		t.Fatal(err)
+	}
+	wantJSON := `[
+  {
+    "severity": "warning",
+    "message": "heads-up"
+  }
+]
+`
+	if diff := cmp.Diff(wantJSON, js.String()); diff != "" {
+		t.Errorf("WriteJSON() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHasErrors(t *testing.T) {
+	if HasErrors([]*Finding{{Severity: SeverityWarning}}) {
+		t.Error("HasErrors() = true on warnings only")
+	}
+	if !HasErrors([]*Finding{{Severity: SeverityWarning}, {Severity: SeverityError}}) {
+		t.Error("HasErrors() = false on errors")
+	}
+}